@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
 	"preempt/internal/config"
 	"preempt/internal/database"
 	"preempt/internal/detector"
 	"preempt/internal/models"
+	"preempt/internal/notify"
+	"preempt/internal/retry"
+	"preempt/internal/sink"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -14,7 +21,9 @@ import (
 
 func main() {
 	// Load config
-	config.Load("./config.yaml")
+	if _, err := config.Load("./config.yaml"); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 
 	// Initialize database
 	db, err := database.NewDB(config.GetDatabaseDSN())
@@ -22,6 +31,8 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
+	db.SetRollupPolicy(config.Get().RollupAges())
+	db.SetStdDevType(config.Get().Detection.StdDevType)
 
 	// Get all locations from database
 	locations, err := db.GetAllLocations()
@@ -29,43 +40,75 @@ func main() {
 		log.Fatalf("Failed to get locations from database: %v", err)
 	}
 
+	// A fresh install has nothing to detect yet, which isn't a failure of this run
 	if len(locations) == 0 {
-		log.Fatalf("No locations found in database. Please run the seed script first.")
+		log.Println(database.NoLocationsMessage)
+		return
 	}
 
 	log.Printf("Found %d locations in database", len(locations))
 
+	// Newest metric per location being detected, so its watermark can advance once it's processed
+	var newData map[string]time.Time
+	if config.Get().Detection.OnlyNewData {
+		locations, newData, err = locationsWithNewData(db, locations)
+		if err != nil {
+			log.Fatalf("Failed to check for new data: %v", err)
+		}
+		if len(locations) == 0 {
+			log.Println("No location has new data since its last detection run")
+			return
+		}
+	}
+
 	// Initialize Redis client from environment variables
 	redisCfg := config.GetRedisConfig()
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     redisCfg.Addr,
-		Password: redisCfg.Password,
-		DB:       redisCfg.DB,
-	})
+	redisClient := redis.NewClient(redisCfg.Options())
 	defer redisClient.Close()
 
 	// Initialize anomaly detector with Redis client and alarm suggester
 	anomalyDetector := detector.NewAnomalyDetector(redisClient)
 	alarmSuggester := detector.NewAlarmSuggester()
 
+	// Cancel outstanding work on shutdown; results already collected are still stored
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	log.Println("Running anomaly detection for all locations...")
 
 	// Run detection once (ofelia will handle scheduling)
-	runDetectionForAllLocations(db, locations, anomalyDetector, alarmSuggester)
+	// Cooldowns and the last anomaly sent per series live in Redis since each run is a new process
+	router := notify.NewRouter(config.Get())
+	router.SetCooldown(config.Get().NotificationCooldown(), notify.NewRedisCooldownStore(redisClient))
+	router.SetSentStore(notify.NewRedisSentStore(redisClient))
+
+	anomalySink, err := sink.New(config.Get(), db)
+	if err != nil {
+		log.Fatalf("Failed to open anomaly output: %v", err)
+	}
+	defer anomalySink.Close()
+
+	runDetectionForAllLocations(ctx, db, locations, anomalyDetector, alarmSuggester, router, anomalySink, newData)
 
+	if ctx.Err() != nil {
+		log.Println("Detection run interrupted, partial results stored")
+		return
+	}
 	log.Println("Detection run completed successfully")
 }
 
 // DetectionResult holds the results for a single location
 type DetectionResult struct {
 	Location       string
-	Anomalies      []models.Anomaly
+	Anomalies      []models.Anomaly      // only those at or above detection.record_min_severity
+	Detected       int                   // anomalies found before the severity floor was applied
+	Summaries      []models.AnomalyEvent // metrics over detection.max_anomalies_per_metric, one event each
 	Suggestions    []models.AlarmSuggestion
 	Error          error
 	ProcessingTime time.Duration
 }
 
-func runDetectionForAllLocations(db *database.DB, locations []database.Location, anomalyDetector *detector.AnomalyDetector, alarmSuggester *detector.AlarmSuggester) {
+func runDetectionForAllLocations(ctx context.Context, db *database.DB, locations []database.Location, anomalyDetector *detector.AnomalyDetector, alarmSuggester *detector.AlarmSuggester, router *notify.Router, anomalySink sink.AnomalySink, newData map[string]time.Time) {
 	startTime := time.Now()
 	log.Printf("Running anomaly detection for %d locations with worker pool...", len(locations))
 
@@ -83,7 +126,7 @@ func runDetectionForAllLocations(db *database.DB, locations []database.Location,
 	var wg sync.WaitGroup
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
-		go worker(i, db, jobs, results, anomalyDetector, alarmSuggester, &wg)
+		go worker(ctx, i, db, jobs, results, anomalyDetector, alarmSuggester, &wg)
 	}
 
 	// Send all locations to job queue
@@ -99,6 +142,7 @@ func runDetectionForAllLocations(db *database.DB, locations []database.Location,
 	}()
 
 	// Collect and process results
+	totalDetected := 0
 	totalAnomalies := 0
 	totalSuggestions := 0
 	totalErrors := 0
@@ -114,41 +158,71 @@ func runDetectionForAllLocations(db *database.DB, locations []database.Location,
 			continue
 		}
 
+		totalDetected += result.Detected
+
+		// Suggestions can come from stored history even when this run found nothing new
+		for _, suggestion := range result.Suggestions {
+			if err := db.StoreAlarmSuggestion(&suggestion); err != nil {
+				log.Printf("Failed to store alarm suggestion for %s: %v", result.Location, err)
+			} else {
+				totalSuggestions++
+			}
+		}
+
 		if len(result.Anomalies) > 0 {
-			// Store anomalies in database
-			if err := db.StoreAnomalies(result.Anomalies); err != nil {
+			// Write anomalies to the configured output, the database by default
+			if err := anomalySink.WriteAnomalies(result.Anomalies); err != nil {
 				log.Printf("[%d/%d] Failed to store anomalies for %s: %v",
 					locationCount, len(locations), result.Location, err)
 				totalErrors++
+				continue // Keep the watermark so the next run detects this location again
 			} else {
 				totalAnomalies += len(result.Anomalies)
 
-				// Store alarm suggestions
-				if len(result.Suggestions) > 0 {
-					for _, suggestion := range result.Suggestions {
-						if err := db.StoreAlarmSuggestion(&suggestion); err != nil {
-							log.Printf("Failed to store alarm suggestion for %s: %v", result.Location, err)
-						} else {
-							totalSuggestions++
-						}
+				// Only stored anomalies are announced, each to the channels routed for its severity.
+				// Not tied to ctx since results collected before a shutdown are still stored.
+				router.Notify(context.Background(), result.Anomalies)
+
+				// Group observed bursts into events while keeping the raw anomalies above. Capped metrics
+				// only kept a sample, so their summary replaces the events clustered from it. A burst
+				// clustered again by the next run updates its stored event.
+				summarized := make(map[string]bool)
+				for _, summary := range result.Summaries {
+					summarized[summary.MetricType] = true
+				}
+				events := result.Summaries
+				for _, event := range detector.ClusterAnomalies(result.Anomalies, config.Get().ClusterWindow()) {
+					if !summarized[event.MetricType] {
+						events = append(events, event)
 					}
 				}
+				if err := db.StoreAnomalyEvents(events); err != nil {
+					log.Printf("Failed to store anomaly events for %s: %v", result.Location, err)
+				}
 
-				log.Printf("[%d/%d] ✓ %s: %d anomalies, %d suggestions (%.1fs)",
+				log.Printf("[%d/%d] ✓ %s: %d anomalies (%d detected), %d suggestions (%.1fs)",
 					locationCount, len(locations), result.Location,
-					len(result.Anomalies), len(result.Suggestions), result.ProcessingTime.Seconds())
+					len(result.Anomalies), result.Detected, len(result.Suggestions), result.ProcessingTime.Seconds())
 			}
 		} else {
 			log.Printf("[%d/%d] ✓ %s: no anomalies (%.1fs)",
 				locationCount, len(locations), result.Location, result.ProcessingTime.Seconds())
 		}
+
+		// Only set when detection.only_new_data is on, a failed location keeps its old watermark and is detected again
+		if latest, ok := newData[result.Location]; ok {
+			if err := db.SetDetectionWatermark(result.Location, latest); err != nil {
+				log.Printf("%v", err)
+			}
+		}
 	}
 
 	totalDuration := time.Since(startTime)
 	log.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	log.Printf("Detection complete in %.1f minutes (%.1f seconds)", totalDuration.Minutes(), totalDuration.Seconds())
 	log.Printf("  Locations: %d processed, %d errors", locationCount-totalErrors, totalErrors)
-	log.Printf("  Anomalies: %d found", totalAnomalies)
+	log.Printf("  Anomalies: %d found, %d recorded (record_min_severity %s)",
+		totalDetected, totalAnomalies, config.Get().Detection.RecordMinSeverity)
 	log.Printf("  Suggestions: %d generated", totalSuggestions)
 	log.Printf("  Avg time/location: %.1fs", totalDuration.Seconds()/float64(locationCount))
 	log.Printf("  Workers: %d", numWorkers)
@@ -156,15 +230,20 @@ func runDetectionForAllLocations(db *database.DB, locations []database.Location,
 }
 
 // worker processes locations from the jobs channel
-func worker(id int, db *database.DB, jobs <-chan database.Location, results chan<- DetectionResult,
+func worker(ctx context.Context, id int, db database.MetricsStore, jobs <-chan database.Location, results chan<- DetectionResult,
 	anomalyDetector *detector.AnomalyDetector, alarmSuggester *detector.AlarmSuggester, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for location := range jobs {
+		// Leave remaining locations for the next scheduled run once shutdown starts
+		if ctx.Err() != nil {
+			return
+		}
+
 		startTime := time.Now()
 
 		// Detect anomalies for this location
-		anomalies, err := anomalyDetector.DetectAnomalies(db, location.Name)
+		anomalies, err := detectWithRetry(ctx, detectionRetryPolicy(), anomalyDetector, db, location.Name)
 		if err != nil {
 			results <- DetectionResult{
 				Location:       location.Name,
@@ -174,17 +253,92 @@ func worker(id int, db *database.DB, jobs <-chan database.Location, results chan
 			continue
 		}
 
+		// A runaway sensor keeps a sample of its anomalies plus a summary
+		anomalies, summaries := anomalyDetector.CapAnomalies(anomalies)
+
+		// Predicted anomalies are stored alongside observed ones but kept out of suggestions
+		var upcoming []models.Anomaly
+		if config.Get().Forecast.Enabled {
+			upcoming, err = anomalyDetector.DetectUpcomingAnomalies(db, location.Name)
+			if err != nil {
+				log.Printf("Upcoming anomaly detection skipped for %s: %v", location.Name, err)
+			}
+		}
+
 		// Generate alarm suggestions if anomalies found
-		var suggestions []models.AlarmSuggestion
-		if len(anomalies) > 0 {
+		// Stored history counts too, so even a run with few new anomalies can complete a recurring pattern
+		suggestions, err := alarmSuggester.SuggestAlarmsWithHistory(db, anomalies, location.Name)
+		if err != nil {
+			log.Printf("Falling back to current-run suggestions for %s: %v", location.Name, err)
 			suggestions = alarmSuggester.SuggestAlarms(anomalies, location.Name)
 		}
 
+		// Suggestions above saw every anomaly, the floor only decides what is stored and notified
+		detected := append(anomalies, upcoming...)
+		recorded := detector.FilterBySeverity(detected, config.Get().Detection.RecordMinSeverity)
+
 		results <- DetectionResult{
 			Location:       location.Name,
-			Anomalies:      anomalies,
+			Anomalies:      recorded,
+			Detected:       len(detected),
+			Summaries:      summaries,
 			Suggestions:    suggestions,
 			ProcessingTime: time.Since(startTime),
 		}
 	}
 }
+
+// detectionRetryPolicy retries detection with the default backoff, only for transient database errors
+func detectionRetryPolicy() retry.Policy {
+	policy := retry.DefaultPolicy()
+	policy.Retryable = database.IsTransient
+	return policy
+}
+
+// detectWithRetry runs detection for a location, retrying with backoff when the database fails
+// transiently so a brief hiccup doesn't skip the location until the next run. Too little data
+// isn't an error (detection logs and skips it), and other errors are returned at once.
+func detectWithRetry(ctx context.Context, policy retry.Policy, anomalyDetector *detector.AnomalyDetector, db database.MetricsStore, location string) ([]models.Anomaly, error) {
+	var anomalies []models.Anomaly
+	attempt := 0
+	err := retry.Do(ctx, policy, func() error {
+		attempt++
+		if attempt > 1 {
+			log.Printf("Retry %d/%d: detecting anomalies for %s", attempt, policy.MaxAttempts, location)
+		}
+		var detectErr error
+		anomalies, detectErr = anomalyDetector.DetectAnomalies(ctx, db, location)
+		return detectErr
+	})
+	return anomalies, err
+}
+
+// locationsWithNewData keeps the locations whose newest metric is later than their detection
+// watermark, or that have no watermark yet, and returns the newest metric time of each kept one
+func locationsWithNewData(db *database.DB, locations []database.Location) ([]database.Location, map[string]time.Time, error) {
+	latest, err := db.GetLatestMetricTimes()
+	if err != nil {
+		return nil, nil, err
+	}
+	watermarks, err := db.GetDetectionWatermarks()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var kept []database.Location
+	newData := make(map[string]time.Time)
+	for _, loc := range locations {
+		newest, hasData := latest[loc.Name]
+		if !hasData {
+			continue // Nothing collected yet, nothing to detect
+		}
+		if watermark, seen := watermarks[loc.Name]; seen && !newest.After(watermark) {
+			continue
+		}
+		kept = append(kept, loc)
+		newData[loc.Name] = newest
+	}
+
+	log.Printf("%d of %d locations have new data since their last detection run", len(kept), len(locations))
+	return kept, newData, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"preempt/internal/config/configtest"
+	"preempt/internal/database"
+	"preempt/internal/database/databasetest"
+	"preempt/internal/detector"
+	"preempt/internal/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// flakyStore fails its first failures GetMetrics calls with err, then reads the memory store
+type flakyStore struct {
+	*databasetest.MemoryStore
+	err      error
+	failures int
+	calls    int
+}
+
+func (s *flakyStore) GetMetrics(location string, metricTypes []string, since time.Time) ([]models.Metric, error) {
+	s.calls++
+	if s.calls <= s.failures {
+		return nil, s.err
+	}
+	return s.MemoryStore.GetMetrics(location, metricTypes, since)
+}
+
+// spikeStore holds a week of steady hourly temperatures at Tokyo and a spike 10 minutes ago
+func spikeStore(now time.Time) *databasetest.MemoryStore {
+	store := databasetest.NewMemoryStore()
+	for h := 1; h <= 7*24; h++ {
+		store.AddMetrics(models.Metric{Location: "Tokyo", Timestamp: now.Add(-time.Duration(h) * time.Hour), MetricType: "temperature_2m", Value: 20 + float64(2*(h%2))})
+	}
+	store.AddMetrics(models.Metric{Location: "Tokyo", Timestamp: now.Add(-10 * time.Minute), MetricType: "temperature_2m", Value: 35})
+	return store
+}
+
+func TestDetectWithRetry(t *testing.T) {
+	configtest.Use(t, "weather:\n  monitored_fields: [temperature_2m]\n")
+	policy := detectionRetryPolicy()
+	policy.BaseDelay = time.Millisecond
+
+	tests := []struct {
+		name      string
+		err       error
+		failures  int
+		wantErr   bool
+		wantCalls int
+	}{
+		// Detection reads the baseline and the evaluation window, so a success is 2 calls
+		{name: "transient failure is retried", err: driver.ErrBadConn, failures: 1, wantCalls: 3},
+		{name: "persistent transient failure gives up", err: driver.ErrBadConn, failures: 10, wantErr: true, wantCalls: policy.MaxAttempts},
+		{name: "query error is not retried", err: errors.New("Unknown column 'unit'"), failures: 1, wantErr: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &flakyStore{MemoryStore: spikeStore(time.Now()), err: tt.err, failures: tt.failures}
+			anomalies, err := detectWithRetry(context.Background(), policy, detector.NewAnomalyDetector(nil), store, "Tokyo")
+
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if store.calls != tt.wantCalls {
+				t.Errorf("GetMetrics called %d times, want %d", store.calls, tt.wantCalls)
+			}
+			if !tt.wantErr && len(anomalies) == 0 {
+				t.Error("location wasn't processed after the retry, no anomalies found")
+			}
+		})
+	}
+}
+
+func TestLocationsWithNewDataSkipsStaleLocations(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	watermark := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	advanced := watermark.Add(time.Hour)
+	mock.ExpectQuery("SELECT location, MAX\\(timestamp\\) FROM metrics GROUP BY location").
+		WillReturnRows(sqlmock.NewRows([]string{"location", "MAX(timestamp)"}).
+			AddRow("Tokyo", advanced).
+			AddRow("Lima", watermark))
+	mock.ExpectQuery("SELECT location, last_metric_at FROM detection_watermarks").
+		WillReturnRows(sqlmock.NewRows([]string{"location", "last_metric_at"}).
+			AddRow("Tokyo", watermark).
+			AddRow("Lima", watermark))
+
+	locations := []database.Location{{ID: 1, Name: "Tokyo"}, {ID: 2, Name: "Lima"}}
+	kept, newData, err := locationsWithNewData(database.NewFromConn(conn), locations)
+	if err != nil {
+		t.Fatalf("locationsWithNewData: %v", err)
+	}
+
+	if len(kept) != 1 || kept[0].Name != "Tokyo" {
+		t.Fatalf("kept = %+v, want only Tokyo", kept)
+	}
+	if len(newData) != 1 || !newData["Tokyo"].Equal(advanced) {
+		t.Errorf("newData = %v, want Tokyo at %v", newData, advanced)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWorkerRecordsOnlyAnomaliesAtTheSeverityFloor(t *testing.T) {
+	configtest.Use(t, `
+weather:
+  monitored_fields: [temperature_2m, surface_pressure]
+detection:
+  record_min_severity: medium
+  windows:
+    stats: {evaluation: 30m}
+    ml: {evaluation: 30m}
+`)
+
+	// Both baselines have a mean 1 below their high samples and a std dev of 1, so the only readings
+	// in the 30m evaluation window are a temperature at z~1.3 (low) and a pressure far above the high band
+	now := time.Now()
+	store := databasetest.NewMemoryStore()
+	for h := 1; h <= 7*24; h++ {
+		at := now.Add(-time.Duration(h) * time.Hour)
+		store.AddMetrics(
+			models.Metric{Location: "Tokyo", Timestamp: at, MetricType: "temperature_2m", Value: 20 + float64(2*(h%2))},
+			models.Metric{Location: "Tokyo", Timestamp: at, MetricType: "surface_pressure", Value: 1010 + float64(2*(h%2))},
+		)
+	}
+	store.AddMetrics(
+		models.Metric{Location: "Tokyo", Timestamp: now.Add(-10 * time.Minute), MetricType: "temperature_2m", Value: 22.3},
+		models.Metric{Location: "Tokyo", Timestamp: now.Add(-10 * time.Minute), MetricType: "surface_pressure", Value: 1030},
+	)
+
+	jobs := make(chan database.Location, 1)
+	results := make(chan DetectionResult, 1)
+	jobs <- database.Location{ID: 1, Name: "Tokyo"}
+	close(jobs)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	worker(context.Background(), 0, store, jobs, results, detector.NewAnomalyDetector(nil), detector.NewAlarmSuggester(), &wg)
+	result := <-results
+	if result.Error != nil {
+		t.Fatalf("worker: %v", result.Error)
+	}
+
+	if result.Detected != 2 {
+		t.Errorf("Detected = %d, want the low and the high anomaly", result.Detected)
+	}
+	if len(result.Anomalies) != 1 || result.Anomalies[0].MetricType != "surface_pressure" {
+		t.Fatalf("recorded %+v, want only the surface_pressure anomaly", result.Anomalies)
+	}
+	if result.Anomalies[0].Severity != "high" {
+		t.Errorf("recorded severity = %q, want high", result.Anomalies[0].Severity)
+	}
+}
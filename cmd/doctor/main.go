@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"preempt/internal/api"
+	"preempt/internal/config"
+	"preempt/internal/database"
+	"preempt/internal/models"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// check is a single named step of the setup verification
+type check struct {
+	name string
+	run  func() error
+}
+
+func main() {
+	configPath := "./config.yaml"
+	if path := os.Getenv("CONFIG_PATH"); path != "" {
+		configPath = path
+	}
+
+	var cfg *config.Config
+	var db *database.DB
+	defer func() {
+		if db != nil {
+			db.Close()
+		}
+	}()
+
+	checks := []check{
+		{
+			name: "Load and validate " + configPath,
+			run: func() error {
+				loaded, err := config.Load(configPath)
+				if err != nil {
+					return err
+				}
+				cfg = loaded
+				return nil
+			},
+		},
+		{
+			name: "Connect to MySQL",
+			run: func() error {
+				conn, err := database.NewDB(config.GetDatabaseDSN())
+				if err != nil {
+					return err
+				}
+				db = conn
+				return nil
+			},
+		},
+		{
+			name: "Connect to Redis",
+			run: func() error {
+				redisCfg := config.GetRedisConfig()
+				redisClient := redis.NewClient(&redis.Options{
+					Addr:     redisCfg.Addr,
+					Password: redisCfg.Password,
+					DB:       redisCfg.DB,
+				})
+				defer redisClient.Close()
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				return redisClient.Ping(ctx).Err()
+			},
+		},
+		{
+			name: "Fetch current weather from Open-Meteo",
+			run: func() error {
+				if cfg == nil || db == nil {
+					return fmt.Errorf("skipped: config or database unavailable")
+				}
+				return fetchFirstLocation(context.Background(), db, api.NewOpenMeteoClient(), cfg.Weather.MonitoredFields)
+			},
+		},
+	}
+
+	if !runChecks(checks) {
+		os.Exit(1)
+	}
+}
+
+// locationLister is the part of the database the fetch check reads locations from
+type locationLister interface {
+	GetAllLocations() ([]database.Location, error)
+}
+
+// currentFetcher is the part of a weather provider the fetch check calls
+type currentFetcher interface {
+	GetCurrentWeatherWithContext(ctx context.Context, lat, long float64, fields []string) (*models.Forecast, error)
+}
+
+// fetchFirstLocation does a single current weather fetch for the first stored location
+func fetchFirstLocation(ctx context.Context, locations locationLister, provider currentFetcher, fields []string) error {
+	all, err := locations.GetAllLocations()
+	if err != nil {
+		return err
+	}
+	if len(all) == 0 {
+		return fmt.Errorf("no locations in database, run the seed command first")
+	}
+	loc := all[0]
+	if _, err := provider.GetCurrentWeatherWithContext(ctx, loc.Latitude, loc.Longitude, fields); err != nil {
+		return fmt.Errorf("%s: %w", loc.Name, err)
+	}
+	return nil
+}
+
+// runChecks runs every check in order, prints a pass/fail line for each and reports whether all passed
+func runChecks(checks []check) bool {
+	log.SetFlags(0)
+
+	failed := 0
+	for _, c := range checks {
+		if err := c.run(); err != nil {
+			log.Printf("[FAIL] %s: %v", c.name, err)
+			failed++
+			continue
+		}
+		log.Printf("[ OK ] %s", c.name)
+	}
+
+	if failed > 0 {
+		log.Printf("%d of %d checks failed", failed, len(checks))
+		return false
+	}
+
+	log.Printf("All %d checks passed", len(checks))
+	return true
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"preempt/internal/database"
+	"preempt/internal/models"
+	"strings"
+	"testing"
+)
+
+type fakeLocations struct {
+	locations []database.Location
+	err       error
+}
+
+func (f fakeLocations) GetAllLocations() ([]database.Location, error) {
+	return f.locations, f.err
+}
+
+// fakeFetcher records the coordinates it was asked for and fails with err when set
+type fakeFetcher struct {
+	err     error
+	fetched []float64
+}
+
+func (f *fakeFetcher) GetCurrentWeatherWithContext(ctx context.Context, lat, long float64, fields []string) (*models.Forecast, error) {
+	f.fetched = append(f.fetched, lat)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.Forecast{}, nil
+}
+
+func TestFetchFirstLocation(t *testing.T) {
+	stored := []database.Location{{Name: "Tokyo", Latitude: 35.68}, {Name: "Lima", Latitude: -12.05}}
+
+	tests := []struct {
+		name      string
+		locations fakeLocations
+		fetchErr  error
+		wantErr   string
+		wantFetch int
+	}{
+		{name: "fetches the first location only", locations: fakeLocations{locations: stored}, wantFetch: 1},
+		{name: "no locations", locations: fakeLocations{}, wantErr: "run the seed command"},
+		{name: "database error", locations: fakeLocations{err: errors.New("connection refused")}, wantErr: "connection refused"},
+		{name: "fetch error names the location", locations: fakeLocations{locations: stored}, fetchErr: errors.New("status 400"), wantErr: "Tokyo: status 400", wantFetch: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := &fakeFetcher{err: tt.fetchErr}
+			err := fetchFirstLocation(context.Background(), tt.locations, fetcher, []string{"temperature_2m"})
+
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+			if len(fetcher.fetched) != tt.wantFetch {
+				t.Fatalf("fetched %d times, want %d", len(fetcher.fetched), tt.wantFetch)
+			}
+			if tt.wantFetch > 0 && fetcher.fetched[0] != 35.68 {
+				t.Errorf("fetched latitude %v, want Tokyo's", fetcher.fetched[0])
+			}
+		})
+	}
+}
+
+func TestRunChecksReportsEveryFailure(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	})
+
+	var ran []string
+	step := func(name string, err error) check {
+		return check{name: name, run: func() error {
+			ran = append(ran, name)
+			return err
+		}}
+	}
+	checks := []check{
+		step("Load config", nil),
+		step("Connect to MySQL", errors.New("access denied")),
+		step("Connect to Redis", nil),
+		step("Fetch current weather", errors.New("skipped: config or database unavailable")),
+	}
+
+	if runChecks(checks) {
+		t.Error("runChecks passed with two failing checks")
+	}
+	if len(ran) != len(checks) {
+		t.Errorf("ran %v, a failure must not stop later checks", ran)
+	}
+	for _, line := range []string{"[ OK ] Load config", "[FAIL] Connect to MySQL: access denied", "[ OK ] Connect to Redis", "2 of 4 checks failed"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("output missing %q:\n%s", line, out.String())
+		}
+	}
+
+	out.Reset()
+	if !runChecks(checks[:1]) {
+		t.Error("runChecks failed with every check passing")
+	}
+	if !strings.Contains(out.String(), "All 1 checks passed") {
+		t.Errorf("output = %q", out.String())
+	}
+}
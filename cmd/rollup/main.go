@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"log"
+	"preempt/internal/config"
+	"preempt/internal/database"
+	"time"
+)
+
+func main() {
+	// Load config
+	if _, err := config.Load("./config.yaml"); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	cfg := config.Get()
+
+	// Initialize database
+	db, err := database.NewDB(config.GetDatabaseDSN())
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	hourlyAfter, dailyAfter := cfg.RollupAges()
+	ctx := context.Background()
+	now := time.Now()
+
+	// Run once (ofelia will handle scheduling), raw -> hourly first so fresh hourly rows can roll on to daily
+	rawRows, err := db.RollupHourly(ctx, now.Add(-hourlyAfter))
+	if err != nil {
+		log.Fatalf("Hourly rollup failed: %v", err)
+	}
+
+	hourlyRows, err := db.RollupDaily(ctx, now.Add(-dailyAfter))
+	if err != nil {
+		log.Fatalf("Daily rollup failed: %v", err)
+	}
+
+	log.Printf("Rollup completed: %d raw rows -> hourly, %d hourly rows -> daily", rawRows, hourlyRows)
+
+	// Raw forecasts are pruned even if auditing was switched off since they were stored
+	pruned, err := db.PruneRawForecasts(now.Add(-cfg.RawForecastRetention()))
+	if err != nil {
+		log.Fatalf("Raw forecast pruning failed: %v", err)
+	}
+	log.Printf("Pruned %d raw forecasts", pruned)
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"encoding/csv"
+	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -11,8 +13,19 @@ import (
 )
 
 func main() {
+	csvPath := flag.String("csv", "locations_seed.csv", "CSV file with name,latitude,longitude rows")
+	sync := flag.Bool("sync", false, "reconcile the database with the CSV: insert new locations and update moved coordinates")
+	prune := flag.Bool("prune", false, "with -sync, delete locations that are not in the CSV")
+	flag.Parse()
+
+	if *prune && !*sync {
+		log.Fatalf("-prune only applies together with -sync")
+	}
+
 	// Load config for database connection
-	config.Load("./config.yaml")
+	if _, err := config.Load("./config.yaml"); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 
 	// Initialize database
 	db, err := database.NewDB(config.GetDatabaseDSN())
@@ -20,26 +33,59 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
+	db.SetBatchSize(config.Get().DB.BatchSize)
+
+	locations, skipped, err := readLocations(*csvPath)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// A malformed row would otherwise read as a location missing from the CSV and be deleted
+	if *prune && skipped > 0 {
+		log.Fatalf("Refusing to prune: %d CSV rows were skipped as invalid, fix them and run again", skipped)
+	}
+
+	if *sync {
+		result, err := db.SyncLocations(locations, *prune)
+		if err != nil {
+			log.Fatalf("Location sync failed: %v", err)
+		}
+		log.Printf("Sync complete! Inserted %d, updated %d, deleted %d, unchanged %d, skipped %d invalid rows",
+			result.Inserted, result.Updated, result.Deleted, result.Unchanged, skipped)
+		return
+	}
 
-	csvPath := "locations_seed.csv"
+	// Insert all locations, committing every db.batch_size rows
+	count, err := db.ImportLocations(locations)
+	if err != nil {
+		log.Fatalf("Import failed after inserting %d locations: %v", count, err)
+	}
+
+	// Locations that already exist are skipped by the import
+	skipped += len(locations) - count
+	log.Printf("Import complete! Successfully inserted %d locations, skipped %d", count, skipped)
+}
+
+// readLocations parses the seed CSV, skipping (and counting) rows that are malformed
+func readLocations(csvPath string) ([]database.Location, int, error) {
 	file, err := os.Open(csvPath)
 	if err != nil {
-		log.Fatalf("Failed to open CSV file: %v", err)
+		return nil, 0, fmt.Errorf("failed to open CSV file: %w", err)
 	}
 	defer file.Close()
 
-	// Create CSV reader
+	// Create CSV reader, short rows are skipped below rather than failing the whole read
 	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
 
 	// Read header row
 	header, err := reader.Read()
 	if err != nil {
-		log.Fatalf("Failed to read CSV header: %v", err)
+		return nil, 0, fmt.Errorf("failed to read CSV header: %w", err)
 	}
 	log.Printf("CSV Header: %v\n", header)
 
-	// Read and insert all locations
-	count := 0
+	var locations []database.Location
 	skipped := 0
 
 	for {
@@ -48,7 +94,7 @@ func main() {
 			if err == io.EOF {
 				break
 			}
-			log.Fatalf("Failed to read CSV record: %v", err)
+			return nil, 0, fmt.Errorf("failed to read CSV record: %w", err)
 		}
 
 		if len(record) < 3 {
@@ -72,25 +118,8 @@ func main() {
 			continue
 		}
 
-		// Insert location into database
-		err = db.InsertLocation(name, latitude, longitude)
-		if err != nil {
-			// Check if it's a duplicate error
-			if err.Error() == "duplicate location" {
-				log.Printf("Location already exists: %s", name)
-				skipped++
-			} else {
-				log.Printf("Failed to insert location %s: %v", name, err)
-				skipped++
-			}
-			continue
-		}
-
-		count++
-		if count%100 == 0 {
-			log.Printf("Inserted %d locations...", count)
-		}
+		locations = append(locations, database.Location{Name: name, Latitude: latitude, Longitude: longitude})
 	}
 
-	log.Printf("Import complete! Successfully inserted %d locations, skipped %d", count, skipped)
+	return locations, skipped, nil
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadLocationsCountsSkippedRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locations.csv")
+	csv := "name,latitude,longitude\n" +
+		"Tokyo,35.68,139.69\n" +
+		"Paris,north,2.35\n" +
+		"Oslo,59.91\n" +
+		"Lima,-12.05,-77.04\n"
+	if err := os.WriteFile(path, []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	locations, skipped, err := readLocations(path)
+	if err != nil {
+		t.Fatalf("readLocations: %v", err)
+	}
+	if skipped != 2 {
+		t.Errorf("skipped = %d, want 2 so -prune refuses to run", skipped)
+	}
+	if len(locations) != 2 || locations[0].Name != "Tokyo" || locations[1].Name != "Lima" {
+		t.Errorf("locations = %+v, want Tokyo and Lima", locations)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"preempt/internal/detector"
 	_ "preempt/internal/metrics" // Register Prometheus metrics
 	"preempt/internal/server"
+	_ "time/tzdata" // Embed timezone data for the tz query param, the runtime image has none
 
 	"github.com/go-redis/redis/v8"
 )
@@ -25,6 +26,8 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
+	db.SetRollupPolicy(cfg.RollupAges())
+	db.SetStdDevType(cfg.Detection.StdDevType)
 
 	// Initialize Redis client
 	redisClient := redis.NewClient(&redis.Options{
@@ -34,9 +37,16 @@ func main() {
 	})
 	defer redisClient.Close()
 
-	openMeteoClient := api.NewOpenMeteoClient()
+	// The server runs for a long time, so identical API requests reuse responses across handlers
+	current, historical, forecast := cfg.WeatherCacheTTLs()
+	openMeteoClient := api.NewOpenMeteoClient(api.WithCache(api.CacheTTLs{Current: current, Historical: historical, Forecast: forecast}))
 	anomalyDetector := detector.NewAnomalyDetector(redisClient)
 
+	// Detect writes anomalies elsewhere, so the anomaly endpoints have nothing to read
+	if warning := cfg.AnomalyOutputWarning(); warning != "" {
+		log.Printf("Warning: %s", warning)
+	}
+
 	srv := server.NewServer(db, openMeteoClient, anomalyDetector)
 
 	log.Println("Server running on http://localhost:8080")
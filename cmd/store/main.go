@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"preempt/internal/database"
 	_ "preempt/internal/metrics"
 	"preempt/internal/models"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,17 +20,21 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// Backoff bounds applied between failed stream reads
+const (
+	minReadBackoff = time.Second
+	maxReadBackoff = 30 * time.Second
+)
+
 func main() {
 	// Load config
-	config.Load("./config.yaml")
+	if _, err := config.Load("./config.yaml"); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 
 	// Initialize Redis client from environment variables
 	redisCfg := config.GetRedisConfig()
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     redisCfg.Addr,
-		Password: redisCfg.Password,
-		DB:       redisCfg.DB,
-	})
+	redisClient := redis.NewClient(redisCfg.Options())
 	defer redisClient.Close()
 
 	// Initialize database
@@ -38,10 +44,25 @@ func main() {
 	}
 	defer db.Close()
 
+	// Apply configured plausibility bounds on top of the built-in limits
+	bounds := make(map[string]database.ValueBounds)
+	for metricType, b := range config.Get().Ingestion.Bounds {
+		bounds[metricType] = database.ValueBounds{Min: b.Min, Max: b.Max}
+	}
+	db.SetValueBounds(bounds)
+	db.SetBatchSize(config.Get().DB.BatchSize)
+
 	// Consumer group and name
-	consumerGroup := "weather_consumers"
+	consumerGroup := redisCfg.ConsumerGroup
 	consumerName := "consumer-1"
-	stream := redisCfg.Stream
+	// Each data type may have its own stream, reading them together keeps a historical backfill
+	// from queueing ahead of current data since XREADGROUP's count applies per stream
+	streams := redisCfg.Streams()
+	readArgs := make([]string, 0, 2*len(streams))
+	readArgs = append(readArgs, streams...)
+	for range streams {
+		readArgs = append(readArgs, ">")
+	}
 
 	log.Printf("Connecting to Redis at %s", redisCfg.Addr)
 
@@ -58,10 +79,12 @@ func main() {
 		break
 	}
 
-	// Create consumer group if it doesn't exist
-	err = redisClient.XGroupCreateMkStream(context.Background(), stream, consumerGroup, "0").Err()
-	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
-		log.Fatalf("Failed to create consumer group: %v", err)
+	// Create consumer groups if they don't exist
+	for _, stream := range streams {
+		err = redisClient.XGroupCreateMkStream(context.Background(), stream, consumerGroup, "0").Err()
+		if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
+			log.Fatalf("Failed to create consumer group on %s: %v", stream, err)
+		}
 	}
 
 	quit := make(chan os.Signal, 1)
@@ -70,10 +93,15 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Track backlog and throughput so operators know when to add replicas
+	tracker := newStatusTracker(redisClient, streams, consumerGroup)
+	go tracker.run(ctx)
+
 	// Start metrics endpoint on port 8081
 	go func() {
 		mux := http.NewServeMux()
 		mux.Handle("/prometheus", promhttp.Handler())
+		mux.HandleFunc("/store-status", tracker.handleStatus)
 		log.Println("Store metrics endpoint started on :8081/prometheus")
 		if err := http.ListenAndServe(":8081", mux); err != nil {
 			log.Printf("Metrics endpoint error: %v", err)
@@ -90,12 +118,13 @@ func main() {
 	log.Println("Store into db started, reading from Redis stream. Press Ctrl+C to stop...")
 
 	// Read from stream in a loop
+	readBackoff := minReadBackoff
 	for {
 		msgs, err := redisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
 			Group:    consumerGroup,
 			Consumer: consumerName,
-			Streams:  []string{stream, ">"},
-			Count:    10,              // Process up to 10 messages at a time
+			Streams:  readArgs,
+			Count:    10,              // Process up to 10 messages per stream at a time
 			Block:    time.Second * 5, // Block for 5 seconds if no messages
 		}).Result()
 
@@ -105,62 +134,131 @@ func main() {
 		}
 
 		if err != nil && err != redis.Nil {
-			log.Printf("Error reading from Redis: %v", err)
+			// Back off so an outage doesn't become a hot error loop
+			log.Printf("Error reading from Redis, retrying in %v: %v", readBackoff, err)
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				// Redis restarted without persistence, recreate the groups
+				for _, stream := range streams {
+					redisClient.XGroupCreateMkStream(ctx, stream, consumerGroup, "0")
+				}
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(readBackoff):
+			}
+			readBackoff *= 2
+			if readBackoff > maxReadBackoff {
+				readBackoff = maxReadBackoff
+			}
 			continue
 		}
+		readBackoff = minReadBackoff
 
 		for _, msg := range msgs {
-			for _, m := range msg.Messages {
-				// Check if shutdown requested
-				if ctx.Err() != nil {
-					log.Println("Store service stopped")
-					return
-				}
+			stored := storeBatch(ctx, redisClient, consumerGroup, msg, func(m redis.XMessage) error {
+				return processMessage(db, m)
+			})
+			if stored == 0 {
+				continue
+			}
+			tracker.recordProcessed(stored)
 
-				// Unmarshal the data
-				var payload struct {
-					Location struct {
-						Name      string  `json:"name"`
-						Latitude  float64 `json:"latitude"`
-						Longitude float64 `json:"longitude"`
-					} `json:"location"`
-					Forecast json.RawMessage `json:"forecast"`
-					Fields   []string        `json:"fields"`
-					Type     string          `json:"type"`
-				}
+			// Trim the stream to prevent unbounded growth (keep last 1000 messages)
+			redisClient.XTrimMaxLen(context.Background(), msg.Stream, 1000).Err()
+		}
 
-				err := json.Unmarshal([]byte(m.Values["data"].(string)), &payload)
-				if err != nil {
-					log.Printf("Failed to unmarshal message: %v", err)
-					continue
-				}
+		if ctx.Err() != nil {
+			break
+		}
+	}
 
-				// Convert to models.Forecast
-				forecast := &models.Forecast{}
-				if err := json.Unmarshal(payload.Forecast, forecast); err != nil {
-					log.Printf("Failed to unmarshal forecast for %s: %v", payload.Location.Name, err)
-					continue
-				}
+	log.Println("Store service stopped")
+}
 
-				// Store in DB
-				isInitial := payload.Type == "historical"
-				if err := db.StoreMetrics(forecast, payload.Location.Name, payload.Fields, isInitial); err != nil {
-					log.Printf("Failed to store metrics for %s: %v", payload.Location.Name, err)
-					continue
-				}
+// streamAcker acknowledges stream messages, *redis.Client in production
+type streamAcker interface {
+	XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd
+}
 
-				log.Printf("Stored %s data for %s (%.2f, %.2f)",
-					payload.Type, payload.Location.Name,
-					payload.Location.Latitude, payload.Location.Longitude)
+// storeBatch processes one stream's messages and acks the stored ones in a single round trip.
+// Failed messages stay pending for redelivery, and processing stops early on shutdown.
+// Returns how many messages were stored.
+func storeBatch(ctx context.Context, acker streamAcker, group string, msg redis.XStream, process func(redis.XMessage) error) int {
+	var processed []string
+	for _, m := range msg.Messages {
+		// Check if shutdown requested
+		if ctx.Err() != nil {
+			break
+		}
 
-				// Acknowledge the message
-				redisClient.XAck(context.Background(), stream, consumerGroup, m.ID)
+		if err := process(m); err != nil {
+			log.Printf("Failed to process message %s: %v", m.ID, err)
+			continue
+		}
+		processed = append(processed, m.ID)
+	}
 
-				// Trim weather_metrics stream to prevent unbounded growth (keep last 1000 messages)
-				redisClient.XTrimMaxLen(context.Background(), stream, 1000).Err()
-			}
+	if len(processed) == 0 {
+		return 0
+	}
+
+	// Acknowledge the batch, with a fresh context so messages stored during shutdown are still acked
+	if err := acker.XAck(context.Background(), msg.Stream, group, processed...).Err(); err != nil {
+		log.Printf("Failed to ack %d messages on %s: %v", len(processed), msg.Stream, err)
+	}
+	return len(processed)
+}
+
+// processMessage decodes a single stream message and stores its forecast
+func processMessage(db *database.DB, m redis.XMessage) error {
+	data, ok := m.Values["data"].(string)
+	if !ok {
+		return fmt.Errorf("message has no 'data' field")
+	}
+
+	// Unmarshal the data
+	var payload struct {
+		Location struct {
+			Name      string  `json:"name"`
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+		} `json:"location"`
+		Forecast json.RawMessage `json:"forecast"`
+		Fields   []string        `json:"fields"`
+		Type     string          `json:"type"`
+	}
+
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+
+	// Convert to models.Forecast
+	forecast := &models.Forecast{}
+	if err := json.Unmarshal(payload.Forecast, forecast); err != nil {
+		return fmt.Errorf("failed to unmarshal forecast for %s: %w", payload.Location.Name, err)
+	}
+
+	// Store in DB, predictions go to their own table so they never mix with observations
+	if payload.Type == "forecast" {
+		if err := db.StoreForecastMetrics(forecast, payload.Location.Name, payload.Fields); err != nil {
+			return fmt.Errorf("failed to store forecast for %s: %w", payload.Location.Name, err)
+		}
+	} else {
+		isInitial := payload.Type == "historical"
+		if err := db.StoreMetrics(forecast, payload.Location.Name, payload.Fields, isInitial); err != nil {
+			return fmt.Errorf("failed to store metrics for %s: %w", payload.Location.Name, err)
 		}
 	}
 
-	log.Println("Store service stopped")
+	// Audit copy is best effort, the extracted metrics are already stored
+	if config.Get().Audit.StoreRawForecasts {
+		if err := db.StoreRawForecast(payload.Location.Name, payload.Type, payload.Forecast); err != nil {
+			log.Printf("Failed to store raw forecast: %v", err)
+		}
+	}
+
+	log.Printf("Stored %s data for %s (%.2f, %.2f)",
+		payload.Type, payload.Location.Name,
+		payload.Location.Latitude, payload.Location.Longitude)
+	return nil
 }
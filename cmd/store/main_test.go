@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ackCall records one XAck
+type ackCall struct {
+	stream, group string
+	ids           []string
+}
+
+type recordingAcker struct {
+	calls []ackCall
+}
+
+func (a *recordingAcker) XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd {
+	a.calls = append(a.calls, ackCall{stream: stream, group: group, ids: ids})
+	return redis.NewIntResult(int64(len(ids)), nil)
+}
+
+func testBatch(ids ...string) redis.XStream {
+	msg := redis.XStream{Stream: "weather:current"}
+	for _, id := range ids {
+		msg.Messages = append(msg.Messages, redis.XMessage{ID: id, Values: map[string]interface{}{"data": "{}"}})
+	}
+	return msg
+}
+
+func TestStoreBatchAcksOnlyStoredMessagesTogether(t *testing.T) {
+	acker := &recordingAcker{}
+	stored := storeBatch(context.Background(), acker, "store", testBatch("1-0", "2-0", "3-0", "4-0"), func(m redis.XMessage) error {
+		if m.ID == "2-0" {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+
+	if stored != 3 {
+		t.Errorf("stored = %d, want 3", stored)
+	}
+	want := []ackCall{{stream: "weather:current", group: "store", ids: []string{"1-0", "3-0", "4-0"}}}
+	if !reflect.DeepEqual(acker.calls, want) {
+		t.Errorf("acks = %+v, want one XAck of the stored IDs %+v", acker.calls, want)
+	}
+}
+
+func TestStoreBatchSkipsAckWhenNothingStored(t *testing.T) {
+	acker := &recordingAcker{}
+	stored := storeBatch(context.Background(), acker, "store", testBatch("1-0", "2-0"), func(redis.XMessage) error {
+		return errors.New("malformed")
+	})
+
+	if stored != 0 || len(acker.calls) != 0 {
+		t.Errorf("stored %d, acks %+v, want nothing stored or acked", stored, acker.calls)
+	}
+}
+
+func TestStoreBatchStopsOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	acker := &recordingAcker{}
+	stored := storeBatch(ctx, acker, "store", testBatch("1-0", "2-0", "3-0"), func(m redis.XMessage) error {
+		if m.ID == "1-0" {
+			cancel()
+		}
+		return nil
+	})
+
+	// The message stored before shutdown is still acked, the rest stay pending
+	if stored != 1 || len(acker.calls) != 1 || !reflect.DeepEqual(acker.calls[0].ids, []string{"1-0"}) {
+		t.Errorf("stored %d, acks %+v, want only 1-0", stored, acker.calls)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"preempt/internal/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// statusInterval is how often the consumer backlog is sampled
+const statusInterval = 15 * time.Second
+
+// consumerStatus is a snapshot of how far behind the store consumer is
+type consumerStatus struct {
+	Pending       int64     `json:"pending"`         // delivered but not yet acked
+	Unread        int64     `json:"unread"`          // in the stream but not yet delivered to the group
+	Backlog       int64     `json:"backlog"`         // pending + unread
+	RatePerSecond float64   `json:"rate_per_second"` // messages stored per second over the last interval
+	DrainSeconds  float64   `json:"drain_seconds"`   // backlog / rate, -1 when nothing is being processed
+	SampledAt     time.Time `json:"sampled_at"`
+}
+
+// statusTracker periodically samples the consumer group backlog and the processing rate
+type statusTracker struct {
+	redisClient *redis.Client
+	streams     []string
+	group       string
+
+	processed int64 // messages stored since the last sample, updated atomically
+
+	mu     sync.RWMutex
+	status consumerStatus
+}
+
+func newStatusTracker(redisClient *redis.Client, streams []string, group string) *statusTracker {
+	return &statusTracker{redisClient: redisClient, streams: streams, group: group}
+}
+
+// recordProcessed counts messages that were stored successfully
+func (t *statusTracker) recordProcessed(n int) {
+	atomic.AddInt64(&t.processed, int64(n))
+	metrics.StoreMessagesProcessed.Add(float64(n))
+}
+
+// run samples the backlog every statusInterval until ctx is cancelled
+func (t *statusTracker) run(ctx context.Context) {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.sample(ctx, statusInterval); err != nil {
+				log.Printf("Failed to sample consumer backlog: %v", err)
+			}
+		}
+	}
+}
+
+func (t *statusTracker) sample(ctx context.Context, interval time.Duration) error {
+	var pending, unread int64
+	for _, stream := range t.streams {
+		streamPending, streamUnread, err := t.streamBacklog(ctx, stream)
+		if err != nil {
+			return err
+		}
+		pending += streamPending
+		unread += streamUnread
+	}
+
+	status := consumerStatus{Pending: pending, Unread: unread, SampledAt: time.Now()}
+	status.Backlog = status.Pending + status.Unread
+
+	processed := atomic.SwapInt64(&t.processed, 0)
+	status.RatePerSecond = float64(processed) / interval.Seconds()
+	status.DrainSeconds = -1
+	if status.RatePerSecond > 0 {
+		status.DrainSeconds = float64(status.Backlog) / status.RatePerSecond
+	} else if status.Backlog == 0 {
+		status.DrainSeconds = 0
+	}
+
+	metrics.StoreConsumerBacklog.Set(float64(status.Backlog))
+
+	t.mu.Lock()
+	t.status = status
+	t.mu.Unlock()
+	return nil
+}
+
+// streamBacklog returns the group's pending and not yet delivered message counts on one stream
+func (t *statusTracker) streamBacklog(ctx context.Context, stream string) (pending, unread int64, err error) {
+	summary, err := t.redisClient.XPending(ctx, stream, t.group).Result()
+	if err != nil && err != redis.Nil {
+		return 0, 0, err
+	}
+	if summary != nil {
+		pending = summary.Count
+	}
+
+	groups, err := t.redisClient.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, g := range groups {
+		if g.Name != t.group {
+			continue
+		}
+		// Entries after the group's last delivered ID haven't been read by any consumer yet
+		entries, err := t.redisClient.XRange(ctx, stream, "("+g.LastDeliveredID, "+").Result()
+		if err != nil {
+			return 0, 0, err
+		}
+		unread = int64(len(entries))
+	}
+
+	return pending, unread, nil
+}
+
+// handleStatus reports the latest backlog sample as JSON
+func (t *statusTracker) handleStatus(w http.ResponseWriter, r *http.Request) {
+	t.mu.RLock()
+	status := t.status
+	t.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"preempt/internal/models"
+	"preempt/internal/retry"
+	"strings"
+)
+
+// maxBatchCoordinates keeps each batch URL well under common 8KB request line limits,
+// 100 coordinate pairs plus a full field list is about 3KB
+const maxBatchCoordinates = 100
+
+// Coordinate is one location in a batch request
+type Coordinate struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// GetForecastBatch fetches current weather for many coordinates, one request per 100 coordinates
+func (c *OpenMeteoClient) GetForecastBatch(coords []Coordinate, fields []string) ([]*models.Forecast, error) {
+	return c.GetForecastBatchWithContext(context.Background(), coords, fields)
+}
+
+// GetForecastBatchWithContext fetches current weather for many coordinates, giving up when ctx is done.
+// Forecasts are returned in the order of coords. Batches bypass the response cache, whose
+// entries are per location.
+func (c *OpenMeteoClient) GetForecastBatchWithContext(ctx context.Context, coords []Coordinate, fields []string) ([]*models.Forecast, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("GetForecastBatch: no weather fields provided")
+	}
+
+	currentFields, dailyFields := routeFields(fields, LevelCurrent)
+	params := ForecastParams{
+		CurrentFields: currentFields,
+		DailyFields:   dailyFields,
+		ForecastDays:  dailyWindow(dailyFields),
+	}
+
+	forecasts := make([]*models.Forecast, 0, len(coords))
+	for start := 0; start < len(coords); start += maxBatchCoordinates {
+		end := start + maxBatchCoordinates
+		if end > len(coords) {
+			end = len(coords)
+		}
+		chunk := coords[start:end]
+
+		var batch []*models.Forecast
+		err := retry.Do(ctx, c.retryPolicy, func() error {
+			var fetchErr error
+			batch, fetchErr = c.fetchBatch(ctx, chunk, params)
+			return fetchErr
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch coordinates %d-%d: %w", start, end-1, err)
+		}
+		forecasts = append(forecasts, batch...)
+	}
+
+	return forecasts, nil
+}
+
+// fetchBatch requests one chunk of coordinates. Open-Meteo answers a list of coordinates with an
+// array of forecasts but a single coordinate with a plain object, so both shapes are accepted.
+func (c *OpenMeteoClient) fetchBatch(ctx context.Context, coords []Coordinate, params ForecastParams) ([]*models.Forecast, error) {
+	latitudes := make([]string, len(coords))
+	longitudes := make([]string, len(coords))
+	for i, coord := range coords {
+		latitudes[i] = formatCoordinate(coord.Latitude)
+		longitudes[i] = formatCoordinate(coord.Longitude)
+	}
+	url := c.buildURL(strings.Join(latitudes, ","), strings.Join(longitudes, ","), params)
+
+	var raw json.RawMessage
+	if err := c.fetchJSON(ctx, url, &raw); err != nil {
+		return nil, err
+	}
+
+	var forecasts []*models.Forecast
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &forecasts); err != nil {
+			return nil, fmt.Errorf("failed to decode batch response: %w", err)
+		}
+	} else {
+		var forecast models.Forecast
+		if err := json.Unmarshal(trimmed, &forecast); err != nil {
+			return nil, fmt.Errorf("failed to decode batch response: %w", err)
+		}
+		forecasts = []*models.Forecast{&forecast}
+	}
+
+	if len(forecasts) != len(coords) {
+		return nil, fmt.Errorf("batch response has %d forecasts for %d coordinates", len(forecasts), len(coords))
+	}
+	return forecasts, nil
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"preempt/internal/models"
+	"sync"
+	"time"
+)
+
+// sharedFetchTimeout bounds a fetch shared by concurrent callers, which runs on its own context
+// rather than any one caller's. It covers every attempt of the default retry policy.
+const sharedFetchTimeout = 4 * requestTimeout
+
+// forecastCache keeps recent responses by request URL. BuildURL rounds coordinates and sorts
+// fields, so the URL already identifies the location, field set and mode of a request.
+// Concurrent misses for the same URL share one upstream request.
+type forecastCache struct {
+	mu            sync.Mutex
+	entries       map[string]cacheEntry
+	inflight      map[string]*inflightFetch
+	currentTTL    time.Duration
+	historicalTTL time.Duration
+	forecastTTL   time.Duration
+	now           func() time.Time
+}
+
+type cacheEntry struct {
+	forecast *models.Forecast
+	expires  time.Time
+}
+
+// inflightFetch is an upstream request other callers for the same URL wait on
+type inflightFetch struct {
+	done     chan struct{}
+	forecast *models.Forecast
+	err      error
+}
+
+// CacheTTLs is how long each kind of response is reused, zero disables caching for that kind
+type CacheTTLs struct {
+	Current    time.Duration // current readings, keep short
+	Historical time.Duration // past_days backfills, which change slowly
+	Forecast   time.Duration // hourly/daily predictions
+}
+
+// WithCache reuses identical responses within their TTL instead of calling the API again.
+// Every caller gets its own copy of a cached forecast, so callers may modify what they get.
+func WithCache(ttls CacheTTLs) ClientOption {
+	return func(c *OpenMeteoClient) {
+		c.cache = &forecastCache{
+			entries:       make(map[string]cacheEntry),
+			inflight:      make(map[string]*inflightFetch),
+			currentTTL:    ttls.Current,
+			historicalTTL: ttls.Historical,
+			forecastTTL:   ttls.Forecast,
+			now:           time.Now,
+		}
+	}
+}
+
+// ttl picks the lifetime of a response from the kind of request it answers
+func (fc *forecastCache) ttl(params ForecastParams) time.Duration {
+	switch {
+	case params.PastDays > 0:
+		return fc.historicalTTL
+	case len(params.CurrentFields) > 0:
+		return fc.currentTTL
+	default:
+		return fc.forecastTTL
+	}
+}
+
+// do returns a copy of the cached response for url, or calls fetch and caches its result for ttl.
+// Concurrent callers for url share one fetch, which runs detached from all of them with its own
+// timeout: any caller, including the first, stops waiting when its ctx is done without failing
+// the others, and a fetch nobody waits for anymore still fills the cache.
+func (fc *forecastCache) do(ctx context.Context, url string, ttl time.Duration, fetch func(context.Context) (*models.Forecast, error)) (*models.Forecast, error) {
+	if cached, ok := fc.get(url); ok {
+		return cloneForecast(cached), nil
+	}
+
+	fc.mu.Lock()
+	call, ok := fc.inflight[url]
+	if !ok {
+		call = &inflightFetch{done: make(chan struct{})}
+		fc.inflight[url] = call
+		go fc.fetch(url, ttl, call, fetch)
+	}
+	fc.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+	return cloneForecast(call.forecast), nil
+}
+
+// fetch runs a shared fetch for url and publishes its result to everyone waiting on call
+func (fc *forecastCache) fetch(url string, ttl time.Duration, call *inflightFetch, fetch func(context.Context) (*models.Forecast, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), sharedFetchTimeout)
+	defer cancel()
+
+	call.forecast, call.err = fetch(ctx)
+	if call.err == nil {
+		fc.put(url, call.forecast, ttl)
+	}
+
+	fc.mu.Lock()
+	delete(fc.inflight, url)
+	fc.mu.Unlock()
+	close(call.done)
+}
+
+// cloneForecast deep-copies a forecast, so callers can't modify the cached one through its
+// pointers and slices
+func cloneForecast(forecast *models.Forecast) *models.Forecast {
+	clone := *forecast
+
+	current := &clone.Current
+	current.Temperature2m = clonePointer(current.Temperature2m)
+	current.RelativeHumidity2m = clonePointer(current.RelativeHumidity2m)
+	current.Precipitation = clonePointer(current.Precipitation)
+	current.WeatherCode = clonePointer(current.WeatherCode)
+	current.WindSpeed10m = clonePointer(current.WindSpeed10m)
+	current.DewPoint2m = clonePointer(current.DewPoint2m)
+	current.ApparentTemperature = clonePointer(current.ApparentTemperature)
+	current.SurfacePressure = clonePointer(current.SurfacePressure)
+	current.CloudCover = clonePointer(current.CloudCover)
+
+	hourly := &clone.Hourly
+	hourly.Time = cloneSlice(hourly.Time)
+	hourly.Temperature2m = cloneSlice(hourly.Temperature2m)
+	hourly.RelativeHumidity2m = cloneSlice(hourly.RelativeHumidity2m)
+	hourly.Precipitation = cloneSlice(hourly.Precipitation)
+	hourly.DewPoint2m = cloneSlice(hourly.DewPoint2m)
+	hourly.WindSpeed10m = cloneSlice(hourly.WindSpeed10m)
+	hourly.ApparentTemperature = cloneSlice(hourly.ApparentTemperature)
+	hourly.SurfacePressure = cloneSlice(hourly.SurfacePressure)
+	hourly.CloudCover = cloneSlice(hourly.CloudCover)
+	hourly.WeatherCode = cloneSlice(hourly.WeatherCode)
+
+	daily := &clone.Daily
+	daily.Time = cloneSlice(daily.Time)
+	daily.WeatherCode = cloneSlice(daily.WeatherCode)
+	daily.Temperature2mMax = cloneSlice(daily.Temperature2mMax)
+	daily.Temperature2mMin = cloneSlice(daily.Temperature2mMin)
+	daily.PrecipitationSum = cloneSlice(daily.PrecipitationSum)
+	daily.WindSpeed10mMax = cloneSlice(daily.WindSpeed10mMax)
+
+	return &clone
+}
+
+func clonePointer[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+func cloneSlice[T any](s []T) []T {
+	if s == nil {
+		return nil
+	}
+	return append(make([]T, 0, len(s)), s...)
+}
+
+// get returns the cached response for url if it hasn't expired
+func (fc *forecastCache) get(url string) (*models.Forecast, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	entry, ok := fc.entries[url]
+	if !ok {
+		return nil, false
+	}
+	if !fc.now().Before(entry.expires) {
+		delete(fc.entries, url)
+		return nil, false
+	}
+	return entry.forecast, true
+}
+
+// put caches a response for ttl, dropping expired entries so the map doesn't grow without bound
+func (fc *forecastCache) put(url string, forecast *models.Forecast, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	now := fc.now()
+	for key, entry := range fc.entries {
+		if !now.Before(entry.expires) {
+			delete(fc.entries, key)
+		}
+	}
+	fc.entries[url] = cacheEntry{forecast: forecast, expires: now.Add(ttl)}
+}
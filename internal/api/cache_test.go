@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"preempt/internal/models"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestCache() *forecastCache {
+	return NewOpenMeteoClient(WithCache(CacheTTLs{Current: time.Minute})).cache
+}
+
+func testForecast() *models.Forecast {
+	temperature := 21.5
+	return &models.Forecast{
+		Latitude: 35.68,
+		Current:  models.Current{Temperature2m: &temperature},
+		Hourly:   models.Hourly{Time: []string{"2024-06-01T12:00"}, Temperature2m: []float64{21.5}},
+	}
+}
+
+func TestCacheSharesFetchAcrossCallers(t *testing.T) {
+	fc := newTestCache()
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (*models.Forecast, error) {
+		fetches.Add(1)
+		<-release
+		return testForecast(), nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := fc.do(context.Background(), "url", time.Minute, fetch)
+			errs <- err
+		}()
+	}
+	time.Sleep(20 * time.Millisecond) // let the callers line up behind the first fetch
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("caller failed: %v", err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("%d upstream fetches, want 1", n)
+	}
+}
+
+func TestCacheLeaderCancelDoesNotFailWaiters(t *testing.T) {
+	fc := newTestCache()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var fetchErr error
+	fetch := func(ctx context.Context) (*models.Forecast, error) {
+		close(started)
+		<-release
+		fetchErr = ctx.Err() // the shared fetch must outlive the caller that started it
+		return testForecast(), nil
+	}
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := fc.do(leaderCtx, "url", time.Minute, fetch)
+		leaderDone <- err
+	}()
+	<-started
+
+	waiterDone := make(chan error, 1)
+	go func() {
+		forecast, err := fc.do(context.Background(), "url", time.Minute, fetch)
+		if err == nil && forecast.Latitude != 35.68 {
+			err = errors.New("waiter got the wrong forecast")
+		}
+		waiterDone <- err
+	}()
+
+	cancelLeader()
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader error = %v, want its own cancellation", err)
+	}
+
+	close(release)
+	if err := <-waiterDone; err != nil {
+		t.Errorf("waiter failed after the leader was cancelled: %v", err)
+	}
+	if fetchErr != nil {
+		t.Errorf("shared fetch saw %v, want its context untouched by the leader", fetchErr)
+	}
+}
+
+func TestCacheReturnsIndependentCopies(t *testing.T) {
+	fc := newTestCache()
+	fetch := func(ctx context.Context) (*models.Forecast, error) { return testForecast(), nil }
+
+	first, err := fc.do(context.Background(), "url", time.Minute, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*first.Current.Temperature2m = -99
+	first.Hourly.Temperature2m[0] = -99
+	first.Hourly.Time[0] = "changed"
+
+	second, err := fc.do(context.Background(), "url", time.Minute, func(ctx context.Context) (*models.Forecast, error) {
+		t.Fatal("cached response fetched again")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *second.Current.Temperature2m != 21.5 || second.Hourly.Temperature2m[0] != 21.5 || second.Hourly.Time[0] != "2024-06-01T12:00" {
+		t.Errorf("cached forecast changed through a caller's copy: %+v", *second)
+	}
+}
+
+func TestClientReusesResponseWithinTTL(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"latitude":35.68,"longitude":139.69,"current":{"time":"2024-06-01T12:00","temperature_2m":21.5}}`)
+	}))
+	defer srv.Close()
+
+	client := NewOpenMeteoClient(WithBaseURL(srv.URL), WithCache(CacheTTLs{Current: time.Minute}))
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	client.cache.now = func() time.Time { return now }
+	fields := []string{"temperature_2m"}
+
+	for i := 0; i < 3; i++ {
+		forecast, err := client.GetCurrentWeatherWithContext(context.Background(), 35.68, 139.69, fields)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if forecast.Current.Temperature2m == nil || *forecast.Current.Temperature2m != 21.5 {
+			t.Fatalf("request %d: temperature = %v, want 21.5", i, forecast.Current.Temperature2m)
+		}
+		now = now.Add(20 * time.Second)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d upstream requests within the TTL, want 1", n)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := client.GetCurrentWeatherWithContext(context.Background(), 35.68, 139.69, fields); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d upstream requests after the TTL, want 2", n)
+	}
+}
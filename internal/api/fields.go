@@ -0,0 +1,82 @@
+package api
+
+import "strings"
+
+// Request sections a field can be asked for in
+const (
+	LevelCurrent = "current"
+	LevelHourly  = "hourly"
+	LevelDaily   = "daily"
+)
+
+// supportedFields lists the Open-Meteo fields Preempt knows about and which request sections accept them
+var supportedFields = map[string][]string{
+	"temperature_2m":       {LevelCurrent, LevelHourly},
+	"relative_humidity_2m": {LevelCurrent, LevelHourly},
+	"precipitation":        {LevelCurrent, LevelHourly},
+	"wind_speed_10m":       {LevelCurrent, LevelHourly},
+	"dew_point_2m":         {LevelCurrent, LevelHourly},
+	"apparent_temperature": {LevelCurrent, LevelHourly},
+	"surface_pressure":     {LevelCurrent, LevelHourly},
+	"cloud_cover":          {LevelCurrent, LevelHourly},
+	"weather_code":         {LevelCurrent, LevelHourly, LevelDaily},
+	"temperature_2m_max":   {LevelDaily},
+	"temperature_2m_min":   {LevelDaily},
+	"precipitation_sum":    {LevelDaily},
+	"wind_speed_10m_max":   {LevelDaily},
+}
+
+// NormalizeField returns the canonical form of a metric type: trimmed and lowercase
+func NormalizeField(field string) string {
+	return strings.ToLower(strings.TrimSpace(field))
+}
+
+// IsSupportedField reports whether the field is known to Preempt
+func IsSupportedField(field string) bool {
+	_, ok := supportedFields[field]
+	return ok
+}
+
+// SupportsLevel reports whether the field can be requested in the given section
+func SupportsLevel(field, level string) bool {
+	for _, l := range supportedFields[field] {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldsForLevel returns the fields that can be requested in the given section.
+// Unknown fields are kept so a misconfigured field still surfaces as an API error.
+func FieldsForLevel(fields []string, level string) []string {
+	var result []string
+	for _, field := range fields {
+		if !IsSupportedField(field) || SupportsLevel(field, level) {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+// routeFields splits fields into those valid at level and known fields that are only available
+// as daily aggregates, which have to go to the daily= parameter instead
+func routeFields(fields []string, level string) (levelFields, dailyFields []string) {
+	for _, field := range fields {
+		if IsSupportedField(field) && !SupportsLevel(field, level) && SupportsLevel(field, LevelDaily) {
+			dailyFields = append(dailyFields, field)
+			continue
+		}
+		levelFields = append(levelFields, field)
+	}
+	return levelFields, dailyFields
+}
+
+// dailyWindow is the forecast_days a current request needs: forecast_days=0 returns no daily
+// rows at all, so daily fields routed next to current ones ask for today's aggregate
+func dailyWindow(dailyFields []string) int {
+	if len(dailyFields) > 0 {
+		return 1
+	}
+	return 0
+}
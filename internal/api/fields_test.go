@@ -0,0 +1,49 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRouteFields(t *testing.T) {
+	tests := []struct {
+		name      string
+		fields    []string
+		level     string
+		wantLevel []string
+		wantDaily []string
+	}{
+		{
+			name:      "mixed current set",
+			fields:    []string{"temperature_2m", "precipitation_sum", "weather_code", "temperature_2m_max"},
+			level:     LevelCurrent,
+			wantLevel: []string{"temperature_2m", "weather_code"},
+			wantDaily: []string{"precipitation_sum", "temperature_2m_max"},
+		},
+		{
+			name:      "mixed hourly set",
+			fields:    []string{"wind_speed_10m_max", "surface_pressure"},
+			level:     LevelHourly,
+			wantLevel: []string{"surface_pressure"},
+			wantDaily: []string{"wind_speed_10m_max"},
+		},
+		{
+			name:      "unknown fields stay put for the API to reject",
+			fields:    []string{"snow_depth", "cloud_cover"},
+			level:     LevelCurrent,
+			wantLevel: []string{"snow_depth", "cloud_cover"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotLevel, gotDaily := routeFields(tt.fields, tt.level)
+			if !reflect.DeepEqual(gotLevel, tt.wantLevel) {
+				t.Errorf("%s fields = %v, want %v", tt.level, gotLevel, tt.wantLevel)
+			}
+			if !reflect.DeepEqual(gotDaily, tt.wantDaily) {
+				t.Errorf("daily fields = %v, want %v", gotDaily, tt.wantDaily)
+			}
+		})
+	}
+}
@@ -1,75 +1,201 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"preempt/internal/models"
+	"preempt/internal/retry"
+	"preempt/internal/version"
+	"sort"
 	"strings"
+	"time"
 )
 
-const baseURL = "https://api.open-meteo.com/v1/forecast"
+const (
+	baseURL        = "https://api.open-meteo.com/v1/forecast"
+	archiveBaseURL = "https://archive-api.open-meteo.com/v1/archive"
+
+	// requestTimeout bounds a single request, including reading the body, when the caller's context doesn't
+	requestTimeout = 60 * time.Second
+	// maxIdleConnsPerHost keeps connections to the API open across a concurrent collection run.
+	// The default of 2 closes most of them after each burst, and reopening exhausts ephemeral ports.
+	maxIdleConnsPerHost = 64
+)
 
 // OpenMeteoClient is a client for the Open-Meteo API
 type OpenMeteoClient struct {
-	client *http.Client
+	client      *http.Client
+	baseURL     string
+	archiveURL  string
+	retryPolicy retry.Policy
+	cache       *forecastCache // nil unless WithCache is used
+}
+
+// ClientOption customizes an OpenMeteoClient
+type ClientOption func(*OpenMeteoClient)
+
+// WithBaseURL points the client at a different forecast endpoint, e.g. an httptest server serving recorded responses
+func WithBaseURL(url string) ClientOption {
+	return func(c *OpenMeteoClient) {
+		c.baseURL = url
+	}
+}
+
+// WithArchiveBaseURL points the client at a different historical archive endpoint
+func WithArchiveBaseURL(url string) ClientOption {
+	return func(c *OpenMeteoClient) {
+		c.archiveURL = url
+	}
+}
+
+// WithHTTPClient replaces the underlying HTTP client, e.g. to inject a custom transport
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *OpenMeteoClient) {
+		c.client = client
+	}
+}
+
+// APIError is returned when Open-Meteo responds with a non-200 status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error: status %d, body: %s", e.StatusCode, e.Body)
 }
 
 type ForecastParams struct {
-	Latitude        float64
-	Longitude       float64
-	CurrentFields   []string
-	HourlyFields    []string
-	DailyFields     []string
-	Timezone        string
-	TemperatureUnit string
-	PastDays        int // how many days in the past you want to get
-	ForecastDays    int // how many days in the future you want to forecast
+	Latitude          float64
+	Longitude         float64
+	CurrentFields     []string
+	HourlyFields      []string
+	DailyFields       []string
+	Timezone          string
+	TemperatureUnit   string // "celsius" or "fahrenheit", default "fahrenheit"
+	WindSpeedUnit     string // "kmh", "ms", "mph" or "kn", default "mph"
+	PrecipitationUnit string // "mm" or "inch", default "inch"
+	PastDays          int    // how many days in the past you want to get
+	ForecastDays      int    // how many days in the future you want to forecast
 }
 
 // NewOpenMeteoClient creates a new Open-Meteo API client
-func NewOpenMeteoClient() *OpenMeteoClient {
-	return &OpenMeteoClient{
-		client: &http.Client{},
+func NewOpenMeteoClient(opts ...ClientOption) *OpenMeteoClient {
+	policy := retry.DefaultPolicy()
+	policy.Retryable = isRetryableError
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 2 * maxIdleConnsPerHost
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+
+	c := &OpenMeteoClient{
+		client:      &http.Client{Transport: transport, Timeout: requestTimeout},
+		baseURL:     baseURL,
+		archiveURL:  archiveBaseURL,
+		retryPolicy: policy,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// isRetryableError retries rate limits, server errors and transport failures, but not other 4xx responses
+func isRetryableError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
 	}
+	return true
 }
 
 // GetForecast fetches forecast data for the given coordinates, pull hourly on application initialization, otherwise just current metrics
 func (c *OpenMeteoClient) GetForecast(forecastParams ForecastParams) (*models.Forecast, error) {
+	return c.GetForecastWithContext(context.Background(), forecastParams)
+}
+
+// GetForecastWithContext is GetForecast with a context that cancels the request and any retries
+func (c *OpenMeteoClient) GetForecastWithContext(ctx context.Context, forecastParams ForecastParams) (*models.Forecast, error) {
 	url := c.BuildURL(forecastParams)
+	if c.cache == nil {
+		return c.fetchWithRetry(ctx, url)
+	}
+	return c.cache.do(ctx, url, c.cache.ttl(forecastParams), func(fetchCtx context.Context) (*models.Forecast, error) {
+		return c.fetchWithRetry(fetchCtx, url)
+	})
+}
 
-	resp, err := c.client.Get(url)
+// fetchWithRetry fetches url, retrying under the client's retry policy
+func (c *OpenMeteoClient) fetchWithRetry(ctx context.Context, url string) (*models.Forecast, error) {
+	var forecast *models.Forecast
+	err := retry.Do(ctx, c.retryPolicy, func() error {
+		var fetchErr error
+		forecast, fetchErr = c.fetch(ctx, url)
+		return fetchErr
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch forecast: %w", err)
+		return nil, err
+	}
+	return forecast, nil
+}
+
+// fetch performs a single request against the API and decodes the response
+func (c *OpenMeteoClient) fetch(ctx context.Context, url string) (*models.Forecast, error) {
+	var forecast models.Forecast
+	if err := c.fetchJSON(ctx, url, &forecast); err != nil {
+		return nil, err
+	}
+	return &forecast, nil
+}
+
+// fetchJSON performs a single request against the API and decodes the response into v
+func (c *OpenMeteoClient) fetchJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	// Open-Meteo asks clients to identify themselves
+	req.Header.Set("User-Agent", "preempt/"+version.Version)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch forecast: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: status %d, body: %s", resp.StatusCode, string(body))
+		return &APIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
-	var forecast models.Forecast
-	if err := json.NewDecoder(resp.Body).Decode(&forecast); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return &forecast, nil
+	return nil
 }
 
-// Builds URL for OpenMeteoClient request
+// Builds URL for OpenMeteoClient request. Sections always come in the order current, daily,
+// hourly and each section's fields are sorted, so the same logical request always produces a
+// byte-identical URL regardless of how the field slices were assembled.
 func (c *OpenMeteoClient) BuildURL(forecastParams ForecastParams) string {
-	if forecastParams.Timezone == "" {
-		forecastParams.Timezone = "auto"
-	}
+	return c.buildURL(formatCoordinate(forecastParams.Latitude), formatCoordinate(forecastParams.Longitude), forecastParams)
+}
 
-	if forecastParams.TemperatureUnit == "" {
-		forecastParams.TemperatureUnit = "fahrenheit"
-	}
+// buildURL builds a request for the given latitude and longitude query values, which are
+// comma-separated lists for batch requests. forecastParams' own coordinates are ignored.
+func (c *OpenMeteoClient) buildURL(latitudes, longitudes string, forecastParams ForecastParams) string {
+	forecastParams = withDefaults(forecastParams)
 
-	url := fmt.Sprintf("%s?latitude=%.4f&longitude=%.4f&timezone=%s&temperature_unit=%s",
-		baseURL, forecastParams.Latitude, forecastParams.Longitude, forecastParams.Timezone, forecastParams.TemperatureUnit)
+	url := fmt.Sprintf("%s?latitude=%s&longitude=%s&timezone=%s&temperature_unit=%s&wind_speed_unit=%s&precipitation_unit=%s",
+		c.baseURL, latitudes, longitudes, forecastParams.Timezone,
+		forecastParams.TemperatureUnit, forecastParams.WindSpeedUnit, forecastParams.PrecipitationUnit)
 
 	if forecastParams.PastDays > 0 {
 		url += fmt.Sprintf("&past_days=%d", forecastParams.PastDays)
@@ -80,57 +206,198 @@ func (c *OpenMeteoClient) BuildURL(forecastParams ForecastParams) string {
 	}
 
 	if len(forecastParams.CurrentFields) > 0 {
-		url += "&current=" + strings.Join(forecastParams.CurrentFields, ",")
+		url += "&current=" + joinSorted(forecastParams.CurrentFields)
 	}
 
 	if len(forecastParams.DailyFields) > 0 {
-		url += "&daily=" + strings.Join(forecastParams.DailyFields, ",")
+		url += "&daily=" + joinSorted(forecastParams.DailyFields)
 	}
 
 	if len(forecastParams.HourlyFields) > 0 {
-		url += "&hourly=" + strings.Join(forecastParams.HourlyFields, ",")
+		url += "&hourly=" + joinSorted(forecastParams.HourlyFields)
 	}
 
 	return url
 }
 
+// withDefaults fills in the timezone and the US customary units for anything left empty
+func withDefaults(forecastParams ForecastParams) ForecastParams {
+	if forecastParams.Timezone == "" {
+		forecastParams.Timezone = "auto"
+	}
+	if forecastParams.TemperatureUnit == "" {
+		forecastParams.TemperatureUnit = "fahrenheit"
+	}
+	if forecastParams.WindSpeedUnit == "" {
+		forecastParams.WindSpeedUnit = "mph"
+	}
+	if forecastParams.PrecipitationUnit == "" {
+		forecastParams.PrecipitationUnit = "inch"
+	}
+	return forecastParams
+}
+
+// formatCoordinate rounds a coordinate to 4 decimals (about 11m), well below the model grid
+func formatCoordinate(v float64) string {
+	return fmt.Sprintf("%.4f", v)
+}
+
+// joinSorted joins a sorted copy of fields, leaving the caller's slice untouched
+func joinSorted(fields []string) string {
+	sorted := append([]string(nil), fields...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
 func (c *OpenMeteoClient) GetCurrentWeather(lat, long float64, fields []string) (*models.Forecast, error) {
+	return c.GetCurrentWeatherWithContext(context.Background(), lat, long, fields)
+}
+
+// GetCurrentWeatherWithContext fetches current weather, giving up when ctx is done
+func (c *OpenMeteoClient) GetCurrentWeatherWithContext(ctx context.Context, lat, long float64, fields []string) (*models.Forecast, error) {
 	if len(fields) == 0 {
 		return nil, fmt.Errorf("GetCurrentWeather: no weather fields provided")
 	}
 
+	// Daily-only fields (e.g. precipitation_sum) would come back empty in current
+	currentFields, dailyFields := routeFields(fields, LevelCurrent)
+
 	forecastParams := ForecastParams{
 		Latitude:      lat,
 		Longitude:     long,
-		CurrentFields: fields,
+		CurrentFields: currentFields,
+		DailyFields:   dailyFields,
+		ForecastDays:  dailyWindow(dailyFields),
 	}
 
-	return c.GetForecast(forecastParams)
+	return c.GetForecastWithContext(ctx, forecastParams)
 }
 
 func (c *OpenMeteoClient) GetHistoricalHourlyData(lat, long float64, fields []string, pastDays int) (*models.Forecast, error) {
+	return c.GetHistoricalHourlyDataWithContext(context.Background(), lat, long, fields, pastDays)
+}
+
+// GetHistoricalHourlyDataWithContext fetches the past pastDays days of hourly data, giving up when ctx is done
+func (c *OpenMeteoClient) GetHistoricalHourlyDataWithContext(ctx context.Context, lat, long float64, fields []string, pastDays int) (*models.Forecast, error) {
 	if len(fields) == 0 {
 		return nil, fmt.Errorf("GetHistoricalHourlyData: no weather fields provided")
 	}
 
-	return c.GetForecast(ForecastParams{
+	hourlyFields, dailyFields := routeFields(fields, LevelHourly)
+
+	return c.GetForecastWithContext(ctx, ForecastParams{
 		Latitude:     lat,
 		Longitude:    long,
-		HourlyFields: fields,
+		HourlyFields: hourlyFields,
+		DailyFields:  dailyFields,
 		PastDays:     pastDays,
 		ForecastDays: 0,
 	})
 }
 
+// GetArchiveHourlyData fetches hourly data between start and end (inclusive dates) from the historical
+// archive, which reaches back decades where past_days on the forecast endpoint stops at about 92 days
+func (c *OpenMeteoClient) GetArchiveHourlyData(lat, long float64, fields []string, start, end time.Time) (*models.Forecast, error) {
+	return c.GetArchiveHourlyDataWithContext(context.Background(), lat, long, fields, start, end)
+}
+
+// GetArchiveHourlyDataWithContext is GetArchiveHourlyData, giving up when ctx is done
+func (c *OpenMeteoClient) GetArchiveHourlyDataWithContext(ctx context.Context, lat, long float64, fields []string, start, end time.Time) (*models.Forecast, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("GetArchiveHourlyData: no weather fields provided")
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("GetArchiveHourlyData: end %s is before start %s", end.Format(archiveDateLayout), start.Format(archiveDateLayout))
+	}
+
+	hourlyFields, dailyFields := routeFields(fields, LevelHourly)
+	url := c.BuildArchiveURL(ForecastParams{
+		Latitude:     lat,
+		Longitude:    long,
+		HourlyFields: hourlyFields,
+		DailyFields:  dailyFields,
+	}, start, end)
+
+	if c.cache == nil {
+		return c.fetchWithRetry(ctx, url)
+	}
+	return c.cache.do(ctx, url, c.cache.historicalTTL, func(fetchCtx context.Context) (*models.Forecast, error) {
+		return c.fetchWithRetry(fetchCtx, url)
+	})
+}
+
+// archiveDateLayout is the YYYY-MM-DD form the archive expects for start_date and end_date
+const archiveDateLayout = "2006-01-02"
+
+// BuildArchiveURL builds a historical archive request for forecastParams' coordinates, units and
+// fields between the dates of start and end. PastDays, ForecastDays and CurrentFields don't apply
+// to the archive and are ignored.
+func (c *OpenMeteoClient) BuildArchiveURL(forecastParams ForecastParams, start, end time.Time) string {
+	forecastParams = withDefaults(forecastParams)
+
+	url := fmt.Sprintf("%s?latitude=%s&longitude=%s&start_date=%s&end_date=%s&timezone=%s&temperature_unit=%s&wind_speed_unit=%s&precipitation_unit=%s",
+		c.archiveURL, formatCoordinate(forecastParams.Latitude), formatCoordinate(forecastParams.Longitude),
+		start.Format(archiveDateLayout), end.Format(archiveDateLayout), forecastParams.Timezone,
+		forecastParams.TemperatureUnit, forecastParams.WindSpeedUnit, forecastParams.PrecipitationUnit)
+
+	if len(forecastParams.DailyFields) > 0 {
+		url += "&daily=" + joinSorted(forecastParams.DailyFields)
+	}
+
+	if len(forecastParams.HourlyFields) > 0 {
+		url += "&hourly=" + joinSorted(forecastParams.HourlyFields)
+	}
+
+	return url
+}
+
+// GetHourlyForecast fetches hourly predictions for the next forecastDays days
+func (c *OpenMeteoClient) GetHourlyForecast(lat, long float64, fields []string, forecastDays int) (*models.Forecast, error) {
+	return c.GetHourlyForecastWithContext(context.Background(), lat, long, fields, forecastDays)
+}
+
+// GetHourlyForecastWithContext fetches hourly predictions, giving up when ctx is done
+func (c *OpenMeteoClient) GetHourlyForecastWithContext(ctx context.Context, lat, long float64, fields []string, forecastDays int) (*models.Forecast, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("GetHourlyForecast: no weather fields provided")
+	}
+
+	if forecastDays <= 0 {
+		return nil, fmt.Errorf("GetHourlyForecast: forecastDays must be positive, got %d", forecastDays)
+	}
+
+	return c.GetForecastWithContext(ctx, ForecastParams{
+		Latitude:     lat,
+		Longitude:    long,
+		HourlyFields: fields,
+		ForecastDays: forecastDays,
+	})
+}
+
 func (c *OpenMeteoClient) GetDailyForecast(lat, long float64, fields []string) (*models.Forecast, error) {
+	return c.GetDailyForecastWithUnits(lat, long, fields, Units{})
+}
+
+// Units selects the units of a response, empty fields keep the client defaults
+type Units struct {
+	Temperature   string // "celsius" or "fahrenheit"
+	WindSpeed     string // "kmh", "ms", "mph" or "kn"
+	Precipitation string // "mm" or "inch"
+}
+
+// GetDailyForecastWithUnits fetches daily aggregates in the requested units
+func (c *OpenMeteoClient) GetDailyForecastWithUnits(lat, long float64, fields []string, units Units) (*models.Forecast, error) {
 	if len(fields) == 0 {
 		return nil, fmt.Errorf("GetDailyWeather: no weather fields provided")
 	}
 
 	forecastParams := ForecastParams{
-		Latitude:    lat,
-		Longitude:   long,
-		DailyFields: fields,
+		Latitude:          lat,
+		Longitude:         long,
+		DailyFields:       fields,
+		TemperatureUnit:   units.Temperature,
+		WindSpeedUnit:     units.WindSpeed,
+		PrecipitationUnit: units.Precipitation,
 	}
 
 	return c.GetForecast(forecastParams)
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"preempt/internal/metrics"
+	"preempt/internal/models"
+)
+
+// WeatherProvider is a source of weather data the collector can fetch from. Each call gives up when ctx is done.
+type WeatherProvider interface {
+	GetCurrentWeatherWithContext(ctx context.Context, lat, long float64, fields []string) (*models.Forecast, error)
+	GetHistoricalHourlyDataWithContext(ctx context.Context, lat, long float64, fields []string, pastDays int) (*models.Forecast, error)
+	GetHourlyForecastWithContext(ctx context.Context, lat, long float64, fields []string, forecastDays int) (*models.Forecast, error)
+}
+
+var _ WeatherProvider = (*OpenMeteoClient)(nil)
+
+// NamedProvider labels a provider for logs and metrics
+type NamedProvider struct {
+	Name     string
+	Provider WeatherProvider
+}
+
+// FallbackProvider tries each provider in order and returns the first successful response
+type FallbackProvider struct {
+	providers []NamedProvider
+}
+
+// NewFallbackProvider creates a provider that fails over through providers in the given order
+func NewFallbackProvider(providers ...NamedProvider) *FallbackProvider {
+	return &FallbackProvider{providers: providers}
+}
+
+// GetCurrentWeatherWithContext fetches current weather from the first provider that succeeds
+func (f *FallbackProvider) GetCurrentWeatherWithContext(ctx context.Context, lat, long float64, fields []string) (*models.Forecast, error) {
+	return f.try(ctx, func(p WeatherProvider) (*models.Forecast, error) {
+		return p.GetCurrentWeatherWithContext(ctx, lat, long, fields)
+	})
+}
+
+// GetHistoricalHourlyDataWithContext fetches past hourly data from the first provider that succeeds
+func (f *FallbackProvider) GetHistoricalHourlyDataWithContext(ctx context.Context, lat, long float64, fields []string, pastDays int) (*models.Forecast, error) {
+	return f.try(ctx, func(p WeatherProvider) (*models.Forecast, error) {
+		return p.GetHistoricalHourlyDataWithContext(ctx, lat, long, fields, pastDays)
+	})
+}
+
+// GetHourlyForecastWithContext fetches upcoming hourly data from the first provider that succeeds
+func (f *FallbackProvider) GetHourlyForecastWithContext(ctx context.Context, lat, long float64, fields []string, forecastDays int) (*models.Forecast, error) {
+	return f.try(ctx, func(p WeatherProvider) (*models.Forecast, error) {
+		return p.GetHourlyForecastWithContext(ctx, lat, long, fields, forecastDays)
+	})
+}
+
+// try runs fetch against each provider in turn. Earlier failures are logged, the last one is returned.
+// Once ctx is done the remaining providers aren't tried, they would only fail the same way.
+func (f *FallbackProvider) try(ctx context.Context, fetch func(WeatherProvider) (*models.Forecast, error)) (*models.Forecast, error) {
+	if len(f.providers) == 0 {
+		return nil, fmt.Errorf("no weather providers configured")
+	}
+
+	var lastErr error
+	for i, p := range f.providers {
+		forecast, err := fetch(p.Provider)
+		metrics.RecordProviderRequest(p.Name, err)
+		if err == nil {
+			return forecast, nil
+		}
+
+		lastErr = fmt.Errorf("%s: %w", p.Name, err)
+		if ctx.Err() != nil {
+			break
+		}
+		if i < len(f.providers)-1 {
+			log.Printf("Provider %s failed, falling back to %s: %v", p.Name, f.providers[i+1].Name, err)
+		}
+	}
+
+	return nil, fmt.Errorf("all %d weather providers failed, last error: %w", len(f.providers), lastErr)
+}
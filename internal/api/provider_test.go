@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"preempt/internal/metrics"
+	"preempt/internal/models"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// stubProvider answers every request with forecast or err and counts the calls
+type stubProvider struct {
+	forecast *models.Forecast
+	err      error
+	calls    int
+}
+
+func (p *stubProvider) GetCurrentWeatherWithContext(ctx context.Context, lat, long float64, fields []string) (*models.Forecast, error) {
+	p.calls++
+	return p.forecast, p.err
+}
+
+func (p *stubProvider) GetHistoricalHourlyDataWithContext(ctx context.Context, lat, long float64, fields []string, pastDays int) (*models.Forecast, error) {
+	p.calls++
+	return p.forecast, p.err
+}
+
+func (p *stubProvider) GetHourlyForecastWithContext(ctx context.Context, lat, long float64, fields []string, forecastDays int) (*models.Forecast, error) {
+	p.calls++
+	return p.forecast, p.err
+}
+
+// providerRequests reads the provider request counter for one provider and outcome
+func providerRequests(t *testing.T, provider, status string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := metrics.ProviderRequestsTotal.WithLabelValues(provider, status).Write(&m); err != nil {
+		t.Fatalf("read counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestFallbackProviderUsesSecondaryWhenPrimaryFails(t *testing.T) {
+	primary := &stubProvider{err: errors.New("status 503")}
+	secondary := &stubProvider{forecast: &models.Forecast{Timezone: "Asia/Tokyo"}}
+	f := NewFallbackProvider(NamedProvider{"primary-test", primary}, NamedProvider{"secondary-test", secondary})
+
+	primaryErrors := providerRequests(t, "primary-test", "error")
+	secondarySuccesses := providerRequests(t, "secondary-test", "success")
+
+	forecast, err := f.GetCurrentWeatherWithContext(context.Background(), 35.68, 139.69, []string{"temperature_2m"})
+	if err != nil {
+		t.Fatalf("GetCurrentWeatherWithContext: %v", err)
+	}
+	if forecast != secondary.forecast {
+		t.Errorf("forecast = %+v, want the secondary's", forecast)
+	}
+	if primary.calls != 1 || secondary.calls != 1 {
+		t.Errorf("calls = %d primary, %d secondary, want 1 each", primary.calls, secondary.calls)
+	}
+	if got := providerRequests(t, "primary-test", "error"); got != primaryErrors+1 {
+		t.Errorf("primary error count rose by %v, want 1", got-primaryErrors)
+	}
+	if got := providerRequests(t, "secondary-test", "success"); got != secondarySuccesses+1 {
+		t.Errorf("secondary success count rose by %v, want 1", got-secondarySuccesses)
+	}
+}
+
+func TestFallbackProviderStopsAtFirstSuccess(t *testing.T) {
+	primary := &stubProvider{forecast: &models.Forecast{}}
+	secondary := &stubProvider{forecast: &models.Forecast{}}
+	f := NewFallbackProvider(NamedProvider{"primary", primary}, NamedProvider{"secondary", secondary})
+
+	if _, err := f.GetHistoricalHourlyDataWithContext(context.Background(), 35.68, 139.69, []string{"temperature_2m"}, 7); err != nil {
+		t.Fatalf("GetHistoricalHourlyDataWithContext: %v", err)
+	}
+	if secondary.calls != 0 {
+		t.Errorf("secondary called %d times behind a healthy primary", secondary.calls)
+	}
+}
+
+func TestFallbackProviderReportsLastFailure(t *testing.T) {
+	primary := &stubProvider{err: errors.New("status 503")}
+	secondary := &stubProvider{err: errors.New("connection refused")}
+	f := NewFallbackProvider(NamedProvider{"primary", primary}, NamedProvider{"secondary", secondary})
+
+	_, err := f.GetHourlyForecastWithContext(context.Background(), 35.68, 139.69, []string{"temperature_2m"}, 3)
+	if err == nil || !strings.Contains(err.Error(), "all 2 weather providers failed") || !strings.Contains(err.Error(), "secondary: connection refused") {
+		t.Errorf("error = %v, want both providers failed ending with the secondary's error", err)
+	}
+
+	// Once ctx is done the secondary isn't tried
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	secondary.calls = 0
+	if _, err := f.GetCurrentWeatherWithContext(ctx, 35.68, 139.69, []string{"temperature_2m"}); err == nil {
+		t.Error("expected an error from a cancelled fetch")
+	}
+	if secondary.calls != 0 {
+		t.Errorf("secondary called %d times after ctx was done", secondary.calls)
+	}
+}
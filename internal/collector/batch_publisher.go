@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Flusher is implemented by publishers that buffer messages. The collector flushes them
+// once a run is done so nothing is left queued when the process exits.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// FailedMessage is a message a pipelined flush could not add to its stream
+type FailedMessage struct {
+	Stream string
+	Msg    Message
+	Err    error
+}
+
+// PublishError lists the messages of a flush that failed, the rest of the batch was published
+type PublishError struct {
+	Failed []FailedMessage
+	Total  int
+}
+
+func (e *PublishError) Error() string {
+	names := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		names[i] = fmt.Sprintf("%s/%s", f.Msg.Type, f.Msg.Location.Name)
+	}
+	return fmt.Sprintf("%d of %d messages failed to publish (%s): %v",
+		len(e.Failed), e.Total, strings.Join(names, ", "), e.Failed[0].Err)
+}
+
+type queuedMessage struct {
+	stream string
+	msg    Message
+	data   string
+}
+
+// BatchRedisPublisher queues messages and adds them to Redis in a single pipeline once
+// batchSize are queued or flushInterval has passed since the first one, whichever comes first
+type BatchRedisPublisher struct {
+	client        *redis.Client
+	batchSize     int
+	flushInterval time.Duration
+
+	mu      sync.Mutex
+	pending []queuedMessage
+	timer   *time.Timer
+}
+
+// NewBatchRedisPublisher creates a pipelining publisher writing through client
+func NewBatchRedisPublisher(client *redis.Client, batchSize int, flushInterval time.Duration) *BatchRedisPublisher {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &BatchRedisPublisher{
+		client:        client,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+	}
+}
+
+// Publish queues the message, flushing the batch when it is full. An error covers every
+// message of that batch that failed, not only this one.
+func (p *BatchRedisPublisher) Publish(ctx context.Context, streamKey string, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to serialize data: %w", err)
+	}
+
+	p.mu.Lock()
+	p.pending = append(p.pending, queuedMessage{stream: streamKey, msg: msg, data: string(data)})
+	full := len(p.pending) >= p.batchSize
+	if !full && p.timer == nil {
+		p.timer = time.AfterFunc(p.flushInterval, func() {
+			if err := p.Flush(context.Background()); err != nil {
+				log.Printf("Timed publish flush failed: %v", err)
+			}
+		})
+	}
+	p.mu.Unlock()
+
+	if full {
+		return p.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush sends every queued message in one pipeline and reports the ones that failed
+func (p *BatchRedisPublisher) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	batch := p.pending
+	p.pending = nil
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	p.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	cmds, err := p.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, q := range batch {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: q.stream,
+				Values: map[string]interface{}{"data": q.data},
+			})
+		}
+		return nil
+	})
+
+	// Pipelined returns the first command error, the per-command results say which ones it was
+	publishErr := &PublishError{Total: len(batch)}
+	for i, q := range batch {
+		var cmdErr error
+		if i < len(cmds) {
+			cmdErr = cmds[i].Err()
+		} else {
+			cmdErr = err
+		}
+		if cmdErr != nil {
+			publishErr.Failed = append(publishErr.Failed, FailedMessage{Stream: q.stream, Msg: q.msg, Err: cmdErr})
+		}
+	}
+	if len(publishErr.Failed) > 0 {
+		return publishErr
+	}
+
+	return nil
+}
+
+var _ StreamPublisher = (*BatchRedisPublisher)(nil)
+var _ Flusher = (*BatchRedisPublisher)(nil)
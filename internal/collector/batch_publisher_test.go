@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// errNotSent stops a pipeline before it reaches the network, the test has no Redis server
+var errNotSent = errors.New("pipeline intercepted")
+
+// pipelineRecorder is a client hook that records every pipeline instead of sending it. Commands
+// at the indexes in fail keep an error, the others are marked as having succeeded.
+type pipelineRecorder struct {
+	fail map[int]bool
+
+	mu        sync.Mutex
+	pipelines [][]string // the stream of each XADD, per pipeline
+}
+
+func (h *pipelineRecorder) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *pipelineRecorder) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (h *pipelineRecorder) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	var streams []string
+	for _, cmd := range cmds {
+		if cmd.Name() == "xadd" {
+			streams = append(streams, cmd.Args()[1].(string))
+		}
+	}
+	h.mu.Lock()
+	h.pipelines = append(h.pipelines, streams)
+	h.mu.Unlock()
+	return ctx, errNotSent
+}
+
+func (h *pipelineRecorder) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for i, cmd := range cmds {
+		if !h.fail[i] {
+			cmd.SetErr(nil)
+		}
+	}
+	return nil
+}
+
+func (h *pipelineRecorder) recorded() [][]string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([][]string(nil), h.pipelines...)
+}
+
+// newRecordedPublisher returns a publisher whose pipelines are captured by the returned recorder
+func newRecordedPublisher(t *testing.T, batchSize int, flushInterval time.Duration, fail map[int]bool) (*BatchRedisPublisher, *pipelineRecorder) {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	t.Cleanup(func() { client.Close() })
+	recorder := &pipelineRecorder{fail: fail}
+	client.AddHook(recorder)
+	return NewBatchRedisPublisher(client, batchSize, flushInterval), recorder
+}
+
+func TestBatchPublisherFlushesFullBatchInOnePipeline(t *testing.T) {
+	publisher, recorder := newRecordedPublisher(t, 3, time.Hour, nil)
+	ctx := context.Background()
+
+	for i, loc := range testLocations(3) {
+		if err := publisher.Publish(ctx, "weather", newMessage(nil, loc, nil, "current")); err != nil {
+			t.Fatalf("Publish %d: %v", i, err)
+		}
+		if got := len(recorder.recorded()); i < 2 && got != 0 {
+			t.Fatalf("%d pipelines sent after %d of 3 messages, want the batch held", got, i+1)
+		}
+	}
+
+	pipelines := recorder.recorded()
+	if len(pipelines) != 1 || len(pipelines[0]) != 3 {
+		t.Fatalf("pipelines = %v, want one pipeline of 3 XADDs", pipelines)
+	}
+	for _, stream := range pipelines[0] {
+		if stream != "weather" {
+			t.Errorf("XADD to %q, want weather", stream)
+		}
+	}
+
+	// Nothing is left queued
+	if err := publisher.Flush(ctx); err != nil {
+		t.Errorf("Flush: %v", err)
+	}
+	if got := len(recorder.recorded()); got != 1 {
+		t.Errorf("an empty flush sent a pipeline, %d in total", got)
+	}
+}
+
+func TestBatchPublisherReportsPartialFailure(t *testing.T) {
+	publisher, _ := newRecordedPublisher(t, 3, time.Hour, map[int]bool{1: true})
+	ctx := context.Background()
+
+	locations := testLocations(3)
+	var err error
+	for _, loc := range locations {
+		err = publisher.Publish(ctx, "weather", newMessage(nil, loc, nil, "current"))
+	}
+
+	var publishErr *PublishError
+	if !errors.As(err, &publishErr) {
+		t.Fatalf("error = %v, want a *PublishError from the full batch", err)
+	}
+	if publishErr.Total != 3 || len(publishErr.Failed) != 1 {
+		t.Fatalf("%d of %d failed, want 1 of 3", len(publishErr.Failed), publishErr.Total)
+	}
+	if failed := publishErr.Failed[0]; failed.Msg.Location.Name != locations[1].Name || failed.Stream != "weather" {
+		t.Errorf("failed message = %s on %s, want %s", failed.Msg.Location.Name, failed.Stream, locations[1].Name)
+	}
+}
+
+func TestBatchPublisherFlushesPartialBatchOnTimer(t *testing.T) {
+	publisher, recorder := newRecordedPublisher(t, 10, 20*time.Millisecond, nil)
+
+	for _, loc := range testLocations(2) {
+		if err := publisher.Publish(context.Background(), "weather", newMessage(nil, loc, nil, "current")); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(recorder.recorded()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if pipelines := recorder.recorded(); len(pipelines) != 1 || len(pipelines[0]) != 2 {
+		t.Errorf("pipelines = %v, want the 2 queued messages in one timed flush", pipelines)
+	}
+}
@@ -0,0 +1,320 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"preempt/internal/api"
+	"preempt/internal/database"
+	"preempt/internal/models"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	historicalDays = 7
+	fetchTimeout   = 30 * time.Second // per provider call, so a hung upstream connection can't stall a worker
+	defaultStream  = "weather_metrics"
+)
+
+// Store is the subset of the database the collector reads to decide what to fetch
+type Store interface {
+	GetAllLocations() ([]database.Location, error)
+	GetLocationsWithData() (map[string]bool, error)
+	GetForecastFetchTimes() (map[string]time.Time, error)
+}
+
+// Config holds the collection settings taken from the application config
+type Config struct {
+	Fields          []string
+	MaxConcurrent   int // concurrent API requests across locations
+	ForecastEnabled bool
+	ForecastDays    int
+	ForecastRefresh time.Duration
+	// BackfillSpread staggers historical backfills of new locations evenly over this window
+	// so onboarding many at once doesn't hit the API and DB together. Current readings
+	// are never delayed. 0 starts every backfill immediately.
+	BackfillSpread time.Duration
+	// LocationTimeout bounds one location's fetches, retries and publishing, 0 is no limit
+	LocationTimeout time.Duration
+	// RunTimeout is the deadline of a whole CollectAll, so a slow API can't overrun the next
+	// scheduled run. Locations not collected by then are left for it. 0 is no limit.
+	RunTimeout time.Duration
+	// StreamFor returns the stream a data type is published to, everything goes to
+	// defaultStream when unset
+	StreamFor func(dataType string) string
+}
+
+// Collector fetches weather data for locations and publishes it for storage
+type Collector struct {
+	provider  api.WeatherProvider
+	store     Store
+	publisher StreamPublisher
+	cfg       Config
+
+	now func() time.Time
+}
+
+// New creates a collector
+func New(provider api.WeatherProvider, store Store, publisher StreamPublisher, cfg Config) *Collector {
+	if cfg.MaxConcurrent < 1 {
+		cfg.MaxConcurrent = 1
+	}
+	if cfg.StreamFor == nil {
+		cfg.StreamFor = func(string) string { return defaultStream }
+	}
+	return &Collector{
+		provider:  provider,
+		store:     store,
+		publisher: publisher,
+		cfg:       cfg,
+		now:       time.Now,
+	}
+}
+
+// fetchPlan describes which request a location needs on this run
+type fetchPlan struct {
+	dataType string // "historical" or "current"
+	level    string // field level the published fields are filtered to
+}
+
+// decideFetch picks a historical backfill for locations without data and a current reading otherwise
+func decideFetch(loc database.Location, hasData bool) fetchPlan {
+	if !hasData {
+		return fetchPlan{dataType: "historical", level: api.LevelHourly}
+	}
+	return fetchPlan{dataType: "current", level: api.LevelCurrent}
+}
+
+// locationState is what the store knows about locations before a run
+type locationState struct {
+	withData        map[string]bool
+	forecastFetches map[string]time.Time
+}
+
+func (c *Collector) loadState() (*locationState, error) {
+	withData, err := c.store.GetLocationsWithData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get locations with data: %w", err)
+	}
+
+	state := &locationState{withData: withData}
+
+	// Get when each location's forecast was last refreshed so we only re-fetch stale ones
+	if c.cfg.ForecastEnabled {
+		state.forecastFetches, err = c.store.GetForecastFetchTimes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get forecast fetch times: %w", err)
+		}
+	}
+
+	return state, nil
+}
+
+// CollectAll collects every stored location with at most MaxConcurrent requests in flight.
+// Per-location failures are logged and don't stop the run. An empty locations table is
+// logged and treated as a successful no-op. Reaching RunTimeout is an error, after whatever
+// was collected by then has been flushed.
+func (c *Collector) CollectAll(ctx context.Context) error {
+	if c.cfg.RunTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.RunTimeout)
+		defer cancel()
+	}
+
+	locations, err := c.store.GetAllLocations()
+	if err != nil {
+		return fmt.Errorf("failed to get locations from database: %w", err)
+	}
+	if len(locations) == 0 {
+		log.Println(database.NoLocationsMessage)
+		return nil
+	}
+	log.Printf("Found %d locations in database", len(locations))
+
+	state, err := c.loadState()
+	if err != nil {
+		return err
+	}
+
+	delays := c.backfillDelays(locations, state)
+
+	// Semaphore to limit concurrent API requests
+	semaphore := make(chan struct{}, c.cfg.MaxConcurrent)
+	var wg sync.WaitGroup
+	var skipped atomic.Int64 // locations the deadline reached before they started
+
+	for _, location := range locations {
+		wg.Add(1)
+		go func(loc database.Location) {
+			defer wg.Done()
+
+			// Wait outside the semaphore so a delayed backfill doesn't hold up current readings
+			if delay := delays[loc.Name]; delay > 0 {
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					skipped.Add(1)
+					return
+				}
+			}
+
+			// Acquire semaphore (blocks if max concurrent requests reached)
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				skipped.Add(1)
+				return
+			}
+			if ctx.Err() != nil {
+				skipped.Add(1)
+				return
+			}
+
+			locCtx, cancel := c.locationContext(ctx)
+			defer cancel()
+			if err := c.collect(locCtx, loc, state); err != nil {
+				log.Printf("%v", err)
+			}
+		}(location)
+	}
+
+	wg.Wait()
+
+	// Data collected before the deadline is still published, so the flush gets its own time.
+	// Per-message failures are logged like the other per-location ones.
+	flushCtx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	if err := c.flush(flushCtx); err != nil {
+		log.Printf("%v", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("collection run stopped with %d of %d locations not started: %w", skipped.Load(), len(locations), err)
+	}
+	return nil
+}
+
+// locationContext bounds a single location's collection by LocationTimeout
+func (c *Collector) locationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.cfg.LocationTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.cfg.LocationTimeout)
+}
+
+// backfillDelays spaces the historical backfills of a run evenly across BackfillSpread,
+// the first starting immediately. Locations needing a current reading get no delay.
+func (c *Collector) backfillDelays(locations []database.Location, state *locationState) map[string]time.Duration {
+	delays := make(map[string]time.Duration)
+	if c.cfg.BackfillSpread <= 0 {
+		return delays
+	}
+
+	var backfills []string
+	for _, loc := range locations {
+		if decideFetch(loc, state.withData[loc.Name]).dataType == "historical" {
+			backfills = append(backfills, loc.Name)
+		}
+	}
+	if len(backfills) < 2 {
+		return delays
+	}
+
+	step := c.cfg.BackfillSpread / time.Duration(len(backfills))
+	for i, name := range backfills {
+		delays[name] = step * time.Duration(i)
+	}
+	log.Printf("Spreading %d historical backfills over %s", len(backfills), c.cfg.BackfillSpread)
+	return delays
+}
+
+// CollectLocation collects a single location within LocationTimeout
+func (c *Collector) CollectLocation(ctx context.Context, loc database.Location) error {
+	state, err := c.loadState()
+	if err != nil {
+		return err
+	}
+	locCtx, cancel := c.locationContext(ctx)
+	defer cancel()
+	if err := c.collect(locCtx, loc, state); err != nil {
+		return err
+	}
+	return c.flush(ctx)
+}
+
+// flush publishes anything a buffering publisher still holds
+func (c *Collector) flush(ctx context.Context) error {
+	flusher, ok := c.publisher.(Flusher)
+	if !ok {
+		return nil
+	}
+	if err := flusher.Flush(ctx); err != nil {
+		return fmt.Errorf("failed to flush published data: %w", err)
+	}
+	return nil
+}
+
+// collect fetches and publishes data for a single location. Rate limits and server errors are
+// retried by the provider, so a failure here is final for this run.
+func (c *Collector) collect(ctx context.Context, loc database.Location, state *locationState) error {
+	plan := decideFetch(loc, state.withData[loc.Name])
+	if plan.dataType == "historical" {
+		log.Printf("New location detected: %s - Fetching historical data", loc.Name)
+	} else {
+		log.Printf("Fetching current weather data for: %s", loc.Name)
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	var forecast *models.Forecast
+	var err error
+	if plan.dataType == "historical" {
+		forecast, err = c.provider.GetHistoricalHourlyDataWithContext(fetchCtx, loc.Latitude, loc.Longitude, c.cfg.Fields, historicalDays)
+	} else {
+		forecast, err = c.provider.GetCurrentWeatherWithContext(fetchCtx, loc.Latitude, loc.Longitude, c.cfg.Fields)
+	}
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to fetch data for %s: %w", loc.Name, err)
+	}
+
+	if err := c.publish(ctx, forecast, loc, api.FieldsForLevel(c.cfg.Fields, plan.level), plan.dataType); err != nil {
+		return fmt.Errorf("failed to publish %s data for %s: %w", plan.dataType, loc.Name, err)
+	}
+	if c.cfg.ForecastEnabled && c.now().Sub(state.forecastFetches[loc.Name]) >= c.cfg.ForecastRefresh {
+		c.collectForecast(ctx, loc)
+	}
+	return nil
+}
+
+// collectForecast fetches upcoming hourly predictions for a location and publishes them for storage
+func (c *Collector) collectForecast(ctx context.Context, loc database.Location) {
+	log.Printf("Fetching %d day forecast for: %s", c.cfg.ForecastDays, loc.Name)
+	fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	forecast, err := c.provider.GetHourlyForecastWithContext(fetchCtx, loc.Latitude, loc.Longitude, c.cfg.Fields, c.cfg.ForecastDays)
+	if err != nil {
+		log.Printf("Failed to fetch forecast for %s: %v", loc.Name, err)
+		return
+	}
+	if err := c.publish(ctx, forecast, loc, c.cfg.Fields, "forecast"); err != nil {
+		log.Printf("Failed to publish forecast for %s: %v", loc.Name, err)
+	}
+}
+
+// publish sends fetched data to the stream configured for its data type
+func (c *Collector) publish(ctx context.Context, payload interface{}, loc database.Location, fields []string, dataType string) error {
+	stream := c.cfg.StreamFor(dataType)
+	if err := c.publisher.Publish(ctx, stream, newMessage(payload, loc, fields, dataType)); err != nil {
+		return err
+	}
+
+	log.Printf("Published %s data for %s to %s", dataType, loc.Name, stream)
+	return nil
+}
+
+var _ Store = (*database.DB)(nil)
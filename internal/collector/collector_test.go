@@ -0,0 +1,284 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"preempt/internal/api"
+	"preempt/internal/database"
+	"preempt/internal/models"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubStore reports every location as already having data, so each run fetches current readings,
+// except those named in fresh, which have none yet and get a historical backfill
+type stubStore struct {
+	locations []database.Location
+	fresh     map[string]bool
+}
+
+func (s stubStore) GetAllLocations() ([]database.Location, error) { return s.locations, nil }
+
+func (s stubStore) GetLocationsWithData() (map[string]bool, error) {
+	withData := make(map[string]bool)
+	for _, loc := range s.locations {
+		withData[loc.Name] = !s.fresh[loc.Name]
+	}
+	return withData, nil
+}
+
+func (s stubStore) GetForecastFetchTimes() (map[string]time.Time, error) { return nil, nil }
+
+// blockingProvider answers at once except for locations at a blocked latitude, where it waits
+// for the request's context like a hung upstream connection
+type blockingProvider struct {
+	blocked map[float64]bool
+}
+
+func (p blockingProvider) GetCurrentWeatherWithContext(ctx context.Context, lat, long float64, fields []string) (*models.Forecast, error) {
+	if p.blocked[lat] {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &models.Forecast{Latitude: lat, Longitude: long}, nil
+}
+
+func (p blockingProvider) GetHistoricalHourlyDataWithContext(ctx context.Context, lat, long float64, fields []string, pastDays int) (*models.Forecast, error) {
+	return p.GetCurrentWeatherWithContext(ctx, lat, long, fields)
+}
+
+func (p blockingProvider) GetHourlyForecastWithContext(ctx context.Context, lat, long float64, fields []string, forecastDays int) (*models.Forecast, error) {
+	return p.GetCurrentWeatherWithContext(ctx, lat, long, fields)
+}
+
+func testLocations(n int) []database.Location {
+	locations := make([]database.Location, n)
+	for i := range locations {
+		locations[i] = database.Location{Name: fmt.Sprintf("loc-%d", i), Latitude: float64(i), Longitude: 10}
+	}
+	return locations
+}
+
+// collectWithin runs CollectAll, failing the test if it doesn't return within limit
+func collectWithin(t *testing.T, c *Collector, limit time.Duration) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- c.CollectAll(context.Background()) }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(limit):
+		t.Fatalf("CollectAll still running after %s", limit)
+		return nil
+	}
+}
+
+func TestCollectAllStopsAtRunDeadline(t *testing.T) {
+	locations := testLocations(6)
+	blocked := make(map[float64]bool)
+	for _, loc := range locations {
+		blocked[loc.Latitude] = true
+	}
+	publisher := NewMemoryPublisher()
+	c := New(blockingProvider{blocked: blocked}, stubStore{locations: locations}, publisher, Config{
+		Fields:        []string{"temperature_2m"},
+		MaxConcurrent: 2,
+		RunTimeout:    100 * time.Millisecond,
+	})
+
+	err := collectWithin(t, c, 2*time.Second)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CollectAll error = %v, want the run deadline", err)
+	}
+	if got := len(publisher.Messages(defaultStream)); got != 0 {
+		t.Errorf("published %d messages from blocked locations, want 0", got)
+	}
+}
+
+func TestCollectAllAbandonsSlowLocation(t *testing.T) {
+	locations := testLocations(4)
+	publisher := NewMemoryPublisher()
+	c := New(blockingProvider{blocked: map[float64]bool{locations[0].Latitude: true}}, stubStore{locations: locations}, publisher, Config{
+		Fields:          []string{"temperature_2m"},
+		MaxConcurrent:   1,
+		LocationTimeout: 50 * time.Millisecond,
+		RunTimeout:      5 * time.Second,
+	})
+
+	if err := collectWithin(t, c, 2*time.Second); err != nil {
+		t.Fatalf("CollectAll: %v", err)
+	}
+
+	published := make(map[string]bool)
+	for _, msg := range publisher.Messages(defaultStream) {
+		published[msg.Location.Name] = true
+	}
+	if published[locations[0].Name] || len(published) != 3 {
+		t.Errorf("published %v, want every location but the blocked %s", published, locations[0].Name)
+	}
+}
+
+func TestDecideFetch(t *testing.T) {
+	loc := database.Location{Name: "Tokyo", Latitude: 35.68, Longitude: 139.69}
+	tests := []struct {
+		name    string
+		hasData bool
+		want    fetchPlan
+	}{
+		{"new location backfills hourly history", false, fetchPlan{dataType: "historical", level: api.LevelHourly}},
+		{"known location reads current weather", true, fetchPlan{dataType: "current", level: api.LevelCurrent}},
+	}
+
+	for _, tt := range tests {
+		if got := decideFetch(loc, tt.hasData); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCollectLocationPublishesPlannedDataType(t *testing.T) {
+	locations := testLocations(2)
+	store := stubStore{locations: locations, fresh: map[string]bool{locations[0].Name: true}}
+
+	for _, tt := range []struct {
+		loc  database.Location
+		want string
+	}{
+		{locations[0], "historical"},
+		{locations[1], "current"},
+	} {
+		publisher := NewMemoryPublisher()
+		c := New(blockingProvider{}, store, publisher, Config{Fields: []string{"temperature_2m"}})
+
+		if err := c.CollectLocation(context.Background(), tt.loc); err != nil {
+			t.Fatalf("%s: CollectLocation: %v", tt.loc.Name, err)
+		}
+		messages := publisher.Messages(defaultStream)
+		if len(messages) != 1 || messages[0].Type != tt.want || messages[0].Location.Name != tt.loc.Name {
+			t.Errorf("%s: published %+v, want one %s message", tt.loc.Name, messages, tt.want)
+		}
+	}
+}
+
+func TestCollectLocationReportsFetchFailure(t *testing.T) {
+	loc := testLocations(1)[0]
+	publisher := NewMemoryPublisher()
+	c := New(blockingProvider{blocked: map[float64]bool{loc.Latitude: true}}, stubStore{locations: []database.Location{loc}}, publisher, Config{
+		Fields:          []string{"temperature_2m"},
+		LocationTimeout: 50 * time.Millisecond,
+	})
+
+	err := c.CollectLocation(context.Background(), loc)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), loc.Name) {
+		t.Errorf("CollectLocation error = %v, want the fetch failure for %s", err, loc.Name)
+	}
+	if got := len(publisher.Messages(defaultStream)); got != 0 {
+		t.Errorf("published %d messages after a failed fetch, want 0", got)
+	}
+}
+
+// recordingProvider counts calls per latitude and the most requests in flight at once. Latitudes
+// in failing answer with a rate limit, as the API client does once its own retries are exhausted.
+type recordingProvider struct {
+	failing map[float64]bool
+
+	mu          sync.Mutex
+	calls       map[float64]int
+	inFlight    int
+	maxInFlight int
+}
+
+func (p *recordingProvider) GetCurrentWeatherWithContext(ctx context.Context, lat, long float64, fields []string) (*models.Forecast, error) {
+	p.mu.Lock()
+	if p.calls == nil {
+		p.calls = make(map[float64]int)
+	}
+	p.calls[lat]++
+	p.inFlight++
+	if p.inFlight > p.maxInFlight {
+		p.maxInFlight = p.inFlight
+	}
+	p.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond) // long enough for concurrent requests to overlap
+
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+
+	if p.failing[lat] {
+		return nil, &api.APIError{StatusCode: http.StatusTooManyRequests, Body: "Too many concurrent requests"}
+	}
+	return &models.Forecast{Latitude: lat, Longitude: long}, nil
+}
+
+func (p *recordingProvider) GetHistoricalHourlyDataWithContext(ctx context.Context, lat, long float64, fields []string, pastDays int) (*models.Forecast, error) {
+	return p.GetCurrentWeatherWithContext(ctx, lat, long, fields)
+}
+
+func (p *recordingProvider) GetHourlyForecastWithContext(ctx context.Context, lat, long float64, fields []string, forecastDays int) (*models.Forecast, error) {
+	return p.GetCurrentWeatherWithContext(ctx, lat, long, fields)
+}
+
+func TestCollectAllCollectsEveryLocation(t *testing.T) {
+	locations := testLocations(6)
+	store := stubStore{locations: locations, fresh: map[string]bool{locations[1].Name: true, locations[4].Name: true}}
+	provider := &recordingProvider{failing: map[float64]bool{locations[2].Latitude: true}}
+	publisher := NewMemoryPublisher()
+	c := New(provider, store, publisher, Config{Fields: []string{"temperature_2m"}, MaxConcurrent: 2})
+
+	if err := collectWithin(t, c, 5*time.Second); err != nil {
+		t.Fatalf("CollectAll: %v", err)
+	}
+
+	published := make(map[string]string)
+	for _, msg := range publisher.Messages(defaultStream) {
+		published[msg.Location.Name] = msg.Type
+	}
+	want := map[string]string{
+		locations[0].Name: "current",
+		locations[1].Name: "historical",
+		locations[3].Name: "current",
+		locations[4].Name: "historical",
+		locations[5].Name: "current",
+	}
+	if !reflect.DeepEqual(published, want) {
+		t.Errorf("published %v, want %v (the rate limited location failing alone)", published, want)
+	}
+
+	// The client already retried the rate limit, the collector doesn't multiply its attempts
+	if calls := provider.calls[locations[2].Latitude]; calls != 1 {
+		t.Errorf("rate limited location fetched %d times, want 1", calls)
+	}
+	if provider.maxInFlight > 2 {
+		t.Errorf("%d requests in flight at once, want at most MaxConcurrent = 2", provider.maxInFlight)
+	}
+}
+
+func TestCollectAllSkipsDelayedBackfillsAtDeadline(t *testing.T) {
+	locations := testLocations(3)
+	fresh := make(map[string]bool)
+	for _, loc := range locations {
+		fresh[loc.Name] = true
+	}
+	publisher := NewMemoryPublisher()
+	c := New(&recordingProvider{}, stubStore{locations: locations, fresh: fresh}, publisher, Config{
+		Fields:         []string{"temperature_2m"},
+		MaxConcurrent:  3,
+		BackfillSpread: time.Hour, // the second and third backfills would wait 20 and 40 minutes
+		RunTimeout:     100 * time.Millisecond,
+	})
+
+	err := collectWithin(t, c, 2*time.Second)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CollectAll error = %v, want the run deadline", err)
+	}
+	if got := len(publisher.Messages(defaultStream)); got != 1 {
+		t.Errorf("published %d backfills, want only the undelayed first one", got)
+	}
+}
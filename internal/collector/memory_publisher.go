@@ -0,0 +1,38 @@
+package collector
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryPublisher keeps published messages in memory per stream, for tests and dry runs
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages map[string][]Message
+}
+
+// NewMemoryPublisher creates an empty in-memory publisher
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{messages: make(map[string][]Message)}
+}
+
+// Publish records the message under its stream
+func (p *MemoryPublisher) Publish(ctx context.Context, streamKey string, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages[streamKey] = append(p.messages[streamKey], msg)
+	return nil
+}
+
+// Messages returns a copy of everything published to a stream, in publish order
+func (p *MemoryPublisher) Messages(streamKey string) []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.messages[streamKey]...)
+}
+
+var _ StreamPublisher = (*MemoryPublisher)(nil)
@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"preempt/internal/database"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Message is what the collector publishes for the store service, one fetch for one location
+type Message struct {
+	Location MessageLocation `json:"location"`
+	Forecast interface{}     `json:"forecast"`
+	Fields   []string        `json:"fields"` // fields the store should read from the forecast
+	Type     string          `json:"type"`   // "current", "historical" or "forecast"
+}
+
+// MessageLocation identifies the location a message was fetched for
+type MessageLocation struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+func newMessage(payload interface{}, loc database.Location, fields []string, dataType string) Message {
+	return Message{
+		Location: MessageLocation{Name: loc.Name, Latitude: loc.Latitude, Longitude: loc.Longitude},
+		Forecast: payload,
+		Fields:   fields,
+		Type:     dataType,
+	}
+}
+
+// StreamPublisher hands messages to a stream the store service consumes, e.g. Redis streams
+type StreamPublisher interface {
+	Publish(ctx context.Context, streamKey string, msg Message) error
+}
+
+// RedisPublisher publishes messages to Redis streams as a JSON "data" field
+type RedisPublisher struct {
+	client *redis.Client
+}
+
+// NewRedisPublisher creates a publisher writing through client
+func NewRedisPublisher(client *redis.Client) *RedisPublisher {
+	return &RedisPublisher{client: client}
+}
+
+// Publish serializes the message and adds it to the stream
+func (p *RedisPublisher) Publish(ctx context.Context, streamKey string, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to serialize data: %w", err)
+	}
+
+	return p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"data": string(data)},
+	}).Err()
+}
+
+var _ StreamPublisher = (*RedisPublisher)(nil)
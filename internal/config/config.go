@@ -3,20 +3,37 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"preempt/internal/api"
 
 	"gopkg.in/yaml.v3"
 )
 
 var (
-	instance *Config
+	// instance is swapped atomically so Get never races with Load or Reload
+	instance atomic.Pointer[Config]
 	once     sync.Once
+	loadErr  error // the first Load's error, returned by every later Load
 )
 
 // Config - can/will add more later
 type Config struct {
 	Weather struct {
-		MonitoredFields []string `yaml:"monitored_fields"`
+		MonitoredFields []string         `yaml:"monitored_fields"`
+		Providers       []ProviderConfig `yaml:"providers"`        // tried in order, the next one is used when a request fails
+		BackfillSpread  string           `yaml:"backfill_spread"`  // e.g. "10m" - historical backfills of new locations are staggered over this window
+		LocationTimeout string           `yaml:"location_timeout"` // e.g. "2m" - a location's fetches, retries and publishing are abandoned after this
+		RunTimeout      string           `yaml:"run_timeout"`      // e.g. "4m" - a collect run stops after this plus backfill_spread
+		// Cache reuses identical API responses for this long per kind of request, "0s" disables it
+		Cache struct {
+			CurrentTTL    string `yaml:"current_ttl"`
+			HistoricalTTL string `yaml:"historical_ttl"`
+			ForecastTTL   string `yaml:"forecast_ttl"`
+		} `yaml:"cache"`
 	} `yaml:"weather"`
 	Redis struct {
 		Addr     string `yaml:"addr"`
@@ -24,43 +41,657 @@ type Config struct {
 		DB       int    `yaml:"db"`
 		Stream   string `yaml:"stream"`
 	} `yaml:"redis"`
+	Detection struct {
+		StalenessAfter    string   `yaml:"staleness_after"`     // e.g. "2h" - no new data for this long is a staleness anomaly
+		StalenessSeverity string   `yaml:"staleness_severity"`  // "low", "medium", "high"
+		FlatlineSeverity  string   `yaml:"flatline_severity"`   // "low", "medium", "high"
+		MinZScore         *float64 `yaml:"min_zscore"`          // |z| must exceed this for an anomaly to be recorded at all, 0 records every deviation
+		MediumZScore      float64  `yaml:"medium_zscore"`       // |z| above this is "medium"
+		HighZScore        float64  `yaml:"high_zscore"`         // |z| above this is "high"
+		ClusterWindow     string   `yaml:"cluster_window"`      // e.g. "30m" - anomalies closer than this merge into one event
+		MinStdDev         float64  `yaml:"min_stddev"`          // baselines with a smaller std dev are skipped or clamped
+		MinStdDevMode     string   `yaml:"min_stddev_mode"`     // "skip" or "clamp"
+		StdDevType        string   `yaml:"stddev_type"`         // "sample" (divide by n-1) or "population" (divide by n)
+		RecordMinSeverity string   `yaml:"record_min_severity"` // "low", "medium", "high" - anomalies below this are never stored or notified
+		// FlatlineExempt lists metric types that legitimately hold one value for long stretches, e.g.
+		// precipitation through a dry spell, and never raise flatline anomalies. Unset exempts precipitation.
+		FlatlineExempt []string `yaml:"flatline_exempt"`
+		// MaxAnomaliesPerMetric caps how many anomalies one metric stores per location per run,
+		// the rest are summarized into a single event. 0 disables the cap.
+		MaxAnomaliesPerMetric int `yaml:"max_anomalies_per_metric"`
+		// OnlyNewData skips locations whose newest metric hasn't advanced since their last detection run
+		OnlyNewData bool `yaml:"only_new_data"`
+		// DisabledMetrics maps a location to metric types that are still stored but never
+		// produce anomalies or suggestions there, e.g. a faulty sensor at one site
+		DisabledMetrics map[string][]string `yaml:"disabled_metrics"`
+		Windows         struct {
+			Stats DetectionWindow `yaml:"stats"`
+			ML    DetectionWindow `yaml:"ml"`
+		} `yaml:"windows"`
+	} `yaml:"detection"`
+	Suggestion struct {
+		Rules         map[string]SuggestionRule `yaml:"rules"`          // metric type -> rule overriding the built-in logic
+		MinSeverity   string                    `yaml:"min_severity"`   // only anomalies at or above this severity count toward a suggestion
+		HistoryWindow string                    `yaml:"history_window"` // e.g. "720h" - stored anomalies this recent also count toward a suggestion
+		// ConfidenceWindow, e.g. "72h", limits confidence to anomalies this recent, all of them still
+		// count toward the minimum for a suggestion. Unset uses every anomaly.
+		ConfidenceWindow string `yaml:"confidence_window"`
+		// Weighting is "zscore" (the default) to weight each anomaly's value by |z| when deriving a
+		// threshold, or "none" to treat every anomaly equally
+		Weighting string `yaml:"weighting"`
+	} `yaml:"suggestion"`
+	Rollup struct {
+		HourlyAfter string `yaml:"hourly_after"` // raw metrics older than this are rolled up into hourly rows
+		DailyAfter  string `yaml:"daily_after"`  // hourly rows older than this are rolled up into daily rows
+	} `yaml:"rollup"`
+	Ingestion struct {
+		Bounds map[string]ValueBounds `yaml:"bounds"` // metric type -> plausible range, overrides the built-in limits
+	} `yaml:"ingestion"`
+	Forecast struct {
+		Enabled         bool   `yaml:"enabled"`
+		Days            int    `yaml:"days"`             // how many days ahead to fetch
+		RefreshInterval string `yaml:"refresh_interval"` // e.g. "1h" - minimum time between forecast fetches per location
+	} `yaml:"forecast"`
+	DB struct {
+		BatchSize int `yaml:"batch_size"` // rows per batched INSERT or import commit
+	} `yaml:"db"`
+	Audit struct {
+		StoreRawForecasts    bool   `yaml:"store_raw_forecasts"`    // keep each API payload in raw_forecasts, off by default
+		RawForecastRetention string `yaml:"raw_forecast_retention"` // e.g. "168h" - raw payloads older than this are pruned
+	} `yaml:"audit"`
+	Notifications struct {
+		Channels []NotificationChannel `yaml:"channels"`
+		Routes   map[string][]string   `yaml:"routes"`   // severity -> channel names, unrouted severities are not sent
+		Cooldown string                `yaml:"cooldown"` // e.g. "30m" - further anomalies for the same location and metric are not sent this long
+	} `yaml:"notifications"`
+	Output struct {
+		Anomalies string `yaml:"anomalies"` // "db", "file" (JSON lines) or "stdout" (JSON lines)
+		Path      string `yaml:"path"`      // file appended to when anomalies is "file"
+	} `yaml:"output"`
+	Server struct {
+		ReadTimeout  string `yaml:"read_timeout"`  // e.g. "15s" - whole request including body, bounds slow clients
+		WriteTimeout string `yaml:"write_timeout"` // e.g. "120s" - from end of request headers to end of response, exports must fit
+		IdleTimeout  string `yaml:"idle_timeout"`  // e.g. "120s" - keep-alive connections idle this long are closed
+	} `yaml:"server"`
 }
 
-func Load(configPath string) (*Config, error) {
-	var err error
-	once.Do(func() {
-		instance = &Config{}
+// NotificationChannel is a destination anomaly notifications can be routed to
+type NotificationChannel struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"` // "slack", "webhook" or "log"
+	URL  string `yaml:"url"`  // required for slack and webhook
+}
 
-		data, readErr := os.ReadFile(configPath)
-		if readErr != nil {
-			err = fmt.Errorf("failed to read config file %s: %w", configPath, readErr)
-			return
-		}
+// SuggestionRule declares how to derive an alarm threshold for one metric type
+type SuggestionRule struct {
+	Operator        string  `yaml:"operator"`         // ">" or "<"
+	SigmaMultiplier float64 `yaml:"sigma_multiplier"` // threshold = mean +/- multiplier * stddev
+	Description     string  `yaml:"description"`
+}
 
-		if parseErr := yaml.Unmarshal(data, instance); parseErr != nil {
-			err = fmt.Errorf("failed to parse config: %w", parseErr)
-			return
-		}
+// DetectionWindow is how much history a detection method learns from and how much of it is checked
+type DetectionWindow struct {
+	Baseline   string `yaml:"baseline"`   // e.g. "168h" - readings this recent form the baseline
+	Evaluation string `yaml:"evaluation"` // e.g. "24h" - readings this recent are checked for anomalies
+}
+
+// ProviderConfig is an Open-Meteo compatible endpoint, e.g. the public API or a self-hosted instance
+type ProviderConfig struct {
+	Name    string `yaml:"name"`
+	BaseURL string `yaml:"base_url"`
+}
 
-		if validateErr := instance.validate(); validateErr != nil {
-			err = validateErr
+// ValueBounds is the physically plausible range for a metric's values
+type ValueBounds struct {
+	Min float64 `yaml:"min"`
+	Max float64 `yaml:"max"`
+}
+
+// Load reads the config file once. An invalid file is never published, so Get keeps panicking
+// rather than handing out a half-parsed config.
+func Load(configPath string) (*Config, error) {
+	once.Do(func() {
+		cfg, err := readConfig(configPath)
+		if err != nil {
+			loadErr = err
 			return
 		}
+		instance.Store(cfg)
 	})
 
-	return instance, err
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	return instance.Load(), nil
+}
+
+// Reload re-reads the config file and swaps it in only if it is valid.
+// Readers holding the previous *Config keep a consistent snapshot.
+func Reload(configPath string) (*Config, error) {
+	cfg, err := readConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	instance.Store(cfg)
+	return cfg, nil
 }
 
 func Get() *Config {
-	if instance == nil {
+	cfg := instance.Load()
+	if cfg == nil {
 		panic("config not loaded - call config.Load() first")
 	}
-	return instance
+	return cfg
+}
+
+// readConfig parses, defaults and validates the config file
+func readConfig(configPath string) (*Config, error) {
+	cfg := &Config{}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config file %s: %w", configPath, err)
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	cfg.setDefaults()
+
+	if err := cfg.validate(); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// setDefaults canonicalizes monitored fields and fills in optional settings left empty in the config file
+func (c *Config) setDefaults() {
+	// Metric types are matched exactly against stored rows, which are always lowercase and trimmed
+	for i, field := range c.Weather.MonitoredFields {
+		c.Weather.MonitoredFields[i] = strings.ToLower(strings.TrimSpace(field))
+	}
+	for _, fields := range c.Detection.DisabledMetrics {
+		for i, field := range fields {
+			fields[i] = strings.ToLower(strings.TrimSpace(field))
+		}
+	}
+	if c.Weather.LocationTimeout == "" {
+		c.Weather.LocationTimeout = "2m"
+	}
+	if c.Weather.RunTimeout == "" {
+		c.Weather.RunTimeout = "4m" // ends before the next run scheduled 5m later
+	}
+	if c.Weather.Cache.CurrentTTL == "" {
+		c.Weather.Cache.CurrentTTL = "60s"
+	}
+	if c.Weather.Cache.HistoricalTTL == "" {
+		c.Weather.Cache.HistoricalTTL = "1h"
+	}
+	if c.Weather.Cache.ForecastTTL == "" {
+		c.Weather.Cache.ForecastTTL = "10m"
+	}
+	if c.Detection.StalenessAfter == "" {
+		c.Detection.StalenessAfter = "2h"
+	}
+	if c.Detection.StalenessSeverity == "" {
+		c.Detection.StalenessSeverity = "medium"
+	}
+	if c.Detection.FlatlineSeverity == "" {
+		c.Detection.FlatlineSeverity = "low"
+	}
+	if c.Detection.FlatlineExempt == nil {
+		c.Detection.FlatlineExempt = []string{"precipitation"}
+	}
+	if c.Detection.RecordMinSeverity == "" {
+		c.Detection.RecordMinSeverity = "low"
+	}
+	if c.Detection.MinZScore == nil {
+		minZScore := 1.0
+		c.Detection.MinZScore = &minZScore
+	}
+	if c.Detection.MediumZScore == 0 {
+		c.Detection.MediumZScore = 1.5
+	}
+	if c.Detection.HighZScore == 0 {
+		c.Detection.HighZScore = 2.0
+	}
+	if c.Detection.ClusterWindow == "" {
+		c.Detection.ClusterWindow = "30m"
+	}
+	if c.Detection.MinStdDevMode == "" {
+		c.Detection.MinStdDevMode = "skip"
+	}
+	if c.Detection.StdDevType == "" {
+		c.Detection.StdDevType = "sample"
+	}
+	if c.Detection.Windows.Stats.Baseline == "" {
+		c.Detection.Windows.Stats.Baseline = "168h"
+	}
+	if c.Detection.Windows.Stats.Evaluation == "" {
+		c.Detection.Windows.Stats.Evaluation = "24h"
+	}
+	if c.Detection.Windows.ML.Baseline == "" {
+		c.Detection.Windows.ML.Baseline = "720h"
+	}
+	if c.Detection.Windows.ML.Evaluation == "" {
+		c.Detection.Windows.ML.Evaluation = "24h"
+	}
+	if c.Suggestion.MinSeverity == "" {
+		c.Suggestion.MinSeverity = "low"
+	}
+	if c.Suggestion.HistoryWindow == "" {
+		c.Suggestion.HistoryWindow = "720h"
+	}
+	if c.Suggestion.Weighting == "" {
+		c.Suggestion.Weighting = "zscore"
+	}
+	if c.Rollup.HourlyAfter == "" {
+		c.Rollup.HourlyAfter = "720h"
+	}
+	if c.Rollup.DailyAfter == "" {
+		c.Rollup.DailyAfter = "2160h"
+	}
+	if c.Forecast.Days == 0 {
+		c.Forecast.Days = 3
+	}
+	if c.Forecast.RefreshInterval == "" {
+		c.Forecast.RefreshInterval = "1h"
+	}
+	if c.DB.BatchSize == 0 {
+		c.DB.BatchSize = 500
+	}
+	if c.Audit.RawForecastRetention == "" {
+		c.Audit.RawForecastRetention = "168h"
+	}
+	if c.Notifications.Cooldown == "" {
+		c.Notifications.Cooldown = "30m"
+	}
+	if c.Output.Anomalies == "" {
+		c.Output.Anomalies = "db"
+	}
+	if c.Server.ReadTimeout == "" {
+		c.Server.ReadTimeout = "15s"
+	}
+	if c.Server.WriteTimeout == "" {
+		c.Server.WriteTimeout = "120s"
+	}
+	if c.Server.IdleTimeout == "" {
+		c.Server.IdleTimeout = "120s"
+	}
 }
 
 func (c *Config) validate() error {
 	if len(c.Weather.MonitoredFields) == 0 {
 		return fmt.Errorf("weather.monitored_fields cannot be empty")
 	}
+	for _, field := range c.Weather.MonitoredFields {
+		if !api.IsSupportedField(field) {
+			return fmt.Errorf("weather.monitored_fields: unsupported field %q", field)
+		}
+		// The collector publishes current and hourly readings only, a daily aggregate would never be stored
+		if !api.SupportsLevel(field, api.LevelCurrent) && !api.SupportsLevel(field, api.LevelHourly) {
+			return fmt.Errorf("weather.monitored_fields: %q is only available as a daily aggregate, which isn't collected", field)
+		}
+	}
+	providerNames := make(map[string]bool)
+	for i, provider := range c.Weather.Providers {
+		if provider.Name == "" || provider.BaseURL == "" {
+			return fmt.Errorf("weather.providers[%d] needs both name and base_url", i)
+		}
+		if providerNames[provider.Name] {
+			return fmt.Errorf("weather.providers has duplicate name %q", provider.Name)
+		}
+		providerNames[provider.Name] = true
+	}
+	if c.Weather.BackfillSpread != "" {
+		if d, err := time.ParseDuration(c.Weather.BackfillSpread); err != nil || d < 0 {
+			return fmt.Errorf("weather.backfill_spread must be a non-negative duration, got %q", c.Weather.BackfillSpread)
+		}
+	}
+	for key, value := range map[string]string{
+		"weather.cache.current_ttl":    c.Weather.Cache.CurrentTTL,
+		"weather.cache.historical_ttl": c.Weather.Cache.HistoricalTTL,
+		"weather.cache.forecast_ttl":   c.Weather.Cache.ForecastTTL,
+		"weather.location_timeout":     c.Weather.LocationTimeout,
+		"weather.run_timeout":          c.Weather.RunTimeout,
+	} {
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return fmt.Errorf("%s must be a non-negative duration, got %q", key, value)
+		}
+	}
+	if _, err := time.ParseDuration(c.Detection.StalenessAfter); err != nil {
+		return fmt.Errorf("detection.staleness_after is not a valid duration: %w", err)
+	}
+	if !isValidSeverity(c.Detection.StalenessSeverity) {
+		return fmt.Errorf("detection.staleness_severity must be low, medium or high, got %q", c.Detection.StalenessSeverity)
+	}
+	if !isValidSeverity(c.Detection.FlatlineSeverity) {
+		return fmt.Errorf("detection.flatline_severity must be low, medium or high, got %q", c.Detection.FlatlineSeverity)
+	}
+	if !isValidSeverity(c.Detection.RecordMinSeverity) {
+		return fmt.Errorf("detection.record_min_severity must be low, medium or high, got %q", c.Detection.RecordMinSeverity)
+	}
+	if *c.Detection.MinZScore < 0 {
+		return fmt.Errorf("detection.min_zscore cannot be negative")
+	}
+	if c.Detection.MediumZScore >= c.Detection.HighZScore {
+		return fmt.Errorf("detection.medium_zscore (%.2f) must be below detection.high_zscore (%.2f)",
+			c.Detection.MediumZScore, c.Detection.HighZScore)
+	}
+	if c.Detection.MaxAnomaliesPerMetric < 0 {
+		return fmt.Errorf("detection.max_anomalies_per_metric cannot be negative")
+	}
+	if c.Detection.MinStdDev < 0 {
+		return fmt.Errorf("detection.min_stddev cannot be negative")
+	}
+	if c.Detection.MinStdDevMode != "skip" && c.Detection.MinStdDevMode != "clamp" {
+		return fmt.Errorf("detection.min_stddev_mode must be skip or clamp, got %q", c.Detection.MinStdDevMode)
+	}
+	if c.Detection.StdDevType != "sample" && c.Detection.StdDevType != "population" {
+		return fmt.Errorf("detection.stddev_type must be sample or population, got %q", c.Detection.StdDevType)
+	}
+	if err := c.Detection.Windows.Stats.validate("detection.windows.stats"); err != nil {
+		return err
+	}
+	if err := c.Detection.Windows.ML.validate("detection.windows.ml"); err != nil {
+		return err
+	}
+	if !isValidSeverity(c.Suggestion.MinSeverity) {
+		return fmt.Errorf("suggestion.min_severity must be low, medium or high, got %q", c.Suggestion.MinSeverity)
+	}
+	if _, err := time.ParseDuration(c.Suggestion.HistoryWindow); err != nil {
+		return fmt.Errorf("suggestion.history_window is not a valid duration: %w", err)
+	}
+	if c.Suggestion.ConfidenceWindow != "" {
+		if _, err := time.ParseDuration(c.Suggestion.ConfidenceWindow); err != nil {
+			return fmt.Errorf("suggestion.confidence_window is not a valid duration: %w", err)
+		}
+	}
+	if c.Suggestion.Weighting != "zscore" && c.Suggestion.Weighting != "none" {
+		return fmt.Errorf("suggestion.weighting must be zscore or none, got %q", c.Suggestion.Weighting)
+	}
+	for metricType, rule := range c.Suggestion.Rules {
+		if rule.Operator != ">" && rule.Operator != "<" {
+			return fmt.Errorf("suggestion.rules.%s.operator must be > or <, got %q", metricType, rule.Operator)
+		}
+		if rule.SigmaMultiplier < 0 {
+			return fmt.Errorf("suggestion.rules.%s.sigma_multiplier cannot be negative", metricType)
+		}
+	}
+	for metricType, bounds := range c.Ingestion.Bounds {
+		if bounds.Min >= bounds.Max {
+			return fmt.Errorf("ingestion.bounds.%s: min (%g) must be below max (%g)", metricType, bounds.Min, bounds.Max)
+		}
+	}
+	if _, err := time.ParseDuration(c.Detection.ClusterWindow); err != nil {
+		return fmt.Errorf("detection.cluster_window is not a valid duration: %w", err)
+	}
+	hourlyAfter, err := time.ParseDuration(c.Rollup.HourlyAfter)
+	if err != nil {
+		return fmt.Errorf("rollup.hourly_after is not a valid duration: %w", err)
+	}
+	dailyAfter, err := time.ParseDuration(c.Rollup.DailyAfter)
+	if err != nil {
+		return fmt.Errorf("rollup.daily_after is not a valid duration: %w", err)
+	}
+	if dailyAfter <= hourlyAfter {
+		return fmt.Errorf("rollup.daily_after (%s) must be longer than rollup.hourly_after (%s)", c.Rollup.DailyAfter, c.Rollup.HourlyAfter)
+	}
+	if c.Forecast.Days < 1 || c.Forecast.Days > 16 {
+		return fmt.Errorf("forecast.days must be between 1 and 16, got %d", c.Forecast.Days)
+	}
+	if _, err := time.ParseDuration(c.Forecast.RefreshInterval); err != nil {
+		return fmt.Errorf("forecast.refresh_interval is not a valid duration: %w", err)
+	}
+	if c.DB.BatchSize < 1 {
+		return fmt.Errorf("db.batch_size must be positive, got %d", c.DB.BatchSize)
+	}
+	if _, err := time.ParseDuration(c.Audit.RawForecastRetention); err != nil {
+		return fmt.Errorf("audit.raw_forecast_retention is not a valid duration: %w", err)
+	}
+	if _, err := time.ParseDuration(c.Notifications.Cooldown); err != nil {
+		return fmt.Errorf("notifications.cooldown is not a valid duration: %w", err)
+	}
+	switch c.Output.Anomalies {
+	case "db", "stdout":
+	case "file":
+		if c.Output.Path == "" {
+			return fmt.Errorf("output.path is required when output.anomalies is file")
+		}
+	default:
+		return fmt.Errorf("output.anomalies must be db, file or stdout, got %q", c.Output.Anomalies)
+	}
+	for key, value := range map[string]string{
+		"server.read_timeout":  c.Server.ReadTimeout,
+		"server.write_timeout": c.Server.WriteTimeout,
+		"server.idle_timeout":  c.Server.IdleTimeout,
+	} {
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("%s must be a positive duration, got %q", key, value)
+		}
+	}
+	channelNames := make(map[string]bool)
+	for i, ch := range c.Notifications.Channels {
+		if ch.Name == "" {
+			return fmt.Errorf("notifications.channels[%d] needs a name", i)
+		}
+		if channelNames[ch.Name] {
+			return fmt.Errorf("notifications.channels has duplicate name %q", ch.Name)
+		}
+		channelNames[ch.Name] = true
+		switch ch.Type {
+		case "slack", "webhook":
+			if ch.URL == "" {
+				return fmt.Errorf("notifications.channels.%s needs a url", ch.Name)
+			}
+		case "log":
+		default:
+			return fmt.Errorf("notifications.channels.%s.type must be slack, webhook or log, got %q", ch.Name, ch.Type)
+		}
+	}
+	for severity, names := range c.Notifications.Routes {
+		if !isValidSeverity(severity) {
+			return fmt.Errorf("notifications.routes keys must be low, medium or high, got %q", severity)
+		}
+		for _, name := range names {
+			if !channelNames[name] {
+				return fmt.Errorf("notifications.routes.%s references unknown channel %q", severity, name)
+			}
+		}
+	}
+	return nil
+}
+
+func (w DetectionWindow) validate(key string) error {
+	baseline, err := time.ParseDuration(w.Baseline)
+	if err != nil {
+		return fmt.Errorf("%s.baseline is not a valid duration: %w", key, err)
+	}
+	evaluation, err := time.ParseDuration(w.Evaluation)
+	if err != nil {
+		return fmt.Errorf("%s.evaluation is not a valid duration: %w", key, err)
+	}
+	if evaluation <= 0 || evaluation > baseline {
+		return fmt.Errorf("%s.evaluation (%s) must be positive and no longer than baseline (%s)", key, w.Evaluation, w.Baseline)
+	}
 	return nil
 }
+
+// Durations returns the parsed baseline and evaluation windows
+func (w DetectionWindow) Durations() (baseline, evaluation time.Duration) {
+	baseline, _ = time.ParseDuration(w.Baseline)
+	evaluation, _ = time.ParseDuration(w.Evaluation)
+	return baseline, evaluation
+}
+
+// maxWindowRatio is how far apart the stats and ML windows can be before their results stop being comparable
+const maxWindowRatio = 8
+
+// DetectionWindowWarning describes why the stats and ML windows are too far apart to compare
+// their anomalies, or returns "" when they are close enough
+func (c *Config) DetectionWindowWarning() string {
+	statsBaseline, statsEvaluation := c.Detection.Windows.Stats.Durations()
+	mlBaseline, mlEvaluation := c.Detection.Windows.ML.Durations()
+
+	if ratio(statsBaseline, mlBaseline) > maxWindowRatio {
+		return fmt.Sprintf("detection.windows baselines differ by more than %dx (stats %s, ml %s), stats and ML anomalies are not comparable",
+			maxWindowRatio, c.Detection.Windows.Stats.Baseline, c.Detection.Windows.ML.Baseline)
+	}
+	if ratio(statsEvaluation, mlEvaluation) > maxWindowRatio {
+		return fmt.Sprintf("detection.windows evaluation windows differ by more than %dx (stats %s, ml %s), stats and ML anomalies are not comparable",
+			maxWindowRatio, c.Detection.Windows.Stats.Evaluation, c.Detection.Windows.ML.Evaluation)
+	}
+	return ""
+}
+
+// AnomalyOutputWarning describes what stops working when output.anomalies keeps anomalies out of
+// MySQL, or returns "" when they are stored there
+func (c *Config) AnomalyOutputWarning() string {
+	if c.Output.Anomalies == "" || c.Output.Anomalies == "db" {
+		return ""
+	}
+	return fmt.Sprintf("output.anomalies is %q, anomalies are not stored in MySQL: suggestions only see the current run, "+
+		"and /anomalies, /anomalies/export, /recompute-severities and /suggestions/regenerate find none", c.Output.Anomalies)
+}
+
+// ratio returns how many times longer the longer duration is
+func ratio(a, b time.Duration) float64 {
+	if a < b {
+		a, b = b, a
+	}
+	return float64(a) / float64(b)
+}
+
+// MetricDisabled reports whether detection.disabled_metrics turns off a metric type at a location
+func (c *Config) MetricDisabled(location, metricType string) bool {
+	for _, disabled := range c.Detection.DisabledMetrics[location] {
+		if disabled == metricType {
+			return true
+		}
+	}
+	return false
+}
+
+// FlatlineExempt reports whether detection.flatline_exempt keeps a metric type from raising flatline anomalies
+func (c *Config) FlatlineExempt(metricType string) bool {
+	for _, exempt := range c.Detection.FlatlineExempt {
+		if exempt == metricType {
+			return true
+		}
+	}
+	return false
+}
+
+// MinZScore returns detection.min_zscore, the |z| an anomaly must exceed to be recorded
+func (c *Config) MinZScore() float64 {
+	return *c.Detection.MinZScore
+}
+
+// DetectedFields returns the monitored fields detection runs on at a location, in config order
+func (c *Config) DetectedFields(location string) []string {
+	if len(c.Detection.DisabledMetrics[location]) == 0 {
+		return c.Weather.MonitoredFields
+	}
+
+	var fields []string
+	for _, field := range c.Weather.MonitoredFields {
+		if !c.MetricDisabled(location, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// ClusterWindow returns the parsed detection.cluster_window duration
+func (c *Config) ClusterWindow() time.Duration {
+	d, _ := time.ParseDuration(c.Detection.ClusterWindow)
+	return d
+}
+
+// RollupAges returns the parsed rollup.hourly_after and rollup.daily_after durations
+func (c *Config) RollupAges() (hourlyAfter, dailyAfter time.Duration) {
+	hourlyAfter, _ = time.ParseDuration(c.Rollup.HourlyAfter)
+	dailyAfter, _ = time.ParseDuration(c.Rollup.DailyAfter)
+	return hourlyAfter, dailyAfter
+}
+
+// BackfillSpread returns the parsed weather.backfill_spread duration, 0 when unset
+func (c *Config) BackfillSpread() time.Duration {
+	d, _ := time.ParseDuration(c.Weather.BackfillSpread)
+	return d
+}
+
+// CollectTimeouts returns the parsed weather.location_timeout and the deadline of a whole collect
+// run, weather.run_timeout plus weather.backfill_spread since backfills are staggered over that
+// window. Zero means no limit.
+func (c *Config) CollectTimeouts() (location, run time.Duration) {
+	location, _ = time.ParseDuration(c.Weather.LocationTimeout)
+	run, _ = time.ParseDuration(c.Weather.RunTimeout)
+	if run > 0 {
+		run += c.BackfillSpread()
+	}
+	return location, run
+}
+
+// WeatherCacheTTLs returns the parsed weather.cache durations for current, historical and forecast requests
+func (c *Config) WeatherCacheTTLs() (current, historical, forecast time.Duration) {
+	current, _ = time.ParseDuration(c.Weather.Cache.CurrentTTL)
+	historical, _ = time.ParseDuration(c.Weather.Cache.HistoricalTTL)
+	forecast, _ = time.ParseDuration(c.Weather.Cache.ForecastTTL)
+	return current, historical, forecast
+}
+
+// ForecastRefreshInterval returns the parsed forecast.refresh_interval duration
+func (c *Config) ForecastRefreshInterval() time.Duration {
+	d, _ := time.ParseDuration(c.Forecast.RefreshInterval)
+	return d
+}
+
+// SuggestionHistoryWindow returns the parsed suggestion.history_window duration
+func (c *Config) SuggestionHistoryWindow() time.Duration {
+	d, _ := time.ParseDuration(c.Suggestion.HistoryWindow)
+	return d
+}
+
+// SuggestionConfidenceWindow returns the parsed suggestion.confidence_window duration, 0 when unset
+func (c *Config) SuggestionConfidenceWindow() time.Duration {
+	d, _ := time.ParseDuration(c.Suggestion.ConfidenceWindow)
+	return d
+}
+
+// RawForecastRetention returns the parsed audit.raw_forecast_retention duration
+func (c *Config) RawForecastRetention() time.Duration {
+	d, _ := time.ParseDuration(c.Audit.RawForecastRetention)
+	return d
+}
+
+// NotificationCooldown returns the parsed notifications.cooldown duration
+func (c *Config) NotificationCooldown() time.Duration {
+	d, _ := time.ParseDuration(c.Notifications.Cooldown)
+	return d
+}
+
+// ServerTimeouts returns the parsed server.read_timeout, write_timeout and idle_timeout durations
+func (c *Config) ServerTimeouts() (read, write, idle time.Duration) {
+	read, _ = time.ParseDuration(c.Server.ReadTimeout)
+	write, _ = time.ParseDuration(c.Server.WriteTimeout)
+	idle, _ = time.ParseDuration(c.Server.IdleTimeout)
+	return read, write, idle
+}
+
+// StalenessAfter returns the parsed detection.staleness_after duration
+func (c *Config) StalenessAfter() time.Duration {
+	d, _ := time.ParseDuration(c.Detection.StalenessAfter)
+	return d
+}
+
+func isValidSeverity(severity string) bool {
+	switch severity {
+	case "low", "medium", "high":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+// Load runs once per process, so this must stay the only test that calls it
+func TestLoadDoesNotPublishInvalidConfig(t *testing.T) {
+	path := writeConfig(t, "invalid.yaml", "weather:\n  monitored_fields: []\n")
+
+	cfg, err := Load(path)
+	if err == nil {
+		t.Fatal("expected an error for empty monitored_fields")
+	}
+	if cfg != nil {
+		t.Errorf("Load returned a config alongside its error: %+v", cfg)
+	}
+	if _, again := Load(path); again == nil {
+		t.Error("a later Load forgot the first Load's error")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Get returned a config after a failed Load")
+		}
+	}()
+	Get()
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	valid := writeConfig(t, "valid.yaml", "weather:\n  monitored_fields: [temperature_2m]\ndetection:\n  high_zscore: 3\n")
+	if _, err := Reload(valid); err != nil {
+		t.Fatalf("Reload(valid): %v", err)
+	}
+
+	invalid := writeConfig(t, "invalid.yaml", "weather:\n  monitored_fields: [temperature_2m]\ndetection:\n  stddev_type: median\n")
+	if _, err := Reload(invalid); err == nil {
+		t.Fatal("expected an error for an invalid stddev_type")
+	}
+	if got := Get().Detection.HighZScore; got != 3 {
+		t.Errorf("invalid Reload replaced the config, high_zscore = %v, want 3", got)
+	}
+}
+
+// Run with -race: readers must never see a torn config while Reload swaps between two files
+func TestGetDuringReload(t *testing.T) {
+	a := writeConfig(t, "a.yaml", "weather:\n  monitored_fields: [temperature_2m]\ndetection:\n  medium_zscore: 1.5\n  high_zscore: 2.0\n")
+	b := writeConfig(t, "b.yaml", "weather:\n  monitored_fields: [temperature_2m, precipitation]\ndetection:\n  medium_zscore: 2.5\n  high_zscore: 4.0\n")
+	if _, err := Reload(a); err != nil {
+		t.Fatalf("Reload(a): %v", err)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				cfg := Get()
+				fields := len(cfg.Weather.MonitoredFields)
+				medium, high := cfg.Detection.MediumZScore, cfg.Detection.HighZScore
+				consistentA := fields == 1 && medium == 1.5 && high == 2.0
+				consistentB := fields == 2 && medium == 2.5 && high == 4.0
+				if !consistentA && !consistentB {
+					errs <- "inconsistent snapshot"
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		path := a
+		if i%2 == 1 {
+			path = b
+		}
+		if _, err := Reload(path); err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestReloadRejectsDailyOnlyMonitoredField(t *testing.T) {
+	path := writeConfig(t, "daily.yaml", "weather:\n  monitored_fields: [temperature_2m, precipitation_sum]\n")
+
+	_, err := Reload(path)
+	if err == nil {
+		t.Fatal("expected an error for a daily-only monitored field")
+	}
+	if !strings.Contains(err.Error(), `"precipitation_sum"`) {
+		t.Errorf("error %q doesn't name the field", err)
+	}
+}
+
+func TestReloadValidatesMonitoredFields(t *testing.T) {
+	valid := writeConfig(t, "valid.yaml", "weather:\n  monitored_fields: [\" Temperature_2m \"]\n")
+	cfg, err := Reload(valid)
+	if err != nil {
+		t.Fatalf("Reload(valid): %v", err)
+	}
+	if got := cfg.Weather.MonitoredFields; len(got) != 1 || got[0] != "temperature_2m" {
+		t.Errorf("monitored_fields = %q, want [temperature_2m]", got)
+	}
+
+	misspelled := writeConfig(t, "misspelled.yaml", "weather:\n  monitored_fields: [temperature_2m, temprature_2m]\n")
+	_, err = Reload(misspelled)
+	if err == nil {
+		t.Fatal("expected an error for an unsupported monitored field")
+	}
+	if !strings.Contains(err.Error(), `"temprature_2m"`) {
+		t.Errorf("error %q doesn't name the field", err)
+	}
+}
+
+func TestReloadRejectsNonPositiveBatchSize(t *testing.T) {
+	path := writeConfig(t, "batch.yaml", "weather:\n  monitored_fields: [temperature_2m]\ndb:\n  batch_size: -1\n")
+	if _, err := Reload(path); err == nil || !strings.Contains(err.Error(), "db.batch_size") {
+		t.Errorf("error = %v, want db.batch_size rejected", err)
+	}
+
+	path = writeConfig(t, "default.yaml", "weather:\n  monitored_fields: [temperature_2m]\n")
+	cfg, err := Reload(path)
+	if err != nil {
+		t.Fatalf("Reload(default): %v", err)
+	}
+	if cfg.DB.BatchSize != 500 {
+		t.Errorf("default batch_size = %d, want 500", cfg.DB.BatchSize)
+	}
+}
@@ -0,0 +1,31 @@
+// Package configtest installs configs for tests of packages that read config.Get
+package configtest
+
+import (
+	"os"
+	"path/filepath"
+	"preempt/internal/config"
+	"testing"
+)
+
+// Minimal is the smallest valid config, every other setting takes its default
+const Minimal = `
+weather:
+  monitored_fields: [temperature_2m, surface_pressure]
+`
+
+// Use writes yaml to a temporary config file and swaps it in with config.Reload, failing the test
+// if it doesn't validate. Components that snapshot config.Get must be created after calling it.
+func Use(t testing.TB, yaml string) *config.Config {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	cfg, err := config.Reload(path)
+	if err != nil {
+		t.Fatalf("failed to load test config: %v", err)
+	}
+	return cfg
+}
@@ -0,0 +1,9 @@
+package config
+
+import "os"
+
+// GetDebugToken returns the bearer token guarding /debug endpoints.
+// Empty means the debug endpoints are disabled.
+func GetDebugToken() string {
+	return os.Getenv("DEBUG_TOKEN")
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"os"
 	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
 )
 
 type RedisConfig struct {
@@ -10,6 +13,15 @@ type RedisConfig struct {
 	Password string
 	DB       int
 	Stream   string
+	// TypeStreams routes a data type ("current", "historical", "forecast") to its own stream
+	// so bulk backfill doesn't queue ahead of real-time data. Unlisted types use Stream.
+	TypeStreams map[string]string
+	// ConsumerGroup is the group store reads with, deployments sharing a Redis need distinct groups
+	ConsumerGroup string
+	// PublishBatchSize and PublishFlushInterval control how collect pipelines XADDs: a batch is
+	// sent once it holds this many messages or the interval has passed since its first one
+	PublishBatchSize     int
+	PublishFlushInterval time.Duration
 }
 
 func GetRedisConfig() RedisConfig {
@@ -20,17 +32,82 @@ func GetRedisConfig() RedisConfig {
 		}
 	}
 
+	batchSize := 50
+	if sizeStr := os.Getenv("REDIS_PUBLISH_BATCH_SIZE"); sizeStr != "" {
+		if parsed, err := strconv.Atoi(sizeStr); err == nil && parsed > 0 {
+			batchSize = parsed
+		}
+	}
+
+	flushInterval := 200 * time.Millisecond
+	if intervalStr := os.Getenv("REDIS_PUBLISH_FLUSH_INTERVAL"); intervalStr != "" {
+		if parsed, err := time.ParseDuration(intervalStr); err == nil && parsed > 0 {
+			flushInterval = parsed
+		}
+	}
+
+	typeStreams := make(map[string]string)
+	for dataType, key := range map[string]string{
+		"current":    "REDIS_STREAM_CURRENT",
+		"historical": "REDIS_STREAM_HISTORICAL",
+		"forecast":   "REDIS_STREAM_FORECAST",
+	} {
+		if stream := os.Getenv(key); stream != "" {
+			typeStreams[dataType] = stream
+		}
+	}
+
 	return RedisConfig{
-		Addr:     getEnv("REDIS_ADDR", "localhost:6379"),
-		Password: os.Getenv("REDIS_PASSWORD"),
-		DB:       db,
-		Stream:   getEnv("REDIS_STREAM", "weather_metrics"),
+		Addr:          getEnv("REDIS_ADDR", "localhost:6379"),
+		Password:      os.Getenv("REDIS_PASSWORD"),
+		DB:            db,
+		Stream:        getEnv("REDIS_STREAM", "weather_metrics"),
+		TypeStreams:   typeStreams,
+		ConsumerGroup: getEnv("REDIS_CONSUMER_GROUP", "weather_consumers"),
+
+		PublishBatchSize:     batchSize,
+		PublishFlushInterval: flushInterval,
 	}
 }
 
+// StreamFor returns the stream data of the given type is published to
+func (c RedisConfig) StreamFor(dataType string) string {
+	if stream, ok := c.TypeStreams[dataType]; ok {
+		return stream
+	}
+	return c.Stream
+}
+
+// Streams returns every distinct stream data can be published to, the default stream first
+func (c RedisConfig) Streams() []string {
+	streams := []string{c.Stream}
+	seen := map[string]bool{c.Stream: true}
+	for _, dataType := range []string{"current", "historical", "forecast"} {
+		if stream := c.StreamFor(dataType); !seen[stream] {
+			seen[stream] = true
+			streams = append(streams, stream)
+		}
+	}
+	return streams
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+// Options returns client options with retries and timeouts tuned so a Redis restart
+// is retried transparently instead of surfacing as an immediate error
+func (c RedisConfig) Options() *redis.Options {
+	return &redis.Options{
+		Addr:            c.Addr,
+		Password:        c.Password,
+		DB:              c.DB,
+		MaxRetries:      5,
+		MinRetryBackoff: 100 * time.Millisecond,
+		MaxRetryBackoff: 2 * time.Second,
+		DialTimeout:     5 * time.Second,
+	}
+}
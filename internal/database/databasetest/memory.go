@@ -0,0 +1,295 @@
+// Package databasetest provides an in-memory database.MetricsStore for tests
+package databasetest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"preempt/internal/database"
+	"preempt/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a database.MetricsStore backed by slices, so detection and handlers can be
+// exercised without MySQL. It has no bounds checks or rollups; what is added is what is read back.
+type MemoryStore struct {
+	mu          sync.Mutex
+	metrics     []models.Metric
+	forecasts   []models.Metric
+	anomalies   []models.Anomaly
+	suggestions []models.AlarmSuggestion
+	nextID      int64
+
+	populationStdDev bool
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// AddMetrics stores observed metrics, assigning ids to those without one
+func (s *MemoryStore) AddMetrics(metrics ...models.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range metrics {
+		if m.ID == 0 {
+			m.ID = s.newID()
+		}
+		s.metrics = append(s.metrics, m)
+	}
+}
+
+// AddForecastMetrics stores predicted metrics, assigning ids to those without one
+func (s *MemoryStore) AddForecastMetrics(metrics ...models.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range metrics {
+		if m.ID == 0 {
+			m.ID = s.newID()
+		}
+		s.forecasts = append(s.forecasts, m)
+	}
+}
+
+// SetStdDevType picks the standard deviation metric stats report, as DB.SetStdDevType
+func (s *MemoryStore) SetStdDevType(stdDevType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.populationStdDev = stdDevType == "population"
+}
+
+func (s *MemoryStore) newID() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+// GetMetrics returns metrics at a location from since onward, newest first.
+// An empty metricTypes matches every type.
+func (s *MemoryStore) GetMetrics(location string, metricTypes []string, since time.Time) ([]models.Metric, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []models.Metric
+	for _, m := range s.metrics {
+		if m.Location == location && matchesType(m.MetricType, metricTypes) && !m.Timestamp.Before(since) {
+			result = append(result, m)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Timestamp.After(result[j].Timestamp) })
+	return result, nil
+}
+
+// GetForecastMetrics returns predicted metrics at a location within [from, until), oldest first
+func (s *MemoryStore) GetForecastMetrics(location string, metricTypes []string, from, until time.Time) ([]models.Metric, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []models.Metric
+	for _, m := range s.forecasts {
+		if m.Location == location && matchesType(m.MetricType, metricTypes) && !m.Timestamp.Before(from) && m.Timestamp.Before(until) {
+			result = append(result, m)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Timestamp.Before(result[j].Timestamp) })
+	return result, nil
+}
+
+// GetMetricStatsExtended computes the same summary as DB.GetMetricStatsExtended
+func (s *MemoryStore) GetMetricStatsExtended(location string, metricType string, since time.Time) (*database.MetricStats, error) {
+	metrics, err := s.GetMetrics(location, []string{metricType}, since)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats database.MetricStats
+	if len(metrics) == 0 {
+		return &stats, nil
+	}
+
+	stats.Count = len(metrics)
+	stats.Latest = metrics[0].Value // newest first
+	stats.Min, stats.Max = metrics[0].Value, metrics[0].Value
+	sum := 0.0
+	for _, m := range metrics {
+		sum += m.Value
+		stats.Min = math.Min(stats.Min, m.Value)
+		stats.Max = math.Max(stats.Max, m.Value)
+	}
+	stats.Mean = sum / float64(len(metrics))
+
+	variance := 0.0
+	for _, m := range metrics {
+		variance += (m.Value - stats.Mean) * (m.Value - stats.Mean)
+	}
+	s.mu.Lock()
+	divisor := len(metrics) - 1
+	if s.populationStdDev {
+		divisor = len(metrics)
+	}
+	s.mu.Unlock()
+	if divisor > 0 {
+		stats.StdDev = math.Sqrt(variance / float64(divisor))
+	}
+
+	return &stats, nil
+}
+
+// StoreAnomalies appends anomalies, assigning each a new id. One already stored for the same
+// location, metric type, timestamp and method is replaced in place, like the DB upsert.
+func (s *MemoryStore) StoreAnomalies(anomalies []models.Anomaly) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range anomalies {
+		if i := s.anomalyIndex(a); i >= 0 {
+			a.ID = s.anomalies[i].ID
+			s.anomalies[i] = a
+			continue
+		}
+		a.ID = s.newID()
+		s.anomalies = append(s.anomalies, a)
+	}
+	return nil
+}
+
+// anomalyIndex finds the stored anomaly for the same reading and method, -1 if none
+func (s *MemoryStore) anomalyIndex(a models.Anomaly) int {
+	for i, existing := range s.anomalies {
+		if existing.Location == a.Location && existing.MetricType == a.MetricType &&
+			existing.Timestamp.Equal(a.Timestamp) && existing.Method == a.Method {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetAnomalies returns up to limit anomalies at a location, newest first
+func (s *MemoryStore) GetAnomalies(location string, limit int) ([]models.Anomaly, error) {
+	anomalies, err := s.GetAnomaliesSince(location, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	if limit >= 0 && len(anomalies) > limit {
+		anomalies = anomalies[:limit]
+	}
+	return anomalies, nil
+}
+
+// GetAnomaliesSince returns every anomaly at a location from since onward, newest first
+func (s *MemoryStore) GetAnomaliesSince(location string, since time.Time) ([]models.Anomaly, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []models.Anomaly
+	for _, a := range s.anomalies {
+		if a.Location == location && !a.Timestamp.Before(since) {
+			result = append(result, a)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Timestamp.After(result[j].Timestamp) })
+	return result, nil
+}
+
+// GetAnomaliesByMethod pages through anomalies of one method within [from, until) by id, as DB does
+func (s *MemoryStore) GetAnomaliesByMethod(ctx context.Context, method string, from, until time.Time, afterID int64, limit int) ([]models.Anomaly, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []models.Anomaly
+	for _, a := range s.anomalies {
+		if a.Method == method && !a.Timestamp.Before(from) && a.Timestamp.Before(until) && a.ID > afterID {
+			result = append(result, a)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// UpdateAnomalySeverities sets the severity of each anomaly id, failing on unknown ids
+func (s *MemoryStore) UpdateAnomalySeverities(ctx context.Context, severities map[int64]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := make(map[int64]int, len(s.anomalies))
+	for i, a := range s.anomalies {
+		index[a.ID] = i
+	}
+	for id, severity := range severities {
+		i, ok := index[id]
+		if !ok {
+			return fmt.Errorf("failed to update severity for anomaly %d: not found", id)
+		}
+		s.anomalies[i].Severity = severity
+	}
+	return nil
+}
+
+// StoreAlarmSuggestion replaces the suggestion for the same location and metric type, like the DB upsert
+func (s *MemoryStore) StoreAlarmSuggestion(suggestion *models.AlarmSuggestion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *suggestion
+	for i, existing := range s.suggestions {
+		if existing.Location == stored.Location && existing.MetricType == stored.MetricType {
+			stored.ID = existing.ID
+			s.suggestions[i] = stored
+			return nil
+		}
+	}
+	stored.ID = s.newID()
+	s.suggestions = append(s.suggestions, stored)
+	return nil
+}
+
+// GetAlarmSuggestions returns up to limit suggestions at a location, most confident first
+func (s *MemoryStore) GetAlarmSuggestions(location string, limit int) ([]models.AlarmSuggestion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []models.AlarmSuggestion
+	for _, sg := range s.suggestions {
+		if sg.Location == location {
+			result = append(result, sg)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Confidence != result[j].Confidence {
+			return result[i].Confidence > result[j].Confidence
+		}
+		return result[i].SuggestedAt.After(result[j].SuggestedAt)
+	})
+	if limit >= 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// matchesType reports whether metricType is in metricTypes, with an empty list matching all
+func matchesType(metricType string, metricTypes []string) bool {
+	if len(metricTypes) == 0 {
+		return true
+	}
+	for _, mt := range metricTypes {
+		if mt == metricType {
+			return true
+		}
+	}
+	return false
+}
+
+var _ database.MetricsStore = (*MemoryStore)(nil)
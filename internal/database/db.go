@@ -1,12 +1,17 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"preempt/internal/api"
+	"preempt/internal/clock"
 	"preempt/internal/metrics"
 	"preempt/internal/models"
+	"preempt/internal/retry"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -15,6 +20,45 @@ import (
 // DB represents the database connection
 type DB struct {
 	conn *sql.DB
+
+	// Age after which raw metrics only exist in the rollup tables, zero when rollups aren't read
+	rollupHourlyAfter time.Duration
+	rollupDailyAfter  time.Duration
+
+	// Plausible value range per metric type, values outside are rejected at ingestion
+	valueBounds map[string]ValueBounds
+
+	clock clock.Clock
+
+	batchSize int // rows per multi-row INSERT (hourly store) or per commit (location import)
+
+	populationStdDev bool // metric stats use STDDEV_POP instead of STDDEV_SAMP
+
+	// Unit of each location's metric series (keyed by location and metric type) already checked
+	// or stored by this process, so every store doesn't have to look it up
+	unitsMu sync.Mutex
+	units   map[string]string
+}
+
+// defaultBatchSize keeps statements and transactions well below InnoDB redo log limits
+const defaultBatchSize = 500
+
+// ValueBounds is the inclusive range of values accepted for a metric type
+type ValueBounds struct {
+	Min float64
+	Max float64
+}
+
+// defaultValueBounds are generous physical limits that hold in either unit system
+var defaultValueBounds = map[string]ValueBounds{
+	"temperature_2m":       {Min: -100, Max: 150},
+	"relative_humidity_2m": {Min: 0, Max: 100},
+	"precipitation":        {Min: 0, Max: 500},
+	"wind_speed_10m":       {Min: 0, Max: 500},
+	"dew_point_2m":         {Min: -100, Max: 150},
+	"apparent_temperature": {Min: -100, Max: 150},
+	"surface_pressure":     {Min: 300, Max: 1100}, // hPa
+	"cloud_cover":          {Min: 0, Max: 100},    // %
 }
 
 // NewDB creates a new database connection and initializes the schema
@@ -26,8 +70,18 @@ func NewDB(dsn string) (*DB, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Test connection
-	if err := conn.Ping(); err != nil {
+	// Test connection, retrying while the database is still starting up
+	policy := retry.DefaultPolicy()
+	policy.MaxAttempts = 5
+	err = retry.Do(context.Background(), policy, func() error {
+		if pingErr := conn.Ping(); pingErr != nil {
+			log.Printf("Database ping failed: %v", pingErr)
+			return pingErr
+		}
+		return nil
+	})
+	if err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
@@ -36,7 +90,7 @@ func NewDB(dsn string) (*DB, error) {
 	conn.SetMaxIdleConns(5)
 	conn.SetConnMaxLifetime(5 * time.Minute)
 
-	db := &DB{conn: conn}
+	db := NewFromConn(conn)
 
 	// Initialize schema
 	if err := db.initSchema(); err != nil {
@@ -46,6 +100,61 @@ func NewDB(dsn string) (*DB, error) {
 	return db, nil
 }
 
+// NewFromConn wraps an open connection without pinging it or creating the schema,
+// e.g. a sqlmock connection in tests
+func NewFromConn(conn *sql.DB) *DB {
+	db := &DB{conn: conn, valueBounds: make(map[string]ValueBounds), clock: clock.Real{}, batchSize: defaultBatchSize, units: make(map[string]string)}
+	for metricType, bounds := range defaultValueBounds {
+		db.valueBounds[metricType] = bounds
+	}
+	return db
+}
+
+// SetClock replaces the clock used to timestamp current metrics and forecasts
+func (db *DB) SetClock(c clock.Clock) {
+	db.clock = c
+}
+
+// SetBatchSize sets how many rows bulk writes group together, values below 1 are ignored
+func (db *DB) SetBatchSize(n int) {
+	if n > 0 {
+		db.batchSize = n
+	}
+}
+
+// SetStdDevType picks the standard deviation metric stats report, "sample" (the default) or
+// "population", matching the detector's detection.stddev_type
+func (db *DB) SetStdDevType(stdDevType string) {
+	db.populationStdDev = stdDevType == "population"
+}
+
+// stdDevFunc is the SQL aggregate for the configured standard deviation type
+func (db *DB) stdDevFunc() string {
+	if db.populationStdDev {
+		return "STDDEV_POP"
+	}
+	return "STDDEV_SAMP"
+}
+
+// SetValueBounds overrides the accepted value range for the given metric types
+func (db *DB) SetValueBounds(bounds map[string]ValueBounds) {
+	for metricType, b := range bounds {
+		db.valueBounds[metricType] = b
+	}
+}
+
+// inBounds reports whether value is plausible for metricType, logging the rejection if not.
+// Metric types without bounds are always accepted.
+func (db *DB) inBounds(location, metricType string, value float64) bool {
+	bounds, ok := db.valueBounds[metricType]
+	if !ok || (value >= bounds.Min && value <= bounds.Max) {
+		return true
+	}
+	log.Printf("Rejected %s=%.2f for %s: outside plausible range [%.2f, %.2f]",
+		metricType, value, location, bounds.Min, bounds.Max)
+	return false
+}
+
 // initSchema creates the necessary tables
 func (db *DB) initSchema() error {
 	// MySQL doesn't support multiple statements in one Exec, so we need to split them
@@ -56,9 +165,10 @@ func (db *DB) initSchema() error {
 			timestamp DATETIME(6) NOT NULL,
 			metric_type VARCHAR(100) NOT NULL,
 			value DOUBLE NOT NULL,
+			unit VARCHAR(20) NOT NULL DEFAULT '',
 			INDEX idx_metrics_timestamp (timestamp),
 			INDEX idx_metrics_type (metric_type),
-			INDEX idx_metrics_location (location)
+			INDEX idx_metrics_location_type_time (location, metric_type, timestamp)
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
 
 		`CREATE TABLE IF NOT EXISTS anomalies (
@@ -69,9 +179,14 @@ func (db *DB) initSchema() error {
 			value DOUBLE NOT NULL,
 			z_score DOUBLE NOT NULL,
 			severity VARCHAR(50) NOT NULL,
+			method VARCHAR(20) NOT NULL DEFAULT '',
+			baseline_mean DOUBLE NULL,
+			baseline_stddev DOUBLE NULL,
+			threshold DOUBLE NULL,
 			INDEX idx_anomalies_timestamp (timestamp),
 			INDEX idx_anomalies_type (metric_type),
-			INDEX idx_anomalies_location (location)
+			INDEX idx_anomalies_location_type_time (location, metric_type, timestamp),
+			UNIQUE KEY unique_anomaly_series_time_method (location, metric_type, timestamp, method)
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
 
 		`CREATE TABLE IF NOT EXISTS alarm_suggestions (
@@ -84,10 +199,53 @@ func (db *DB) initSchema() error {
 			confidence DOUBLE NOT NULL,
 			description TEXT NOT NULL,
 			anomaly_count INT NOT NULL,
-			INDEX idx_alarm_suggestions_location (location)
+			INDEX idx_alarm_suggestions_location (location),
+			UNIQUE KEY unique_alarm_suggestion_location_metric (location, metric_type)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		`CREATE TABLE IF NOT EXISTS anomaly_events (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			location VARCHAR(255) NOT NULL DEFAULT '',
+			metric_type VARCHAR(100) NOT NULL,
+			start_time DATETIME(6) NOT NULL,
+			end_time DATETIME(6) NOT NULL,
+			peak_value DOUBLE NOT NULL,
+			peak_z_score DOUBLE NOT NULL,
+			severity VARCHAR(50) NOT NULL,
+			anomaly_count INT NOT NULL,
+			min_value DOUBLE NOT NULL DEFAULT 0,
+			max_value DOUBLE NOT NULL DEFAULT 0,
+			INDEX idx_anomaly_events_location_start (location, start_time),
+			UNIQUE KEY unique_anomaly_event_series_start (location, metric_type, start_time)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		`CREATE TABLE IF NOT EXISTS forecast_metrics (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			location VARCHAR(255) NOT NULL DEFAULT '',
+			timestamp DATETIME(6) NOT NULL,
+			metric_type VARCHAR(100) NOT NULL,
+			value DOUBLE NOT NULL,
+			fetched_at DATETIME(6) NOT NULL,
+			INDEX idx_forecast_metrics_location_timestamp (location, timestamp)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+		`CREATE TABLE IF NOT EXISTS raw_forecasts (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			location VARCHAR(255) NOT NULL,
+			data_type VARCHAR(20) NOT NULL,
+			fetched_at DATETIME(6) NOT NULL,
+			payload JSON NOT NULL,
+			INDEX idx_raw_forecasts_location_fetched (location, fetched_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		`CREATE TABLE IF NOT EXISTS detection_watermarks (
+			location VARCHAR(255) NOT NULL PRIMARY KEY,
+			last_metric_at DATETIME(6) NOT NULL,
+			detected_at DATETIME(6) NOT NULL
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
 	}
 
+	statements = append(statements, rollupTables...)
+
 	for _, stmt := range statements {
 		if _, err := db.conn.Exec(stmt); err != nil {
 			return fmt.Errorf("failed to execute schema statement: %w", err)
@@ -99,6 +257,7 @@ func (db *DB) initSchema() error {
 
 // StoreMetrics stores all current metrics from the forecast
 func (db *DB) StoreMetrics(forecast *models.Forecast, location string, fields []string, isInitial bool) error {
+	fields = normalizeMetricTypes(fields)
 	if isInitial {
 		return db.storeHourlyMetrics(forecast, location, fields)
 	}
@@ -112,60 +271,166 @@ func (db *DB) storeHourlyMetrics(forecast *models.Forecast, location string, fie
 
 	timestamps := forecast.Hourly.Time
 
-	fieldData := map[string][]float64{
-		"temperature_2m":       forecast.Hourly.Temperature2m,
-		"relative_humidity_2m": forecast.Hourly.RelativeHumidity2m,
-		"precipitation":        forecast.Hourly.Precipitation,
-		"wind_speed_10m":       forecast.Hourly.WindSpeed10m,
-		"dew_point_2m":         forecast.Hourly.DewPoint2m,
+	fieldData := hourlyFieldData(forecast)
+	fieldUnits := hourlyFieldUnits(forecast)
+
+	// All or nothing: a partial backfill would make GetLocationsWithData report the location
+	// as having data, and the collector would never retry the historical fetch
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Rows are sent batchSize at a time as multi-row INSERTs, the commit stays single
+	batch := make([]interface{}, 0, 5*db.batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		rows := len(batch) / 5
+		query := `INSERT INTO metrics (location, timestamp, metric_type, value, unit) VALUES ` +
+			strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?),", rows), ",")
+		queryStart := time.Now()
+		_, err := tx.Exec(query, batch...)
+		metrics.RecordDBQuery("INSERT", "metrics", time.Since(queryStart), err)
+		if err != nil {
+			return fmt.Errorf("failed to store %d hourly metrics: %w", rows, err)
+		}
+		batch = batch[:0]
+		return nil
 	}
 
 	for _, fieldName := range fields {
 		values, exists := fieldData[fieldName]
 		if !exists {
 			log.Printf("Warning: field %s not found in hourly data", fieldName)
+			metrics.RecordFieldSkipped(fieldName, "not_found")
 			continue
 		}
 
 		if len(values) == 0 {
 			log.Printf("Skipping %s - no hourly data", fieldName)
+			metrics.RecordFieldSkipped(fieldName, "nil")
 			continue
 		}
 
 		if len(values) != len(timestamps) {
 			log.Printf("Warning: %s has %d values but %d timestamps",
 				fieldName, len(values), len(timestamps))
+			metrics.RecordFieldSkipped(fieldName, "length_mismatch")
+			continue
+		}
+
+		unit := fieldUnits[fieldName]
+		ok, err := db.unitMatches(location, fieldName, unit)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			metrics.RecordFieldSkipped(fieldName, "unit_mismatch")
 			continue
 		}
 
 		for i, value := range values {
-			timestamp, err := time.Parse("2006-01-02T15:04", timestamps[i])
+			timestamp, err := time.Parse(hourlyTimeLayout, timestamps[i])
 			if err != nil {
 				log.Printf("Failed to parse timestamp %s: %v", timestamps[i], err)
 				continue
 			}
 
-			query := `INSERT INTO metrics (location, timestamp, metric_type, value) VALUES (?, ?, ?, ?)`
-			queryStart := time.Now()
-			_, err = db.conn.Exec(query, location, timestamp, fieldName, value)
-			metrics.RecordDBQuery("INSERT", "metrics", time.Since(queryStart), err)
-			if err != nil {
-				return fmt.Errorf("failed to store hourly metric %s at %s: %w",
-					fieldName, timestamps[i], err)
+			if !db.inBounds(location, fieldName, value) {
+				continue
+			}
+
+			batch = append(batch, location, timestamp, fieldName, value, unit)
+			if len(batch) == 5*db.batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
 			}
 		}
 	}
 
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit hourly metrics for %s: %w", location, err)
+	}
+
 	return nil
 }
 
+// skipReason labels why a field's hourly series couldn't be stored against the forecast timestamps
+func skipReason(values []float64, exists bool) string {
+	switch {
+	case !exists:
+		return "not_found"
+	case len(values) == 0:
+		return "nil"
+	default:
+		return "length_mismatch"
+	}
+}
+
+// metricTypeFilter builds the WHERE condition restricting a query to metricTypes and its arguments.
+// An empty list adds no condition (every type) rather than an invalid "IN ()".
+func metricTypeFilter(metricTypes []string) (string, []interface{}) {
+	switch len(metricTypes) {
+	case 0:
+		return "", nil
+	case 1:
+		return " AND metric_type = ?", []interface{}{metricTypes[0]}
+	}
+
+	args := make([]interface{}, len(metricTypes))
+	for i, mt := range metricTypes {
+		args[i] = mt
+	}
+	return " AND metric_type IN (" + strings.TrimSuffix(strings.Repeat("?,", len(metricTypes)), ",") + ")", args
+}
+
+// normalizeMetricTypes canonicalizes metric types before they are written and drops unknown ones,
+// so a stray space or capital never creates a parallel metric type that config won't match
+func normalizeMetricTypes(fields []string) []string {
+	var normalized []string
+	for _, field := range fields {
+		canonical := api.NormalizeField(field)
+		if !api.IsSupportedField(canonical) {
+			log.Printf("Warning: rejecting unknown metric type %q", field)
+			continue
+		}
+		normalized = append(normalized, canonical)
+	}
+	return normalized
+}
+
+// hourlyTimeLayout is the timestamp format Open-Meteo uses for hourly data
+const hourlyTimeLayout = "2006-01-02T15:04"
+
+// hourlyFieldData maps each supported field name to its hourly series
+func hourlyFieldData(forecast *models.Forecast) map[string][]float64 {
+	return map[string][]float64{
+		"temperature_2m":       forecast.Hourly.Temperature2m,
+		"relative_humidity_2m": forecast.Hourly.RelativeHumidity2m,
+		"precipitation":        forecast.Hourly.Precipitation,
+		"wind_speed_10m":       forecast.Hourly.WindSpeed10m,
+		"dew_point_2m":         forecast.Hourly.DewPoint2m,
+		"apparent_temperature": forecast.Hourly.ApparentTemperature,
+		"surface_pressure":     forecast.Hourly.SurfacePressure,
+		"cloud_cover":          forecast.Hourly.CloudCover,
+	}
+}
+
 func (db *DB) storeCurrentMetrics(forecast *models.Forecast, location string, fields []string) error {
 	defer func() {
 		stats := db.conn.Stats()
 		metrics.UpdateDBConnectionStats(stats.OpenConnections, stats.InUse, stats.Idle)
 	}()
 
-	now := time.Now()
+	now := db.clock.Now()
 
 	fieldData := map[string]*float64{
 		"temperature_2m":       forecast.Current.Temperature2m,
@@ -173,24 +438,44 @@ func (db *DB) storeCurrentMetrics(forecast *models.Forecast, location string, fi
 		"precipitation":        forecast.Current.Precipitation,
 		"wind_speed_10m":       forecast.Current.WindSpeed10m,
 		"dew_point_2m":         forecast.Current.DewPoint2m,
+		"apparent_temperature": forecast.Current.ApparentTemperature,
+		"surface_pressure":     forecast.Current.SurfacePressure,
+		"cloud_cover":          forecast.Current.CloudCover,
 	}
+	fieldUnits := currentFieldUnits(forecast)
 
 	storedCount := 0
 	for _, fieldName := range fields {
 		value, exists := fieldData[fieldName]
 		if !exists {
 			log.Printf("Warning: field %s not found in current data", fieldName)
+			metrics.RecordFieldSkipped(fieldName, "not_found")
 			continue
 		}
 
 		if value == nil {
 			log.Printf("Skipping %s - no current data", fieldName)
+			metrics.RecordFieldSkipped(fieldName, "nil")
+			continue
+		}
+
+		if !db.inBounds(location, fieldName, *value) {
+			continue
+		}
+
+		unit := fieldUnits[fieldName]
+		ok, err := db.unitMatches(location, fieldName, unit)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			metrics.RecordFieldSkipped(fieldName, "unit_mismatch")
 			continue
 		}
 
-		query := `INSERT INTO metrics (location, timestamp, metric_type, value) VALUES (?, ?, ?, ?)`
+		query := `INSERT INTO metrics (location, timestamp, metric_type, value, unit) VALUES (?, ?, ?, ?, ?)`
 		queryStart := time.Now()
-		_, err := db.conn.Exec(query, location, now, fieldName, *value)
+		_, err = db.conn.Exec(query, location, now, fieldName, *value, unit)
 		metrics.RecordDBQuery("INSERT", "metrics", time.Since(queryStart), err)
 		if err != nil {
 			return fmt.Errorf("failed to store current metric %s: %w", fieldName, err)
@@ -202,6 +487,141 @@ func (db *DB) storeCurrentMetrics(forecast *models.Forecast, location string, fi
 	return nil
 }
 
+// StoreForecastMetrics replaces the stored predictions for a location with the hourly series in forecast.
+// Only future points are kept, and the previous predictions from that point onward are discarded
+// in the same transaction so readers never see a mix of old and new forecasts.
+func (db *DB) StoreForecastMetrics(forecast *models.Forecast, location string, fields []string) error {
+	fields = normalizeMetricTypes(fields)
+	if len(forecast.Hourly.Time) == 0 {
+		return fmt.Errorf("no hourly data in forecast")
+	}
+
+	now := db.clock.Now()
+	timestamps := forecast.Hourly.Time
+	fieldData := hourlyFieldData(forecast)
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Will be ignored if committed
+
+	queryStart := time.Now()
+	_, err = tx.Exec(`DELETE FROM forecast_metrics WHERE location = ?`, location)
+	metrics.RecordDBQuery("DELETE", "forecast_metrics", time.Since(queryStart), err)
+	if err != nil {
+		return fmt.Errorf("failed to clear previous forecast for %s: %w", location, err)
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO forecast_metrics (location, timestamp, metric_type, value, fetched_at) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	storedCount := 0
+	for _, fieldName := range fields {
+		values, exists := fieldData[fieldName]
+		if !exists || len(values) != len(timestamps) {
+			log.Printf("Skipping forecast for %s - missing or mismatched hourly data", fieldName)
+			metrics.RecordFieldSkipped(fieldName, skipReason(values, exists))
+			continue
+		}
+
+		for i, value := range values {
+			timestamp, err := time.Parse(hourlyTimeLayout, timestamps[i])
+			if err != nil {
+				log.Printf("Failed to parse timestamp %s: %v", timestamps[i], err)
+				continue
+			}
+
+			if timestamp.Before(now) {
+				continue // Already observed, the metrics table covers it
+			}
+
+			if _, err := stmt.Exec(location, timestamp, fieldName, value, now); err != nil {
+				return fmt.Errorf("failed to store forecast metric %s at %s: %w", fieldName, timestamps[i], err)
+			}
+			storedCount++
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("✓ Stored %d forecast metrics for %s", storedCount, location)
+	return nil
+}
+
+// GetForecastMetrics retrieves predicted metrics for a location between from and until, ordered by timestamp.
+// An empty metricTypes returns every metric type.
+func (db *DB) GetForecastMetrics(location string, metricTypes []string, from, until time.Time) ([]models.Metric, error) {
+	typeFilter, typeArgs := metricTypeFilter(metricTypes)
+	args := append([]interface{}{location}, typeArgs...)
+	args = append(args, from, until)
+
+	query := `SELECT id, location, timestamp, metric_type, value FROM forecast_metrics WHERE location = ?` + typeFilter +
+		` AND timestamp >= ? AND timestamp < ? ORDER BY timestamp`
+
+	queryStart := time.Now()
+	rows, err := db.conn.Query(query, args...)
+	metrics.RecordDBQuery("SELECT", "forecast_metrics", time.Since(queryStart), err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query forecast metrics: %w", err)
+	}
+	defer rows.Close()
+
+	var forecastMetrics []models.Metric
+	for rows.Next() {
+		var m models.Metric
+		if err := rows.Scan(&m.ID, &m.Location, &m.Timestamp, &m.MetricType, &m.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan forecast metric: %w", err)
+		}
+		forecastMetrics = append(forecastMetrics, m)
+	}
+
+	return forecastMetrics, rows.Err()
+}
+
+// GetForecastFetchTimes returns when each location's forecast was last stored
+func (db *DB) GetForecastFetchTimes() (map[string]time.Time, error) {
+	rows, err := db.conn.Query(`SELECT location, MAX(fetched_at) FROM forecast_metrics GROUP BY location`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get forecast fetch times: %w", err)
+	}
+	defer rows.Close()
+
+	fetchTimes := make(map[string]time.Time)
+	for rows.Next() {
+		var location string
+		var fetchedAt time.Time
+		if err := rows.Scan(&location, &fetchedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan forecast fetch time: %w", err)
+		}
+		fetchTimes[location] = fetchedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating forecast fetch times: %w", err)
+	}
+
+	return fetchTimes, nil
+}
+
+// insertAnomalyQuery stores an anomaly, or rescores the stored one when the same reading or
+// prediction was already flagged by the same method. Every run detects its whole window again,
+// and a prediction's value changes with each forecast refresh.
+const insertAnomalyQuery = `INSERT INTO anomalies (location, timestamp, metric_type, value, z_score, severity, method, baseline_mean, baseline_stddev, threshold)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+	value = VALUES(value),
+	z_score = VALUES(z_score),
+	severity = VALUES(severity),
+	baseline_mean = VALUES(baseline_mean),
+	baseline_stddev = VALUES(baseline_stddev),
+	threshold = VALUES(threshold)`
+
 // StoreAnomaly stores a detected anomaly
 func (db *DB) StoreAnomaly(anomaly *models.Anomaly) error {
 	queryStart := time.Now()
@@ -210,8 +630,8 @@ func (db *DB) StoreAnomaly(anomaly *models.Anomaly) error {
 		metrics.UpdateDBConnectionStats(stats.OpenConnections, stats.InUse, stats.Idle)
 	}()
 
-	query := `INSERT INTO anomalies (location, timestamp, metric_type, value, z_score, severity) VALUES (?, ?, ?, ?, ?, ?)`
-	_, err := db.conn.Exec(query, anomaly.Location, anomaly.Timestamp, anomaly.MetricType, anomaly.Value, anomaly.ZScore, anomaly.Severity)
+	_, err := db.conn.Exec(insertAnomalyQuery, anomaly.Location, anomaly.Timestamp, anomaly.MetricType, anomaly.Value, anomaly.ZScore, anomaly.Severity, anomaly.Method,
+		anomaly.BaselineMean, anomaly.BaselineStdDev, anomaly.Threshold)
 	metrics.RecordDBQuery("INSERT", "anomalies", time.Since(queryStart), err)
 	return err
 }
@@ -230,7 +650,7 @@ func (db *DB) StoreAnomalies(anomalies []models.Anomaly) error {
 	defer tx.Rollback() // Will be ignored if committed
 
 	// Prepare statement
-	stmt, err := tx.Prepare(`INSERT INTO anomalies (location, timestamp, metric_type, value, z_score, severity) VALUES (?, ?, ?, ?, ?, ?)`)
+	stmt, err := tx.Prepare(insertAnomalyQuery)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
@@ -238,7 +658,8 @@ func (db *DB) StoreAnomalies(anomalies []models.Anomaly) error {
 
 	// Insert each anomaly
 	for _, anomaly := range anomalies {
-		_, err = stmt.Exec(anomaly.Location, anomaly.Timestamp, anomaly.MetricType, anomaly.Value, anomaly.ZScore, anomaly.Severity)
+		_, err = stmt.Exec(anomaly.Location, anomaly.Timestamp, anomaly.MetricType, anomaly.Value, anomaly.ZScore, anomaly.Severity, anomaly.Method,
+			anomaly.BaselineMean, anomaly.BaselineStdDev, anomaly.Threshold)
 		if err != nil {
 			return fmt.Errorf("failed to insert anomaly for %s at %s: %w", anomaly.MetricType, anomaly.Timestamp, err)
 		}
@@ -253,86 +674,400 @@ func (db *DB) StoreAnomalies(anomalies []models.Anomaly) error {
 	return nil
 }
 
-// StoreAlarmSuggestion stores an alarm suggestion
+// StoreAnomalyEvents stores clustered anomaly events in a single transaction. Every run clusters
+// its whole detection window again, so an event already stored for the same location, metric
+// type and start time is widened to cover both instead of being added twice.
+func (db *DB) StoreAnomalyEvents(events []models.AnomalyEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Will be ignored if committed
+
+	// peak_value is assigned before peak_z_score so it still compares against the stored peak
+	stmt, err := tx.Prepare(`INSERT INTO anomaly_events (location, metric_type, start_time, end_time, peak_value, peak_z_score, severity, anomaly_count, min_value, max_value)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	          ON DUPLICATE KEY UPDATE
+	          end_time = GREATEST(end_time, VALUES(end_time)),
+	          peak_value = IF(ABS(VALUES(peak_z_score)) > ABS(peak_z_score), VALUES(peak_value), peak_value),
+	          peak_z_score = IF(ABS(VALUES(peak_z_score)) > ABS(peak_z_score), VALUES(peak_z_score), peak_z_score),
+	          severity = IF(FIELD(VALUES(severity), 'low', 'medium', 'high') > FIELD(severity, 'low', 'medium', 'high'), VALUES(severity), severity),
+	          anomaly_count = GREATEST(anomaly_count, VALUES(anomaly_count)),
+	          min_value = LEAST(min_value, VALUES(min_value)),
+	          max_value = GREATEST(max_value, VALUES(max_value))`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, e := range events {
+		_, err = stmt.Exec(e.Location, e.MetricType, e.StartTime, e.EndTime, e.PeakValue, e.PeakZScore, e.Severity, e.AnomalyCount, e.MinValue, e.MaxValue)
+		if err != nil {
+			return fmt.Errorf("failed to insert anomaly event for %s at %s: %w", e.MetricType, e.StartTime, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("✓ Stored %d anomaly events", len(events))
+	return nil
+}
+
+// GetAnomalyEvents retrieves recent anomaly events for a specific location
+func (db *DB) GetAnomalyEvents(location string, limit int) ([]models.AnomalyEvent, error) {
+	query := `SELECT id, location, metric_type, start_time, end_time, peak_value, peak_z_score, severity, anomaly_count, min_value, max_value FROM anomaly_events WHERE location = ? ORDER BY start_time DESC LIMIT ?`
+	rows, err := db.conn.Query(query, location, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.AnomalyEvent
+	for rows.Next() {
+		var e models.AnomalyEvent
+		if err := rows.Scan(&e.ID, &e.Location, &e.MetricType, &e.StartTime, &e.EndTime, &e.PeakValue, &e.PeakZScore, &e.Severity, &e.AnomalyCount, &e.MinValue, &e.MaxValue); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// StoreAlarmSuggestion stores an alarm suggestion, replacing any existing suggestion
+// for the same location and metric type so each location keeps one current suggestion per metric
 func (db *DB) StoreAlarmSuggestion(suggestion *models.AlarmSuggestion) error {
 	query := `INSERT INTO alarm_suggestions (location, metric_type, threshold, operator, suggested_at, confidence, description, anomaly_count) 
-	          VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	          ON DUPLICATE KEY UPDATE
+	              threshold = VALUES(threshold),
+	              operator = VALUES(operator),
+	              suggested_at = VALUES(suggested_at),
+	              confidence = VALUES(confidence),
+	              description = VALUES(description),
+	              anomaly_count = VALUES(anomaly_count)`
+	queryStart := time.Now()
 	_, err := db.conn.Exec(query, suggestion.Location, suggestion.MetricType, suggestion.Threshold, suggestion.Operator, suggestion.SuggestedAt,
 		suggestion.Confidence, suggestion.Description, suggestion.AnomalyCount)
+	metrics.RecordDBQuery("UPSERT", "alarm_suggestions", time.Since(queryStart), err)
 	return err
 }
 
 // GetMetrics retrieves metrics for a given time range, location, and metric types
 // If metricTypes is empty or nil, returns all metric types for the location
 func (db *DB) GetMetrics(location string, metricTypes []string, since time.Time) ([]models.Metric, error) {
-	var query string
-	var rows *sql.Rows
-	var err error
+	return db.getMetrics(location, metricTypes, since, false)
+}
 
-	if len(metricTypes) == 1 {
-		// Get single specific metric type
-		query = `SELECT id, location, timestamp, metric_type, value FROM metrics WHERE location = ? AND metric_type = ? AND timestamp >= ? ORDER BY timestamp DESC`
-		rows, err = db.conn.Query(query, location, metricTypes[0], since)
-	} else {
-		// Get multiple metric types using IN clause
-		// Build placeholders: (?, ?, ?)
-		placeholders := make([]string, len(metricTypes))
-		for i := range placeholders {
-			placeholders[i] = "?"
+// GetMetricsAsc is GetMetrics in chronological (oldest first) order, as charts and time-series code expect
+func (db *DB) GetMetricsAsc(location string, metricTypes []string, since time.Time) ([]models.Metric, error) {
+	return db.getMetrics(location, metricTypes, since, true)
+}
+
+func (db *DB) getMetrics(location string, metricTypes []string, since time.Time, ascending bool) ([]models.Metric, error) {
+	order := "DESC"
+	if ascending {
+		order = "ASC"
+	}
+
+	typeFilter, typeArgs := metricTypeFilter(metricTypes)
+	args := append([]interface{}{location}, typeArgs...)
+	args = append(args, since)
+
+	query := `SELECT id, location, timestamp, metric_type, value, unit FROM metrics WHERE location = ?` + typeFilter +
+		` AND timestamp >= ? ORDER BY timestamp ` + order
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []models.Metric
+	for rows.Next() {
+		var m models.Metric
+		if err := rows.Scan(&m.ID, &m.Location, &m.Timestamp, &m.MetricType, &m.Value, &m.Unit); err != nil {
+			return nil, err
 		}
+		metrics = append(metrics, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		query = fmt.Sprintf(
-			`SELECT id, location, timestamp, metric_type, value FROM metrics WHERE location = ? AND metric_type IN (%s) AND timestamp >= ? ORDER BY timestamp DESC`,
-			strings.Join(placeholders, ","),
-		)
+	// Ranges reaching past raw retention continue into the (older) rollup tables
+	rolledUp, err := db.getRollupMetrics(location, metricTypes, since)
+	if err != nil {
+		return nil, err
+	}
 
-		// Build args: [location, type1, type2, type3, since]
-		args := make([]interface{}, len(metricTypes)+2)
-		args[0] = location
-		for i, mt := range metricTypes {
-			args[i+1] = mt
+	if ascending {
+		// Rollups come back newest first and predate every raw row
+		for i, j := 0, len(rolledUp)-1; i < j; i, j = i+1, j-1 {
+			rolledUp[i], rolledUp[j] = rolledUp[j], rolledUp[i]
 		}
-		args[len(metricTypes)+1] = since
+		return append(rolledUp, metrics...), nil
+	}
 
-		rows, err = db.conn.Query(query, args...)
+	return append(metrics, rolledUp...), nil
+}
+
+// GetMetricsWithLocation is GetMetrics with the location's coordinates attached to every metric
+func (db *DB) GetMetricsWithLocation(location string, metricTypes []string, since time.Time) ([]models.LocatedMetric, error) {
+	loc, err := db.GetLocationByName(location)
+	if err != nil {
+		return nil, err
 	}
 
+	metrics, err := db.GetMetrics(location, metricTypes, since)
 	if err != nil {
 		return nil, err
 	}
+
+	located := make([]models.LocatedMetric, len(metrics))
+	for i, m := range metrics {
+		located[i] = models.LocatedMetric{Metric: m, Latitude: loc.Latitude, Longitude: loc.Longitude}
+	}
+	return located, nil
+}
+
+// GetMetricsPage returns up to limit metrics of one type starting at offset, in GetMetrics' order
+// (raw readings newest first, then the hourly and daily rollups), and how many there are in total.
+// Paging happens in MySQL so a long window isn't loaded whole to serve a single page.
+func (db *DB) GetMetricsPage(location, metricType string, since time.Time, offset, limit int) ([]models.Metric, int, error) {
+	union, args := db.metricsPageUnion(location, metricType, since)
+
+	var total int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM (`+union+`) m`, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count %s metrics: %w", metricType, err)
+	}
+	if offset >= total {
+		return nil, total, nil
+	}
+
+	query := `SELECT id, location, timestamp, metric_type, value, unit FROM (` + union + `) m ORDER BY tier, timestamp DESC LIMIT ? OFFSET ?`
+	rows, err := db.conn.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query %s metrics: %w", metricType, err)
+	}
 	defer rows.Close()
 
-	var metrics []models.Metric
+	var page []models.Metric
 	for rows.Next() {
 		var m models.Metric
-		if err := rows.Scan(&m.ID, &m.Location, &m.Timestamp, &m.MetricType, &m.Value); err != nil {
+		if err := rows.Scan(&m.ID, &m.Location, &m.Timestamp, &m.MetricType, &m.Value, &m.Unit); err != nil {
+			return nil, 0, err
+		}
+		page = append(page, m)
+	}
+	return page, total, rows.Err()
+}
+
+// metricsPageUnion selects one metric type's raw readings and rollup means since a time, each
+// table's rows tagged with a tier that keeps them together in the order GetMetrics concatenates them
+func (db *DB) metricsPageUnion(location, metricType string, since time.Time) (string, []interface{}) {
+	parts := []string{`SELECT 0 AS tier, id, location, timestamp, metric_type, value, unit FROM metrics WHERE location = ? AND metric_type = ? AND timestamp >= ?`}
+	args := []interface{}{location, metricType, since}
+	for i, table := range db.rollupTables(since) {
+		parts = append(parts, fmt.Sprintf(
+			`SELECT %d, 0, location, bucket_start, metric_type, mean, '' FROM %s WHERE location = ? AND metric_type = ? AND bucket_start >= ?`,
+			i+1, table,
+		))
+		args = append(args, location, metricType, since)
+	}
+	return strings.Join(parts, " UNION ALL "), args
+}
+
+// GetMetricsPageWithLocation is GetMetricsPage with the location's coordinates attached to every metric
+func (db *DB) GetMetricsPageWithLocation(location, metricType string, since time.Time, offset, limit int) ([]models.LocatedMetric, int, error) {
+	loc, err := db.GetLocationByName(location)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page, total, err := db.GetMetricsPage(location, metricType, since, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	located := make([]models.LocatedMetric, len(page))
+	for i, m := range page {
+		located[i] = models.LocatedMetric{Metric: m, Latitude: loc.Latitude, Longitude: loc.Longitude}
+	}
+	return located, total, nil
+}
+
+// GetMetricsAllLocations retrieves one metric type for every location in a single query, grouped by
+// location and newest first within each group. Only raw metrics are returned, not rollups.
+func (db *DB) GetMetricsAllLocations(metricType string, since time.Time) (map[string][]models.Metric, error) {
+	query := `SELECT id, location, timestamp, metric_type, value, unit FROM metrics WHERE metric_type = ? AND timestamp >= ? ORDER BY location, timestamp DESC`
+	queryStart := time.Now()
+	rows, err := db.conn.Query(query, metricType, since)
+	metrics.RecordDBQuery("SELECT", "metrics", time.Since(queryStart), err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s across locations: %w", metricType, err)
+	}
+	defer rows.Close()
+
+	byLocation := make(map[string][]models.Metric)
+	for rows.Next() {
+		var m models.Metric
+		if err := rows.Scan(&m.ID, &m.Location, &m.Timestamp, &m.MetricType, &m.Value, &m.Unit); err != nil {
 			return nil, err
 		}
-		metrics = append(metrics, m)
+		byLocation[m.Location] = append(byLocation[m.Location], m)
 	}
 
-	return metrics, rows.Err()
+	return byLocation, rows.Err()
 }
 
-// GetAnomalies retrieves recent anomalies for a specific location
-func (db *DB) GetAnomalies(location string, limit int) ([]models.Anomaly, error) {
-	query := `SELECT id, location, timestamp, metric_type, value, z_score, severity FROM anomalies WHERE location = ? ORDER BY timestamp DESC LIMIT ?`
-	rows, err := db.conn.Query(query, location, limit)
+// anomalySelect lists the columns every anomaly query reads, in the order scanAnomalies scans them
+const anomalySelect = `SELECT id, location, timestamp, metric_type, value, z_score, severity, method, baseline_mean, baseline_stddev, threshold FROM anomalies`
+
+// anomalyFilter narrows an anomaly query. Zero fields don't filter, from is inclusive and until exclusive.
+type anomalyFilter struct {
+	location string
+	method   string
+	severity string
+	from     time.Time
+	until    time.Time
+	afterID  int64
+}
+
+// where builds the filter's WHERE clause and arguments, so every anomaly query filters the same way
+func (f anomalyFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+
+	if f.location != "" {
+		add("location = ?", f.location)
+	}
+	if f.method != "" {
+		add("method = ?", f.method)
+	}
+	if !f.from.IsZero() {
+		add("timestamp >= ?", f.from)
+	}
+	if !f.until.IsZero() {
+		add("timestamp < ?", f.until)
+	}
+	if f.severity != "" {
+		add("severity = ?", f.severity)
+	}
+	if f.afterID > 0 {
+		add("id > ?", f.afterID)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// scanAnomalies runs an anomaly query narrowed by filter, with order (ORDER BY and LIMIT) and its
+// arguments appended, calling fn for each row as it is read
+func (db *DB) scanAnomalies(ctx context.Context, filter anomalyFilter, order string, orderArgs []interface{}, fn func(models.Anomaly) error) error {
+	where, args := filter.where()
+	queryStart := time.Now()
+	rows, err := db.conn.QueryContext(ctx, anomalySelect+where+" "+order, append(args, orderArgs...)...)
+	metrics.RecordDBQuery("SELECT", "anomalies", time.Since(queryStart), err)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to query anomalies: %w", err)
 	}
 	defer rows.Close()
 
-	var anomalies []models.Anomaly
 	for rows.Next() {
 		var a models.Anomaly
-		if err := rows.Scan(&a.ID, &a.Location, &a.Timestamp, &a.MetricType, &a.Value, &a.ZScore, &a.Severity); err != nil {
-			return nil, err
+		if err := rows.Scan(&a.ID, &a.Location, &a.Timestamp, &a.MetricType, &a.Value, &a.ZScore, &a.Severity, &a.Method, &a.BaselineMean, &a.BaselineStdDev, &a.Threshold); err != nil {
+			return fmt.Errorf("failed to scan anomaly: %w", err)
+		}
+		if err := fn(a); err != nil {
+			return err
 		}
+	}
+
+	return rows.Err()
+}
+
+// listAnomalies is scanAnomalies collecting every row
+func (db *DB) listAnomalies(ctx context.Context, filter anomalyFilter, order string, orderArgs ...interface{}) ([]models.Anomaly, error) {
+	var anomalies []models.Anomaly
+	err := db.scanAnomalies(ctx, filter, order, orderArgs, func(a models.Anomaly) error {
 		anomalies = append(anomalies, a)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return anomalies, nil
+}
+
+// GetAnomalies retrieves recent anomalies for a specific location
+func (db *DB) GetAnomalies(location string, limit int) ([]models.Anomaly, error) {
+	return db.listAnomalies(context.Background(), anomalyFilter{location: location}, "ORDER BY timestamp DESC LIMIT ?", limit)
+}
+
+// GetAnomaliesSince retrieves every stored anomaly for a location from since onward, newest first
+func (db *DB) GetAnomaliesSince(location string, since time.Time) ([]models.Anomaly, error) {
+	anomalies, err := db.listAnomalies(context.Background(), anomalyFilter{location: location, from: since}, "ORDER BY timestamp DESC")
+	if err != nil {
+		return nil, fmt.Errorf("anomalies for %s: %w", location, err)
 	}
+	return anomalies, nil
+}
+
+// EachAnomaly calls fn for every anomaly at a location within [from, until), oldest first.
+// An empty severity matches all severities. Rows are streamed, not loaded into memory.
+func (db *DB) EachAnomaly(ctx context.Context, location string, from, until time.Time, severity string, fn func(models.Anomaly) error) error {
+	filter := anomalyFilter{location: location, from: from, until: until, severity: severity}
+	return db.scanAnomalies(ctx, filter, "ORDER BY timestamp", nil, fn)
+}
 
-	return anomalies, rows.Err()
+// GetAnomaliesByMethod retrieves up to limit anomalies produced by a detection method within [from, until),
+// ordered by id and starting after afterID so callers can page through large ranges
+func (db *DB) GetAnomaliesByMethod(ctx context.Context, method string, from, until time.Time, afterID int64, limit int) ([]models.Anomaly, error) {
+	filter := anomalyFilter{method: method, from: from, until: until, afterID: afterID}
+	return db.listAnomalies(ctx, filter, "ORDER BY id LIMIT ?", limit)
+}
+
+// UpdateAnomalySeverities sets the severity of each anomaly id in a single transaction
+func (db *DB) UpdateAnomalySeverities(ctx context.Context, severities map[int64]string) error {
+	if len(severities) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Will be ignored if committed
+
+	stmt, err := tx.PrepareContext(ctx, `UPDATE anomalies SET severity = ? WHERE id = ?`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for id, severity := range severities {
+		if _, err := stmt.ExecContext(ctx, severity, id); err != nil {
+			return fmt.Errorf("failed to update severity for anomaly %d: %w", id, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
 }
 
 // GetAlarmSuggestions retrieves alarm suggestions for a specific location
@@ -356,6 +1091,16 @@ func (db *DB) GetAlarmSuggestions(location string, limit int) ([]models.AlarmSug
 	return suggestions, rows.Err()
 }
 
+// Ping checks the database is reachable
+func (db *DB) Ping(ctx context.Context) error {
+	return db.conn.PingContext(ctx)
+}
+
+// Stats returns the connection pool statistics
+func (db *DB) Stats() sql.DBStats {
+	return db.conn.Stats()
+}
+
 // Close closes the database connection
 func (db *DB) Close() error {
 	if db.conn != nil {
@@ -364,21 +1109,76 @@ func (db *DB) Close() error {
 	return nil
 }
 
-// GetMetricStats returns statistical information about a metric for a specific location
+// GetMetricStats returns statistical information about a metric for a specific location. Like
+// GetMetrics, ranges reaching past raw retention include the rollup means.
 func (db *DB) GetMetricStats(location string, metricType string, since time.Time) (mean, stdDev float64, count int, err error) {
+	values, args := db.metricValues(location, metricType, since)
+	// STDDEV_SAMP is NULL for a single value, which the detector treats as no variation
 	query := `
 	SELECT 
 		COUNT(*) as count,
-		AVG(value) as mean,
-		STDDEV_POP(value) as stddev
-	FROM metrics 
-	WHERE location = ? AND metric_type = ? AND timestamp >= ?
+		COALESCE(AVG(value), 0) as mean,
+		COALESCE(` + db.stdDevFunc() + `(value), 0) as stddev
+	FROM (` + values + `) m
 	`
-	row := db.conn.QueryRow(query, location, metricType, since)
+	row := db.conn.QueryRow(query, args...)
 	err = row.Scan(&count, &mean, &stdDev)
 	return
 }
 
+// metricValues selects id, timestamp and value for one metric type since a time: raw readings,
+// then the hourly and daily rollup means the range reaches into, with id 0 for rollup rows
+func (db *DB) metricValues(location, metricType string, since time.Time) (string, []interface{}) {
+	parts := []string{`SELECT id, timestamp, value FROM metrics WHERE location = ? AND metric_type = ? AND timestamp >= ?`}
+	args := []interface{}{location, metricType, since}
+	for _, table := range db.rollupTables(since) {
+		parts = append(parts, `SELECT 0, bucket_start, mean FROM `+table+` WHERE location = ? AND metric_type = ? AND bucket_start >= ?`)
+		args = append(args, location, metricType, since)
+	}
+	return strings.Join(parts, " UNION ALL "), args
+}
+
+// MetricStats holds summary statistics for a single metric at a location
+type MetricStats struct {
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Latest float64 `json:"latest"`
+}
+
+// GetMetricStatsExtended returns count, mean and stddev along with min, max and the newest value
+// for a metric at a specific location, all in a single query. Rollup means count as in GetMetricStats.
+func (db *DB) GetMetricStatsExtended(location string, metricType string, since time.Time) (*MetricStats, error) {
+	values, args := db.metricValues(location, metricType, since)
+	query := `
+	SELECT 
+		COUNT(*) as count,
+		COALESCE(AVG(value), 0) as mean,
+		COALESCE(` + db.stdDevFunc() + `(value), 0) as stddev,
+		COALESCE(MIN(value), 0) as min,
+		COALESCE(MAX(value), 0) as max,
+		COALESCE((
+			SELECT latest.value FROM (` + values + `) latest
+			ORDER BY latest.timestamp DESC, latest.id DESC
+			LIMIT 1
+		), 0) as latest
+	FROM (` + values + `) m
+	`
+	queryStart := time.Now()
+	row := db.conn.QueryRow(query, append(append([]interface{}{}, args...), args...)...)
+
+	var stats MetricStats
+	err := row.Scan(&stats.Count, &stats.Mean, &stats.StdDev, &stats.Min, &stats.Max, &stats.Latest)
+	metrics.RecordDBQuery("SELECT", "metrics", time.Since(queryStart), err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get extended stats for %s: %w", metricType, err)
+	}
+
+	return &stats, nil
+}
+
 // GetLocationsWithData returns a set of all locations that have data in the database
 func (db *DB) GetLocationsWithData() (map[string]bool, error) {
 	query := `SELECT DISTINCT location FROM metrics`
@@ -404,6 +1204,88 @@ func (db *DB) GetLocationsWithData() (map[string]bool, error) {
 	return locations, nil
 }
 
+// StaleLocation is a location whose newest metric is older than the staleness cutoff
+type StaleLocation struct {
+	Name       string    `json:"name"`
+	LastMetric time.Time `json:"last_metric"`
+}
+
+// GetStaleLocations returns locations with stored metrics whose newest metric is older than cutoff,
+// stalest first. Locations that were never collected don't appear.
+func (db *DB) GetStaleLocations(cutoff time.Time) ([]StaleLocation, error) {
+	query := `SELECT location, MAX(timestamp) AS last_metric FROM metrics GROUP BY location HAVING last_metric < ? ORDER BY last_metric`
+	queryStart := time.Now()
+	rows, err := db.conn.Query(query, cutoff)
+	metrics.RecordDBQuery("SELECT", "metrics", time.Since(queryStart), err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stale locations: %w", err)
+	}
+	defer rows.Close()
+
+	var stale []StaleLocation
+	for rows.Next() {
+		var loc StaleLocation
+		if err := rows.Scan(&loc.Name, &loc.LastMetric); err != nil {
+			return nil, fmt.Errorf("failed to scan stale location: %w", err)
+		}
+		stale = append(stale, loc)
+	}
+
+	return stale, rows.Err()
+}
+
+// LatestMetric is the newest stored reading of one metric type at a location
+type LatestMetric struct {
+	Value     float64   `json:"value"`
+	Unit      string    `json:"unit,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// GetLatestMetricsAllLocations returns the newest reading of every metric type for every location,
+// keyed by location then metric type. Only the first maxLocations locations by name are returned;
+// truncated reports whether more exist. The location limit is applied in MySQL, one past
+// maxLocations to detect truncation, so only those locations' (location, metric_type) groups find
+// their newest timestamp on idx_metrics_location_type_time before joining back for the value.
+func (db *DB) GetLatestMetricsAllLocations(maxLocations int) (map[string]map[string]LatestMetric, bool, error) {
+	query := `SELECT m.location, m.metric_type, m.value, m.unit, m.timestamp
+		FROM metrics m
+		JOIN (
+			SELECT g.location, g.metric_type, MAX(g.timestamp) AS timestamp
+			FROM metrics g
+			JOIN (SELECT DISTINCT location FROM metrics ORDER BY location LIMIT ?) picked ON g.location = picked.location
+			GROUP BY g.location, g.metric_type
+		) latest ON m.location = latest.location AND m.metric_type = latest.metric_type AND m.timestamp = latest.timestamp
+		ORDER BY m.location, m.metric_type`
+	queryStart := time.Now()
+	rows, err := db.conn.Query(query, maxLocations+1)
+	metrics.RecordDBQuery("SELECT", "metrics", time.Since(queryStart), err)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get latest metrics: %w", err)
+	}
+	defer rows.Close()
+
+	fleet := make(map[string]map[string]LatestMetric)
+	for rows.Next() {
+		var location, metricType string
+		var latest LatestMetric
+		if err := rows.Scan(&location, &metricType, &latest.Value, &latest.Unit, &latest.Timestamp); err != nil {
+			return nil, false, fmt.Errorf("failed to scan latest metric: %w", err)
+		}
+		byType, ok := fleet[location]
+		if !ok {
+			if len(fleet) >= maxLocations {
+				return fleet, true, nil
+			}
+			byType = make(map[string]LatestMetric)
+			fleet[location] = byType
+		}
+		// Duplicate rows at the same timestamp collapse to one
+		byType[metricType] = latest
+	}
+
+	return fleet, false, rows.Err()
+}
+
 // Location represents a location in the database
 type Location struct {
 	ID        int64   `json:"id"`
@@ -426,6 +1308,135 @@ func (db *DB) InsertLocation(name string, latitude, longitude float64) error {
 	return nil
 }
 
+// LocationSyncResult counts the changes SyncLocations made
+type LocationSyncResult struct {
+	Inserted  int
+	Updated   int
+	Deleted   int
+	Unchanged int
+}
+
+// SyncLocations reconciles the locations table with the given list in one transaction: new names are
+// inserted and moved coordinates updated. With prune, locations missing from the list are deleted;
+// their stored metrics and anomalies are kept. A name listed twice is rejected before anything
+// changes, since which of its coordinates to keep is ambiguous.
+func (db *DB) SyncLocations(locations []Location, prune bool) (*LocationSyncResult, error) {
+	wanted := make(map[string]bool, len(locations))
+	for _, loc := range locations {
+		if wanted[loc.Name] {
+			return nil, fmt.Errorf("location %s is listed more than once", loc.Name)
+		}
+		wanted[loc.Name] = true
+	}
+
+	existing, err := db.GetAllLocations()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]Location, len(existing))
+	for _, loc := range existing {
+		byName[loc.Name] = loc
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result := &LocationSyncResult{}
+	for _, loc := range locations {
+		current, exists := byName[loc.Name]
+		switch {
+		case !exists:
+			if _, err := tx.Exec(`INSERT INTO locations (name, latitude, longitude) VALUES (?, ?, ?)`, loc.Name, loc.Latitude, loc.Longitude); err != nil {
+				return nil, fmt.Errorf("failed to insert location %s: %w", loc.Name, err)
+			}
+			result.Inserted++
+		case current.Latitude != loc.Latitude || current.Longitude != loc.Longitude:
+			if _, err := tx.Exec(`UPDATE locations SET latitude = ?, longitude = ? WHERE id = ?`, loc.Latitude, loc.Longitude, current.ID); err != nil {
+				return nil, fmt.Errorf("failed to update location %s: %w", loc.Name, err)
+			}
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+	}
+
+	if prune {
+		for _, loc := range existing {
+			if wanted[loc.Name] {
+				continue
+			}
+			if _, err := tx.Exec(`DELETE FROM locations WHERE id = ?`, loc.ID); err != nil {
+				return nil, fmt.Errorf("failed to delete location %s: %w", loc.Name, err)
+			}
+			result.Deleted++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit location sync: %w", err)
+	}
+
+	return result, nil
+}
+
+// ImportLocations inserts locations, committing every batchSize rows so large imports neither
+// commit per row nor build one huge transaction. Names that already exist are skipped.
+// Returns how many locations were inserted.
+func (db *DB) ImportLocations(locations []Location) (int, error) {
+	inserted := 0
+	for start := 0; start < len(locations); start += db.batchSize {
+		end := start + db.batchSize
+		if end > len(locations) {
+			end = len(locations)
+		}
+
+		n, err := db.importLocationBatch(locations[start:end])
+		if err != nil {
+			return inserted, err
+		}
+		inserted += n
+	}
+	return inserted, nil
+}
+
+func (db *DB) importLocationBatch(locations []Location) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT IGNORE INTO locations (name, latitude, longitude) VALUES (?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	inserted := 0
+	for _, loc := range locations {
+		result, err := stmt.Exec(loc.Name, loc.Latitude, loc.Longitude)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert location %s: %w", loc.Name, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			inserted++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit location batch: %w", err)
+	}
+	return inserted, nil
+}
+
+// NoLocationsMessage is logged by commands that find an empty locations table, which is
+// expected on a fresh install rather than an error
+const NoLocationsMessage = "no locations configured; seed the database or add via POST /locations"
+
 // GetAllLocations retrieves all locations from the database
 func (db *DB) GetAllLocations() ([]Location, error) {
 	query := `SELECT id, name, latitude, longitude FROM locations ORDER BY name`
@@ -0,0 +1,402 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"preempt/internal/clock"
+	"preempt/internal/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestStoreAnomalyEventsUpsertsOnSeriesAndStart(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	event := models.AnomalyEvent{
+		Location: "Tokyo", MetricType: "temperature_2m", StartTime: start, EndTime: start.Add(time.Hour),
+		PeakValue: 110, PeakZScore: 6, Severity: "high", AnomalyCount: 12, MinValue: 100, MaxValue: 111,
+	}
+
+	// Storing the same burst twice hits the unique key the second time and updates the row
+	for run := 0; run < 2; run++ {
+		mock.ExpectBegin()
+		mock.ExpectPrepare("INSERT INTO anomaly_events .* ON DUPLICATE KEY UPDATE").
+			ExpectExec().
+			WithArgs("Tokyo", "temperature_2m", start, start.Add(time.Hour), 110.0, 6.0, "high", 12, 100.0, 111.0).
+			WillReturnResult(sqlmock.NewResult(1, int64(run+1))) // MySQL reports 2 rows for an update
+		mock.ExpectCommit()
+	}
+
+	db := NewFromConn(conn)
+	for run := 0; run < 2; run++ {
+		if err := db.StoreAnomalyEvents([]models.AnomalyEvent{event}); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStoreAnomaliesUpsertsOnReadingAndMethod(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	predictedAt := time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC)
+	mean, stdDev, threshold := 21.0, 1.0, 1.0
+	anomaly := models.Anomaly{
+		Location: "Tokyo", Timestamp: predictedAt, MetricType: "temperature_2m", Value: 35, ZScore: 14,
+		Severity: "high", Method: "forecast", BaselineMean: &mean, BaselineStdDev: &stdDev, Threshold: &threshold,
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO anomalies .* ON DUPLICATE KEY UPDATE value = VALUES\\(value\\)").
+		ExpectExec().
+		WithArgs("Tokyo", predictedAt, "temperature_2m", 35.0, 14.0, "high", "forecast", &mean, &stdDev, &threshold).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
+
+	if err := NewFromConn(conn).StoreAnomalies([]models.Anomaly{anomaly}); err != nil {
+		t.Fatalf("StoreAnomalies: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHourlyFieldDataIncludesApparentTemperatureAndSurfacePressure(t *testing.T) {
+	forecast := &models.Forecast{
+		HourlyUnits: models.HourlyUnits{ApparentTemperature: "°F", SurfacePressure: "hPa"},
+		Hourly: models.Hourly{
+			Time:                []string{"2024-06-01T12:00"},
+			ApparentTemperature: []float64{88.3},
+			SurfacePressure:     []float64{1004.2},
+		},
+	}
+
+	data := hourlyFieldData(forecast)
+	if got := data["apparent_temperature"]; len(got) != 1 || got[0] != 88.3 {
+		t.Errorf("apparent_temperature = %v, want [88.3]", got)
+	}
+	if got := data["surface_pressure"]; len(got) != 1 || got[0] != 1004.2 {
+		t.Errorf("surface_pressure = %v, want [1004.2]", got)
+	}
+
+	units := hourlyFieldUnits(forecast)
+	if units["apparent_temperature"] != "°F" || units["surface_pressure"] != "hPa" {
+		t.Errorf("units = %v, want °F and hPa", units)
+	}
+}
+
+func TestStoreMetricsRejectsImpossibleHumidity(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	db := NewFromConn(conn)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	db.SetClock(clock.NewFake(now))
+	temperature, humidity := 72.4, 300.0
+	fields := []string{"temperature_2m", "relative_humidity_2m"}
+
+	// Only the temperature reading is inserted, 300% humidity never reaches the table
+	mock.ExpectExec("INSERT INTO metrics").
+		WithArgs("Tokyo", now, "temperature_2m", 72.4, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	current := &models.Forecast{Current: models.Current{Temperature2m: &temperature, RelativeHumidity2m: &humidity}}
+	if err := db.StoreMetrics(current, "Tokyo", fields, false); err != nil {
+		t.Fatalf("StoreMetrics(current): %v", err)
+	}
+
+	// A backfill drops the impossible hour and keeps its neighbours
+	first := time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO metrics").
+		WithArgs(
+			"Tokyo", first, "relative_humidity_2m", 55.0, "",
+			"Tokyo", first.Add(2*time.Hour), "relative_humidity_2m", 61.0, "",
+		).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
+	hourly := &models.Forecast{Hourly: models.Hourly{
+		Time:               []string{"2024-05-31T00:00", "2024-05-31T01:00", "2024-05-31T02:00"},
+		RelativeHumidity2m: []float64{55, 300, 61},
+	}}
+	if err := db.StoreMetrics(hourly, "Tokyo", []string{"relative_humidity_2m"}, true); err != nil {
+		t.Fatalf("StoreMetrics(hourly): %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStoreHourlyMetricsInsertsBatchSizeRowsPerStatement(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	db := NewFromConn(conn)
+	db.SetBatchSize(2)
+	forecast := &models.Forecast{Hourly: models.Hourly{
+		Time:          []string{"2024-05-31T00:00", "2024-05-31T01:00", "2024-05-31T02:00", "2024-05-31T03:00", "2024-05-31T04:00"},
+		Temperature2m: []float64{61, 60, 59, 58, 58},
+	}}
+
+	// 5 rows at batch_size 2 go out as INSERTs of 2, 2 and 1 rows under a single commit
+	twoRows := "INSERT INTO metrics \\(location, timestamp, metric_type, value, unit\\) VALUES \\(\\?, \\?, \\?, \\?, \\?\\),\\(\\?, \\?, \\?, \\?, \\?\\)$"
+	oneRow := "INSERT INTO metrics \\(location, timestamp, metric_type, value, unit\\) VALUES \\(\\?, \\?, \\?, \\?, \\?\\)$"
+	mock.ExpectBegin()
+	mock.ExpectExec(twoRows).WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectExec(twoRows).WillReturnResult(sqlmock.NewResult(3, 2))
+	mock.ExpectExec(oneRow).WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectCommit()
+
+	if err := db.StoreMetrics(forecast, "Tokyo", []string{"temperature_2m"}, true); err != nil {
+		t.Fatalf("StoreMetrics: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStoreHourlyMetricsRollsBackMidBatchFailure(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	db := NewFromConn(conn)
+	db.SetBatchSize(2)
+	forecast := &models.Forecast{Hourly: models.Hourly{
+		Time:          []string{"2024-05-31T00:00", "2024-05-31T01:00", "2024-05-31T02:00", "2024-05-31T03:00", "2024-05-31T04:00"},
+		Temperature2m: []float64{61, 60, 59, 58, 58},
+	}}
+
+	// The first batch goes in, the second fails, so the transaction must be rolled back, never committed
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO metrics").WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectExec("INSERT INTO metrics").WillReturnError(errors.New("lock wait timeout exceeded"))
+	mock.ExpectRollback()
+
+	err = db.StoreMetrics(forecast, "Tokyo", []string{"temperature_2m"}, true)
+	if err == nil || !strings.Contains(err.Error(), "lock wait timeout") {
+		t.Errorf("error = %v, want the failed batch's error", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetMetricsPageContinuesIntoRollups(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	db := NewFromConn(conn)
+	db.SetRollupPolicy(7*24*time.Hour, 0)
+	since := time.Now().Add(-30 * 24 * time.Hour)
+
+	// A month back reaches metrics_hourly, daily rollups are disabled
+	union := "FROM \\(SELECT 0 AS tier, .* FROM metrics WHERE .* UNION ALL SELECT 1, 0, location, bucket_start, metric_type, mean, '' FROM metrics_hourly WHERE .*\\) m"
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) "+union).
+		WithArgs("Tokyo", "temperature_2m", since, "Tokyo", "temperature_2m", since).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(900))
+	mock.ExpectQuery("SELECT id, location, timestamp, metric_type, value, unit "+union+" ORDER BY tier, timestamp DESC LIMIT \\? OFFSET \\?").
+		WithArgs("Tokyo", "temperature_2m", since, "Tokyo", "temperature_2m", since, 100, 800).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "location", "timestamp", "metric_type", "value", "unit"}).
+			AddRow(0, "Tokyo", since.Add(time.Hour), "temperature_2m", 68.4, ""))
+
+	page, total, err := db.GetMetricsPage("Tokyo", "temperature_2m", since, 800, 100)
+	if err != nil {
+		t.Fatalf("GetMetricsPage: %v", err)
+	}
+	if total != 900 || len(page) != 1 || page[0].Value != 68.4 {
+		t.Errorf("total %d, page %+v", total, page)
+	}
+
+	// Past the end only the count is queried
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(900))
+	if page, total, err = db.GetMetricsPage("Tokyo", "temperature_2m", since, 900, 100); err != nil || len(page) != 0 || total != 900 {
+		t.Errorf("past the end: page %v, total %d, err %v", page, total, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetMetricStatsIncludesRollups(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	db := NewFromConn(conn)
+	db.SetRollupPolicy(7*24*time.Hour, 90*24*time.Hour)
+	since := time.Now().Add(-120 * 24 * time.Hour)
+
+	// Four months back reaches both rollup tiers, whose means are values like any raw reading
+	values := "SELECT id, timestamp, value FROM metrics WHERE .* UNION ALL SELECT 0, bucket_start, mean FROM metrics_hourly WHERE .* UNION ALL SELECT 0, bucket_start, mean FROM metrics_daily WHERE .*"
+	args := []driver.Value{"Tokyo", "temperature_2m", since, "Tokyo", "temperature_2m", since, "Tokyo", "temperature_2m", since}
+	mock.ExpectQuery("FROM \\(" + values + "\\) m").
+		WithArgs(args...).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "mean", "stddev"}).AddRow(2900, 61.5, 9.2))
+
+	mean, stdDev, count, err := db.GetMetricStats("Tokyo", "temperature_2m", since)
+	if err != nil {
+		t.Fatalf("GetMetricStats: %v", err)
+	}
+	if count != 2900 || mean != 61.5 || stdDev != 9.2 {
+		t.Errorf("count %d, mean %v, stddev %v", count, mean, stdDev)
+	}
+
+	mock.ExpectQuery("SELECT latest.value FROM \\(" + values + "\\) latest .* FROM \\(" + values + "\\) m").
+		WithArgs(append(args, args...)...).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "mean", "stddev", "min", "max", "latest"}).AddRow(2900, 61.5, 9.2, 28.0, 97.3, 70.1))
+
+	stats, err := db.GetMetricStatsExtended("Tokyo", "temperature_2m", since)
+	if err != nil {
+		t.Fatalf("GetMetricStatsExtended: %v", err)
+	}
+	if stats.Count != 2900 || stats.Min != 28.0 || stats.Latest != 70.1 {
+		t.Errorf("stats = %+v", *stats)
+	}
+
+	// A range inside raw retention reads only the metrics table
+	recent := time.Now().Add(-24 * time.Hour)
+	mock.ExpectQuery("FROM \\(SELECT id, timestamp, value FROM metrics WHERE location = \\? AND metric_type = \\? AND timestamp >= \\?\\) m").
+		WithArgs("Tokyo", "temperature_2m", recent).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "mean", "stddev"}).AddRow(24, 70.2, 1.1))
+	if _, _, count, err = db.GetMetricStats("Tokyo", "temperature_2m", recent); err != nil || count != 24 {
+		t.Errorf("recent: count %d, err %v", count, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetLatestMetricsAllLocationsLimitsLocationsInSQL(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	db := NewFromConn(conn)
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// One location past the limit comes back so truncation can be reported
+	mock.ExpectQuery("JOIN \\(SELECT DISTINCT location FROM metrics ORDER BY location LIMIT \\?\\) picked .* GROUP BY g.location, g.metric_type").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"location", "metric_type", "value", "unit", "timestamp"}).
+			AddRow("Berlin", "temperature_2m", 64.2, "°F", at).
+			AddRow("Lima", "temperature_2m", 71.0, "°F", at).
+			AddRow("Lima", "surface_pressure", 1012.5, "hPa", at).
+			AddRow("Oslo", "temperature_2m", 48.9, "°F", at))
+
+	fleet, truncated, err := db.GetLatestMetricsAllLocations(2)
+	if err != nil {
+		t.Fatalf("GetLatestMetricsAllLocations: %v", err)
+	}
+	if !truncated || len(fleet) != 2 || len(fleet["Lima"]) != 2 {
+		t.Errorf("truncated %v, fleet %+v", truncated, fleet)
+	}
+	if _, ok := fleet["Oslo"]; ok {
+		t.Error("location past the limit was returned")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAlarmSuggestionsUpsertAndListPerLocation(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	db := NewFromConn(conn)
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	suggestion := models.AlarmSuggestion{Location: "Lima", MetricType: "surface_pressure", Threshold: 1021.5, Operator: "<", SuggestedAt: at, Confidence: 0.8, Description: "pressure drop", AnomalyCount: 3}
+
+	// The unique (location, metric_type) key turns a repeat into an update of that location's row
+	mock.ExpectExec("INSERT INTO alarm_suggestions \\(location, metric_type, .*\\) .* ON DUPLICATE KEY UPDATE").
+		WithArgs("Lima", "surface_pressure", 1021.5, "<", at, 0.8, "pressure drop", 3).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	if err := db.StoreAlarmSuggestion(&suggestion); err != nil {
+		t.Fatalf("StoreAlarmSuggestion: %v", err)
+	}
+
+	mock.ExpectQuery("FROM alarm_suggestions WHERE location = \\? ORDER BY confidence DESC, suggested_at DESC LIMIT \\?").
+		WithArgs("Lima", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "location", "metric_type", "threshold", "operator", "suggested_at", "confidence", "description", "anomaly_count"}).
+			AddRow(7, "Lima", "surface_pressure", 1021.5, "<", at, 0.8, "pressure drop", 3))
+	listed, err := db.GetAlarmSuggestions("Lima", 10)
+	if err != nil {
+		t.Fatalf("GetAlarmSuggestions: %v", err)
+	}
+	if len(listed) != 1 || listed[0].Location != "Lima" || listed[0].ID != 7 {
+		t.Errorf("listed = %+v", listed)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAnomalyFilterWhere(t *testing.T) {
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	until := from.Add(24 * time.Hour)
+
+	tests := []struct {
+		name   string
+		filter anomalyFilter
+		where  string
+		args   []interface{}
+	}{
+		{"empty", anomalyFilter{}, "", nil},
+		{"location", anomalyFilter{location: "Tokyo"}, " WHERE location = ?", []interface{}{"Tokyo"}},
+		{
+			"export",
+			anomalyFilter{location: "Tokyo", from: from, until: until, severity: "high"},
+			" WHERE location = ? AND timestamp >= ? AND timestamp < ? AND severity = ?",
+			[]interface{}{"Tokyo", from, until, "high"},
+		},
+		{
+			"method page",
+			anomalyFilter{method: "stats", from: from, until: until, afterID: 42},
+			" WHERE method = ? AND timestamp >= ? AND timestamp < ? AND id > ?",
+			[]interface{}{"stats", from, until, int64(42)},
+		},
+	}
+
+	for _, tt := range tests {
+		where, args := tt.filter.where()
+		if where != tt.where || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s: got %q %v, want %q %v", tt.name, where, args, tt.where, tt.args)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL server errors that go away on their own and are worth retrying
+const (
+	errLockWaitTimeout    = 1205
+	errLockDeadlock       = 1213
+	errTooManyConnections = 1040
+)
+
+// IsTransient reports whether err is a database failure likely to succeed if retried, such as a
+// dropped connection, network error, deadlock or lock wait timeout. Query and schema errors
+// and cancelled contexts are not transient.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case errLockWaitTimeout, errLockDeadlock, errTooManyConnections:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
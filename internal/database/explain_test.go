@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// TEST_DATABASE_DSN points at a scratch MySQL database, e.g.
+// "user:pass@tcp(localhost:3306)/preempt_test?parseTime=true". Without it the test is skipped.
+func TestMetricsPageUsesSeriesIndex(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+	db, err := NewDB(dsn)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	defer db.Close()
+
+	// Enough readings across types that a table scan would be the costlier plan
+	location := fmt.Sprintf("explain-%d", time.Now().UnixNano())
+	t.Cleanup(func() { db.conn.Exec(`DELETE FROM metrics WHERE location = ?`, location) })
+	start := time.Now().Add(-7 * 24 * time.Hour)
+	for h := 0; h < 7*24; h++ {
+		for _, metricType := range []string{"temperature_2m", "surface_pressure", "cloud_cover"} {
+			if _, err := db.conn.Exec(`INSERT INTO metrics (location, timestamp, metric_type, value) VALUES (?, ?, ?, ?)`,
+				location, start.Add(time.Duration(h)*time.Hour), metricType, float64(h)); err != nil {
+				t.Fatalf("insert: %v", err)
+			}
+		}
+	}
+	if _, err := db.conn.Exec(`ANALYZE TABLE metrics`); err != nil {
+		t.Fatalf("ANALYZE TABLE: %v", err)
+	}
+
+	union, args := db.metricsPageUnion(location, "temperature_2m", time.Now().Add(-24*time.Hour))
+	rows, err := db.conn.Query(`EXPLAIN SELECT id FROM (`+union+`) m ORDER BY tier, timestamp DESC LIMIT 100`, args...)
+	if err != nil {
+		t.Fatalf("EXPLAIN: %v", err)
+	}
+	defer rows.Close()
+
+	plans := explainRows(t, rows)
+	var key string
+	for _, plan := range plans {
+		if plan["table"] == "metrics" {
+			key = plan["key"]
+		}
+	}
+	if key != "idx_metrics_location_type_time" {
+		t.Errorf("metrics read through key %q, want idx_metrics_location_type_time; plan %v", key, plans)
+	}
+}
+
+// explainRows reads EXPLAIN output as one column-name to value map per row, whatever columns the server reports
+func explainRows(t *testing.T, rows *sql.Rows) []map[string]string {
+	t.Helper()
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("columns: %v", err)
+	}
+
+	var plans []map[string]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		plan := make(map[string]string, len(columns))
+		for i, column := range columns {
+			plan[column] = values[i].String
+		}
+		plans = append(plans, plan)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("rows: %v", err)
+	}
+	return plans
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var locationColumns = []string{"id", "name", "latitude", "longitude"}
+
+// newLocationMock returns a DB whose locations table holds Tokyo and Paris
+func newLocationMock(t *testing.T) (*DB, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	mock.ExpectQuery("SELECT id, name, latitude, longitude FROM locations").
+		WillReturnRows(sqlmock.NewRows(locationColumns).
+			AddRow(1, "Paris", 48.85, 2.35).
+			AddRow(2, "Tokyo", 35.68, 139.69))
+	return NewFromConn(conn), mock
+}
+
+func TestSyncLocationsInsertsNewOnly(t *testing.T) {
+	db, mock := newLocationMock(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO locations").WithArgs("Oslo", 59.91, 10.75).WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectCommit()
+
+	result, err := db.SyncLocations([]Location{
+		{Name: "Paris", Latitude: 48.85, Longitude: 2.35},
+		{Name: "Tokyo", Latitude: 35.68, Longitude: 139.69},
+		{Name: "Oslo", Latitude: 59.91, Longitude: 10.75},
+	}, false)
+	if err != nil {
+		t.Fatalf("SyncLocations: %v", err)
+	}
+	if *result != (LocationSyncResult{Inserted: 1, Unchanged: 2}) {
+		t.Errorf("result = %+v, want 1 inserted, 2 unchanged", *result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSyncLocationsUpdatesMovedCoordinates(t *testing.T) {
+	db, mock := newLocationMock(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE locations SET latitude = \\?, longitude = \\? WHERE id = \\?").
+		WithArgs(35.69, 139.7, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// Without prune, Paris missing from the list is left alone
+	result, err := db.SyncLocations([]Location{{Name: "Tokyo", Latitude: 35.69, Longitude: 139.7}}, false)
+	if err != nil {
+		t.Fatalf("SyncLocations: %v", err)
+	}
+	if *result != (LocationSyncResult{Updated: 1}) {
+		t.Errorf("result = %+v, want 1 updated", *result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSyncLocationsPrunesMissing(t *testing.T) {
+	db, mock := newLocationMock(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM locations WHERE id = \\?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result, err := db.SyncLocations([]Location{{Name: "Tokyo", Latitude: 35.68, Longitude: 139.69}}, true)
+	if err != nil {
+		t.Fatalf("SyncLocations: %v", err)
+	}
+	if *result != (LocationSyncResult{Deleted: 1, Unchanged: 1}) {
+		t.Errorf("result = %+v, want 1 deleted, 1 unchanged", *result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSyncLocationsRejectsRepeatedName(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	// Nothing is queried or changed
+	_, err = NewFromConn(conn).SyncLocations([]Location{
+		{Name: "Oslo", Latitude: 59.91, Longitude: 10.75},
+		{Name: "Oslo", Latitude: 60, Longitude: 11},
+	}, true)
+	if err == nil || !strings.Contains(err.Error(), "Oslo") {
+		t.Errorf("SyncLocations error = %v, want the repeated name reported", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestImportLocationsCommitsEveryBatch(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	db := NewFromConn(conn)
+	db.SetBatchSize(2)
+	locations := []Location{
+		{Name: "Tokyo", Latitude: 35.68, Longitude: 139.69},
+		{Name: "Paris", Latitude: 48.85, Longitude: 2.35},
+		{Name: "Lima", Latitude: -12.05, Longitude: -77.04},
+		{Name: "Oslo", Latitude: 59.91, Longitude: 10.75},
+		{Name: "Cairo", Latitude: 30.04, Longitude: 31.24},
+	}
+
+	// 5 rows at batch_size 2 commit as 2, 2 and 1
+	for _, batch := range [][]Location{locations[:2], locations[2:4], locations[4:]} {
+		mock.ExpectBegin()
+		prepared := mock.ExpectPrepare("INSERT IGNORE INTO locations")
+		for _, loc := range batch {
+			prepared.ExpectExec().WithArgs(loc.Name, loc.Latitude, loc.Longitude).WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+		mock.ExpectCommit()
+	}
+
+	inserted, err := db.ImportLocations(locations)
+	if err != nil {
+		t.Fatalf("ImportLocations: %v", err)
+	}
+	if inserted != len(locations) {
+		t.Errorf("inserted %d, want %d", inserted, len(locations))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
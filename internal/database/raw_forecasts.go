@@ -0,0 +1,60 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"preempt/internal/metrics"
+	"preempt/internal/models"
+	"time"
+)
+
+// ErrRawForecastNotFound is returned when no raw forecast is stored for a location
+var ErrRawForecastNotFound = errors.New("raw forecast not found")
+
+// StoreRawForecast keeps the API payload a set of metrics was extracted from, for auditing disputed anomalies
+func (db *DB) StoreRawForecast(location, dataType string, payload json.RawMessage) error {
+	queryStart := time.Now()
+	_, err := db.conn.Exec(`INSERT INTO raw_forecasts (location, data_type, fetched_at, payload) VALUES (?, ?, ?, ?)`,
+		location, dataType, db.clock.Now().UTC(), string(payload))
+	metrics.RecordDBQuery("INSERT", "raw_forecasts", time.Since(queryStart), err)
+	if err != nil {
+		return fmt.Errorf("failed to store raw forecast for %s: %w", location, err)
+	}
+	return nil
+}
+
+// GetNearestRawForecast returns the raw forecast for a location fetched closest to at
+func (db *DB) GetNearestRawForecast(location string, at time.Time) (*models.RawForecast, error) {
+	query := `SELECT id, location, data_type, fetched_at, payload FROM raw_forecasts
+	          WHERE location = ?
+	          ORDER BY ABS(TIMESTAMPDIFF(MICROSECOND, fetched_at, ?))
+	          LIMIT 1`
+
+	var rf models.RawForecast
+	var payload []byte
+	queryStart := time.Now()
+	err := db.conn.QueryRow(query, location, at.UTC()).Scan(&rf.ID, &rf.Location, &rf.DataType, &rf.FetchedAt, &payload)
+	metrics.RecordDBQuery("SELECT", "raw_forecasts", time.Since(queryStart), err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRawForecastNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query raw forecast: %w", err)
+	}
+
+	rf.Payload = json.RawMessage(payload)
+	return &rf, nil
+}
+
+// PruneRawForecasts deletes raw forecasts fetched before cutoff and returns how many were removed
+func (db *DB) PruneRawForecasts(before time.Time) (int64, error) {
+	queryStart := time.Now()
+	result, err := db.conn.Exec(`DELETE FROM raw_forecasts WHERE fetched_at < ?`, before.UTC())
+	metrics.RecordDBQuery("DELETE", "raw_forecasts", time.Since(queryStart), err)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune raw forecasts: %w", err)
+	}
+	return result.RowsAffected()
+}
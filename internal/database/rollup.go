@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"preempt/internal/metrics"
+	"preempt/internal/models"
+	"time"
+)
+
+// rollupTables are created alongside the main schema
+var rollupTables = []string{
+	`CREATE TABLE IF NOT EXISTS metrics_hourly (
+		location VARCHAR(255) NOT NULL DEFAULT '',
+		metric_type VARCHAR(100) NOT NULL,
+		bucket_start DATETIME(6) NOT NULL,
+		sample_count INT NOT NULL,
+		mean DOUBLE NOT NULL,
+		min_value DOUBLE NOT NULL,
+		max_value DOUBLE NOT NULL,
+		PRIMARY KEY (location, metric_type, bucket_start)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+	`CREATE TABLE IF NOT EXISTS metrics_daily (
+		location VARCHAR(255) NOT NULL DEFAULT '',
+		metric_type VARCHAR(100) NOT NULL,
+		bucket_start DATETIME(6) NOT NULL,
+		sample_count INT NOT NULL,
+		mean DOUBLE NOT NULL,
+		min_value DOUBLE NOT NULL,
+		max_value DOUBLE NOT NULL,
+		PRIMARY KEY (location, metric_type, bucket_start)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+}
+
+// mergeRollup folds a new aggregate into an existing bucket, keeping the mean weighted by sample count.
+// MySQL applies the assignments left to right, so sample_count must be updated last.
+const mergeRollup = `ON DUPLICATE KEY UPDATE
+		mean = (mean * sample_count + VALUES(mean) * VALUES(sample_count)) / (sample_count + VALUES(sample_count)),
+		min_value = LEAST(min_value, VALUES(min_value)),
+		max_value = GREATEST(max_value, VALUES(max_value)),
+		sample_count = sample_count + VALUES(sample_count)`
+
+// SetRollupPolicy tells GetMetrics how old raw data may be before it only exists in the rollup tables.
+// Zero durations disable reading from the corresponding rollup table.
+func (db *DB) SetRollupPolicy(hourlyAfter, dailyAfter time.Duration) {
+	db.rollupHourlyAfter = hourlyAfter
+	db.rollupDailyAfter = dailyAfter
+}
+
+// RollupHourly aggregates raw metrics older than cutoff into metrics_hourly and deletes the raw rows.
+// Work is done one day at a time, each day in its own transaction. Returns the number of raw rows rolled up.
+func (db *DB) RollupHourly(ctx context.Context, cutoff time.Time) (int64, error) {
+	insert := `INSERT INTO metrics_hourly (location, metric_type, bucket_start, sample_count, mean, min_value, max_value)
+		SELECT location, metric_type, DATE_FORMAT(timestamp, '%Y-%m-%d %H:00:00'), COUNT(*), AVG(value), MIN(value), MAX(value)
+		FROM metrics WHERE timestamp >= ? AND timestamp < ?
+		GROUP BY location, metric_type, DATE_FORMAT(timestamp, '%Y-%m-%d %H:00:00')
+		` + mergeRollup
+	remove := `DELETE FROM metrics WHERE timestamp >= ? AND timestamp < ?`
+
+	return db.rollup(ctx, "metrics", cutoff.Truncate(time.Hour), insert, remove)
+}
+
+// RollupDaily aggregates hourly rollups older than cutoff into metrics_daily and deletes the hourly rows.
+// Returns the number of hourly rows rolled up.
+func (db *DB) RollupDaily(ctx context.Context, cutoff time.Time) (int64, error) {
+	insert := `INSERT INTO metrics_daily (location, metric_type, bucket_start, sample_count, mean, min_value, max_value)
+		SELECT location, metric_type, DATE(bucket_start), SUM(sample_count), SUM(mean * sample_count) / SUM(sample_count), MIN(min_value), MAX(max_value)
+		FROM metrics_hourly WHERE bucket_start >= ? AND bucket_start < ?
+		GROUP BY location, metric_type, DATE(bucket_start)
+		` + mergeRollup
+	remove := `DELETE FROM metrics_hourly WHERE bucket_start >= ? AND bucket_start < ?`
+
+	return db.rollup(ctx, "metrics_hourly", startOfDay(cutoff), insert, remove)
+}
+
+// rollup walks day-sized windows from the oldest row in source up to cutoff, running insert then
+// remove for each window inside a transaction so a failure never loses or double counts data
+func (db *DB) rollup(ctx context.Context, source string, cutoff time.Time, insert, remove string) (int64, error) {
+	timeColumn := "timestamp"
+	if source == "metrics_hourly" {
+		timeColumn = "bucket_start"
+	}
+
+	var oldest sql.NullTime
+	query := fmt.Sprintf(`SELECT MIN(%s) FROM %s WHERE %s < ?`, timeColumn, source, timeColumn)
+	if err := db.conn.QueryRowContext(ctx, query, cutoff).Scan(&oldest); err != nil {
+		return 0, fmt.Errorf("failed to find oldest row in %s: %w", source, err)
+	}
+	if !oldest.Valid {
+		return 0, nil // Nothing old enough
+	}
+
+	var total int64
+	for windowStart := startOfDay(oldest.Time); windowStart.Before(cutoff); windowStart = windowStart.AddDate(0, 0, 1) {
+		windowEnd := windowStart.AddDate(0, 0, 1)
+		if windowEnd.After(cutoff) {
+			windowEnd = cutoff
+		}
+
+		rolled, err := db.rollupWindow(ctx, source, insert, remove, windowStart, windowEnd)
+		if err != nil {
+			return total, err
+		}
+		total += rolled
+	}
+
+	log.Printf("✓ Rolled up %d rows from %s older than %s", total, source, cutoff.Format(time.RFC3339))
+	return total, nil
+}
+
+func (db *DB) rollupWindow(ctx context.Context, source, insert, remove string, from, until time.Time) (int64, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Will be ignored if committed
+
+	queryStart := time.Now()
+	_, err = tx.ExecContext(ctx, insert, from, until)
+	metrics.RecordDBQuery("INSERT", source+"_rollup", time.Since(queryStart), err)
+	if err != nil {
+		return 0, fmt.Errorf("failed to aggregate %s for %s: %w", source, from.Format("2006-01-02"), err)
+	}
+
+	queryStart = time.Now()
+	result, err := tx.ExecContext(ctx, remove, from, until)
+	metrics.RecordDBQuery("DELETE", source, time.Since(queryStart), err)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete rolled up %s for %s: %w", source, from.Format("2006-01-02"), err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	deleted, _ := result.RowsAffected()
+	return deleted, nil
+}
+
+// getRollupMetrics returns hourly and daily rollup means as metrics for data older than the raw
+// retention, newest first so they can be appended after the raw rows from GetMetrics
+func (db *DB) getRollupMetrics(location string, metricTypes []string, since time.Time) ([]models.Metric, error) {
+	var result []models.Metric
+
+	for _, table := range db.rollupTables(since) {
+		typeFilter, typeArgs := metricTypeFilter(metricTypes)
+		args := append([]interface{}{location}, typeArgs...)
+		args = append(args, since)
+
+		query := fmt.Sprintf(
+			`SELECT location, bucket_start, metric_type, mean FROM %s WHERE location = ?%s AND bucket_start >= ? ORDER BY bucket_start DESC`,
+			table, typeFilter,
+		)
+
+		rows, err := db.conn.Query(query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s: %w", table, err)
+		}
+
+		for rows.Next() {
+			var m models.Metric
+			if err := rows.Scan(&m.Location, &m.Timestamp, &m.MetricType, &m.Value); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan %s row: %w", table, err)
+			}
+			result = append(result, m)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// rollupTables returns the rollup tables a range starting at since reaches into, hourly before daily
+func (db *DB) rollupTables(since time.Time) []string {
+	now := db.clock.Now()
+
+	tables := []struct {
+		name  string
+		after time.Duration
+	}{
+		{"metrics_hourly", db.rollupHourlyAfter},
+		{"metrics_daily", db.rollupDailyAfter},
+	}
+
+	var reached []string
+	for _, table := range tables {
+		if table.after > 0 && since.Before(now.Add(-table.after)) {
+			reached = append(reached, table.name)
+		}
+	}
+	return reached
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
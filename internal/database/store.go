@@ -0,0 +1,26 @@
+package database
+
+import (
+	"context"
+	"preempt/internal/models"
+	"time"
+)
+
+// MetricsStore is the part of DB that detection and alarm suggestion read and write.
+// DB implements it against MySQL, databasetest.MemoryStore in memory for tests.
+type MetricsStore interface {
+	GetMetrics(location string, metricTypes []string, since time.Time) ([]models.Metric, error)
+	GetForecastMetrics(location string, metricTypes []string, from, until time.Time) ([]models.Metric, error)
+	GetMetricStatsExtended(location string, metricType string, since time.Time) (*MetricStats, error)
+
+	StoreAnomalies(anomalies []models.Anomaly) error
+	GetAnomalies(location string, limit int) ([]models.Anomaly, error)
+	GetAnomaliesSince(location string, since time.Time) ([]models.Anomaly, error)
+	GetAnomaliesByMethod(ctx context.Context, method string, from, until time.Time, afterID int64, limit int) ([]models.Anomaly, error)
+	UpdateAnomalySeverities(ctx context.Context, severities map[int64]string) error
+
+	StoreAlarmSuggestion(suggestion *models.AlarmSuggestion) error
+	GetAlarmSuggestions(location string, limit int) ([]models.AlarmSuggestion, error)
+}
+
+var _ MetricsStore = (*DB)(nil)
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"preempt/internal/metrics"
+	"preempt/internal/models"
+	"time"
+)
+
+// hourlyFieldUnits maps each supported field name to the unit of its hourly series
+func hourlyFieldUnits(forecast *models.Forecast) map[string]string {
+	return map[string]string{
+		"temperature_2m":       forecast.HourlyUnits.Temperature2m,
+		"relative_humidity_2m": forecast.HourlyUnits.RelativeHumidity2m,
+		"precipitation":        forecast.HourlyUnits.Precipitation,
+		"wind_speed_10m":       forecast.HourlyUnits.WindSpeed10m,
+		"dew_point_2m":         forecast.HourlyUnits.DewPoint2m,
+		"apparent_temperature": forecast.HourlyUnits.ApparentTemperature,
+		"surface_pressure":     forecast.HourlyUnits.SurfacePressure,
+		"cloud_cover":          forecast.HourlyUnits.CloudCover,
+	}
+}
+
+// currentFieldUnits maps each supported field name to the unit of its current reading
+func currentFieldUnits(forecast *models.Forecast) map[string]string {
+	return map[string]string{
+		"temperature_2m":       forecast.CurrentUnits.Temperature2m,
+		"relative_humidity_2m": forecast.CurrentUnits.RelativeHumidity2m,
+		"precipitation":        forecast.CurrentUnits.Precipitation,
+		"wind_speed_10m":       forecast.CurrentUnits.WindSpeed10m,
+		"dew_point_2m":         forecast.CurrentUnits.DewPoint2m,
+		"apparent_temperature": forecast.CurrentUnits.ApparentTemperature,
+		"surface_pressure":     forecast.CurrentUnits.SurfacePressure,
+		"cloud_cover":          forecast.CurrentUnits.CloudCover,
+	}
+}
+
+// unitMatches reports whether unit agrees with the unit already stored for the location's series,
+// logging the rejection if not. A series without a recorded unit accepts any unit and adopts the
+// first one stored, and an empty unit (the response didn't say) is always accepted.
+func (db *DB) unitMatches(location, metricType, unit string) (bool, error) {
+	if unit == "" {
+		return true, nil
+	}
+
+	key := location + "\x00" + metricType
+	db.unitsMu.Lock()
+	existing, cached := db.units[key]
+	db.unitsMu.Unlock()
+
+	if !cached {
+		var err error
+		existing, err = db.seriesUnit(location, metricType)
+		if err != nil {
+			return false, err
+		}
+	}
+	if existing != "" && existing != unit {
+		log.Printf("Rejected %s for %s: unit %q differs from stored series unit %q", metricType, location, unit, existing)
+		return false, nil
+	}
+
+	db.unitsMu.Lock()
+	db.units[key] = unit
+	db.unitsMu.Unlock()
+	return true, nil
+}
+
+// seriesUnit returns the unit of the newest metric with a recorded unit, or "" if there is none
+func (db *DB) seriesUnit(location, metricType string) (string, error) {
+	query := `SELECT unit FROM metrics WHERE location = ? AND metric_type = ? AND unit <> '' ORDER BY timestamp DESC LIMIT 1`
+	queryStart := time.Now()
+	var unit string
+	err := db.conn.QueryRow(query, location, metricType).Scan(&unit)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	metrics.RecordDBQuery("SELECT", "metrics", time.Since(queryStart), err)
+	if err != nil {
+		return "", fmt.Errorf("failed to get stored unit of %s for %s: %w", metricType, location, err)
+	}
+	return unit, nil
+}
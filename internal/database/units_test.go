@@ -0,0 +1,86 @@
+package database
+
+import (
+	"preempt/internal/clock"
+	"preempt/internal/metrics"
+	"preempt/internal/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// unitMismatches reads how many readings of a field were skipped for a unit mismatch
+func unitMismatches(t *testing.T, field string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := metrics.MetricFieldsSkippedTotal.WithLabelValues(field, "unit_mismatch").Write(&m); err != nil {
+		t.Fatalf("read counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+// currentReading returns a current forecast holding one temperature in unit
+func currentReading(value float64, unit string) *models.Forecast {
+	forecast := &models.Forecast{Current: models.Current{Temperature2m: &value}}
+	forecast.CurrentUnits.Temperature2m = unit
+	return forecast
+}
+
+func TestStoreMetricsRejectsUnitMismatch(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	db := NewFromConn(conn)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	db.SetClock(clock.NewFake(now))
+	fields := []string{"temperature_2m"}
+	before := unitMismatches(t, "temperature_2m")
+
+	// Tokyo's series is stored in fahrenheit, a celsius reading is flagged and not inserted
+	mock.ExpectQuery("SELECT unit FROM metrics WHERE location = \\? AND metric_type = \\?").
+		WithArgs("Tokyo", "temperature_2m").
+		WillReturnRows(sqlmock.NewRows([]string{"unit"}).AddRow("°F"))
+	if err := db.StoreMetrics(currentReading(22.1, "°C"), "Tokyo", fields, false); err != nil {
+		t.Fatalf("StoreMetrics(°C): %v", err)
+	}
+	if got := unitMismatches(t, "temperature_2m") - before; got != 1 {
+		t.Errorf("unit mismatches counted %v, want 1", got)
+	}
+
+	// The matching unit goes in
+	mock.ExpectQuery("SELECT unit FROM metrics").
+		WithArgs("Tokyo", "temperature_2m").
+		WillReturnRows(sqlmock.NewRows([]string{"unit"}).AddRow("°F"))
+	mock.ExpectExec("INSERT INTO metrics").
+		WithArgs("Tokyo", now, "temperature_2m", 71.8, "°F").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := db.StoreMetrics(currentReading(71.8, "°F"), "Tokyo", fields, false); err != nil {
+		t.Fatalf("StoreMetrics(°F): %v", err)
+	}
+
+	// A new series adopts the first unit it is stored with, which is then cached
+	mock.ExpectQuery("SELECT unit FROM metrics").
+		WithArgs("Lima", "temperature_2m").
+		WillReturnRows(sqlmock.NewRows([]string{"unit"}))
+	mock.ExpectExec("INSERT INTO metrics").
+		WithArgs("Lima", now, "temperature_2m", 18.5, "°C").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	if err := db.StoreMetrics(currentReading(18.5, "°C"), "Lima", fields, false); err != nil {
+		t.Fatalf("StoreMetrics(Lima °C): %v", err)
+	}
+	if err := db.StoreMetrics(currentReading(65.3, "°F"), "Lima", fields, false); err != nil {
+		t.Fatalf("StoreMetrics(Lima °F): %v", err)
+	}
+	if got := unitMismatches(t, "temperature_2m") - before; got != 2 {
+		t.Errorf("unit mismatches counted %v, want 2", got)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"fmt"
+	"preempt/internal/metrics"
+	"time"
+)
+
+// GetLatestMetricTimes returns the timestamp of the newest metric stored for each location
+func (db *DB) GetLatestMetricTimes() (map[string]time.Time, error) {
+	queryStart := time.Now()
+	rows, err := db.conn.Query(`SELECT location, MAX(timestamp) FROM metrics GROUP BY location`)
+	metrics.RecordDBQuery("SELECT", "metrics", time.Since(queryStart), err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest metric times: %w", err)
+	}
+	defer rows.Close()
+
+	latest := make(map[string]time.Time)
+	for rows.Next() {
+		var location string
+		var at time.Time
+		if err := rows.Scan(&location, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan latest metric time: %w", err)
+		}
+		latest[location] = at
+	}
+
+	return latest, rows.Err()
+}
+
+// GetDetectionWatermarks returns, per location, the newest metric timestamp the last completed
+// detection run for it had seen
+func (db *DB) GetDetectionWatermarks() (map[string]time.Time, error) {
+	queryStart := time.Now()
+	rows, err := db.conn.Query(`SELECT location, last_metric_at FROM detection_watermarks`)
+	metrics.RecordDBQuery("SELECT", "detection_watermarks", time.Since(queryStart), err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get detection watermarks: %w", err)
+	}
+	defer rows.Close()
+
+	watermarks := make(map[string]time.Time)
+	for rows.Next() {
+		var location string
+		var at time.Time
+		if err := rows.Scan(&location, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan detection watermark: %w", err)
+		}
+		watermarks[location] = at
+	}
+
+	return watermarks, rows.Err()
+}
+
+// SetDetectionWatermark records that detection for location has covered metrics up to lastMetricAt
+func (db *DB) SetDetectionWatermark(location string, lastMetricAt time.Time) error {
+	query := `INSERT INTO detection_watermarks (location, last_metric_at, detected_at) VALUES (?, ?, ?)
+	          ON DUPLICATE KEY UPDATE last_metric_at = VALUES(last_metric_at), detected_at = VALUES(detected_at)`
+	queryStart := time.Now()
+	_, err := db.conn.Exec(query, location, lastMetricAt, db.clock.Now().UTC())
+	metrics.RecordDBQuery("UPSERT", "detection_watermarks", time.Since(queryStart), err)
+	if err != nil {
+		return fmt.Errorf("failed to set detection watermark for %s: %w", location, err)
+	}
+	return nil
+}
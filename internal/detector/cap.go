@@ -0,0 +1,117 @@
+package detector
+
+import (
+	"log"
+	"math"
+	"preempt/internal/models"
+	"sort"
+)
+
+// CapAnomalies limits each metric type to detection.max_anomalies_per_metric anomalies per run so a
+// haywire sensor can't flood storage and the suggester. A metric over the cap keeps its highest |z|
+// anomalies plus one high severity "excessive" marker at its peak, max in all, and gets a summary
+// event covering every anomaly it produced. Anomalies under the cap are returned unchanged.
+func (ad *AnomalyDetector) CapAnomalies(anomalies []models.Anomaly) ([]models.Anomaly, []models.AnomalyEvent) {
+	return capAnomalies(anomalies, ad.cfg.Detection.MaxAnomaliesPerMetric)
+}
+
+func capAnomalies(anomalies []models.Anomaly, max int) ([]models.Anomaly, []models.AnomalyEvent) {
+	if max <= 0 {
+		return anomalies, nil
+	}
+
+	type series struct {
+		location   string
+		metricType string
+	}
+	bySeries := make(map[series][]int)
+	for i, a := range anomalies {
+		s := series{a.Location, a.MetricType}
+		bySeries[s] = append(bySeries[s], i)
+	}
+
+	drop := make(map[int]bool)
+	var markers []models.Anomaly
+	var summaries []models.AnomalyEvent
+	for s, indexes := range bySeries {
+		if len(indexes) <= max {
+			continue
+		}
+
+		group := make([]models.Anomaly, len(indexes))
+		for i, idx := range indexes {
+			group[i] = anomalies[idx]
+		}
+		summary := summarizeAnomalies(group)
+		summaries = append(summaries, summary)
+
+		// Keep the strongest signals, the marker takes the last slot and stands in for the rest
+		sort.SliceStable(indexes, func(i, j int) bool {
+			return math.Abs(anomalies[indexes[i]].ZScore) > math.Abs(anomalies[indexes[j]].ZScore)
+		})
+		peak := anomalies[indexes[0]]
+		for _, idx := range indexes[max-1:] {
+			drop[idx] = true
+		}
+
+		markers = append(markers, models.Anomaly{
+			Location:   s.location,
+			Timestamp:  peak.Timestamp,
+			MetricType: s.metricType,
+			Value:      peak.Value,
+			ZScore:     peak.ZScore,
+			Severity:   "high",
+			Method:     "excessive",
+		})
+
+		log.Printf("  %s: %d anomalies exceed the cap of %d, keeping the strongest (min=%.2f, max=%.2f, peak z=%.2f)",
+			s.metricType, len(indexes), max, summary.MinValue, summary.MaxValue, summary.PeakZScore)
+	}
+
+	if len(summaries) == 0 {
+		return anomalies, nil
+	}
+
+	kept := make([]models.Anomaly, 0, len(anomalies)-len(drop)+len(markers))
+	for i, a := range anomalies {
+		if !drop[i] {
+			kept = append(kept, a)
+		}
+	}
+
+	return append(kept, markers...), summaries
+}
+
+// summarizeAnomalies folds one series' anomalies into a single event spanning all of them
+func summarizeAnomalies(anomalies []models.Anomaly) models.AnomalyEvent {
+	first := anomalies[0]
+	summary := models.AnomalyEvent{
+		Location:     first.Location,
+		MetricType:   first.MetricType,
+		StartTime:    first.Timestamp,
+		EndTime:      first.Timestamp,
+		PeakValue:    first.Value,
+		PeakZScore:   first.ZScore,
+		MinValue:     first.Value,
+		MaxValue:     first.Value,
+		Severity:     "high",
+		AnomalyCount: len(anomalies),
+	}
+
+	for _, a := range anomalies[1:] {
+		if a.Timestamp.Before(summary.StartTime) {
+			summary.StartTime = a.Timestamp
+		}
+		if a.Timestamp.After(summary.EndTime) {
+			summary.EndTime = a.Timestamp
+		}
+		if math.Abs(a.ZScore) > math.Abs(summary.PeakZScore) {
+			summary.PeakValue = a.Value
+			summary.PeakZScore = a.ZScore
+		}
+		summary.MinValue = math.Min(summary.MinValue, a.Value)
+		summary.MaxValue = math.Max(summary.MaxValue, a.Value)
+	}
+
+	return summary
+}
@@ -0,0 +1,95 @@
+package detector
+
+import (
+	"preempt/internal/config/configtest"
+	"preempt/internal/database/databasetest"
+	"preempt/internal/models"
+	"testing"
+	"time"
+)
+
+// runawaySeries returns n anomalies a minute apart, peaking at index peak
+func runawaySeries(n, peak int) []models.Anomaly {
+	anomalies := make([]models.Anomaly, n)
+	for i := range anomalies {
+		anomalies[i] = models.Anomaly{
+			Location:   "Tokyo",
+			Timestamp:  testNow.Add(-time.Duration(n-i) * time.Minute),
+			MetricType: "temperature_2m",
+			Value:      50 + float64(i%7),
+			ZScore:     3 + float64(i%5),
+			Severity:   "high",
+			Method:     "stats",
+		}
+	}
+	anomalies[peak].Value = 99
+	anomalies[peak].ZScore = 40
+	return anomalies
+}
+
+func TestCapAnomaliesOnTenThousandOutliers(t *testing.T) {
+	const n, max, peak = 10000, 500, 4321
+	anomalies := runawaySeries(n, peak)
+	other := models.Anomaly{Location: "Tokyo", Timestamp: testNow, MetricType: "precipitation", Value: 3, ZScore: 4, Severity: "high", Method: "stats"}
+
+	kept, summaries := capAnomalies(append(anomalies, other), max)
+
+	var temperature, markers []models.Anomaly
+	for _, a := range kept {
+		if a.MetricType == "temperature_2m" {
+			temperature = append(temperature, a)
+			if a.Method == "excessive" {
+				markers = append(markers, a)
+			}
+		}
+	}
+	if len(temperature) != max {
+		t.Errorf("kept %d temperature anomalies, want the cap of %d including the marker", len(temperature), max)
+	}
+	if len(kept) != max+1 {
+		t.Errorf("kept %d anomalies, want the capped metric plus the one under the cap", len(kept))
+	}
+
+	if len(markers) != 1 {
+		t.Fatalf("got %d markers, want 1", len(markers))
+	}
+	marker := markers[0]
+	if !marker.Timestamp.Equal(anomalies[peak].Timestamp) || marker.Value != 99 || marker.ZScore != 40 {
+		t.Errorf("marker at %s value %.0f z %.0f, want the peak at %s value 99 z 40",
+			marker.Timestamp, marker.Value, marker.ZScore, anomalies[peak].Timestamp)
+	}
+
+	if len(summaries) != 1 {
+		t.Fatalf("got %d summaries, want 1", len(summaries))
+	}
+	if s := summaries[0]; s.AnomalyCount != n || !s.StartTime.Equal(anomalies[0].Timestamp) || !s.EndTime.Equal(anomalies[n-1].Timestamp) {
+		t.Errorf("summary = %+v, want all %d anomalies spanned", s, n)
+	}
+}
+
+func TestSuggestAlarmsIgnoresCapMarkers(t *testing.T) {
+	as := newTestSuggester(t, configtest.Minimal)
+
+	// Two real anomalies plus a marker repeating one of them are below the three needed
+	anomalies := anomalySeries("Tokyo", "surface_pressure", 985, 982)
+	marker := anomalies[0]
+	marker.Method = "excessive"
+	if suggestions := as.SuggestAlarms(append(anomalies, marker), "Tokyo"); len(suggestions) != 0 {
+		t.Errorf("current run: got suggestions %+v, want none from two anomalies", suggestions)
+	}
+
+	// Markers stored by earlier runs, including ones not at a kept reading, don't count either
+	stored := marker
+	stored.Timestamp = testNow.Add(-30 * time.Minute)
+	store := databasetest.NewMemoryStore()
+	if err := store.StoreAnomalies([]models.Anomaly{stored}); err != nil {
+		t.Fatal(err)
+	}
+	suggestions, err := as.SuggestAlarmsWithHistory(store, anomalies, "Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 0 {
+		t.Errorf("with history: got suggestions %+v, want none from two anomalies", suggestions)
+	}
+}
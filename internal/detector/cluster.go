@@ -0,0 +1,100 @@
+package detector
+
+import (
+	"math"
+	"preempt/internal/models"
+	"sort"
+	"time"
+)
+
+// ClusterAnomalies groups anomalies of the same location and metric type whose timestamps are
+// within window of the previous anomaly into a single event, so a storm that flags dozens of
+// consecutive readings becomes one event spanning its start and end. Predicted (forecast)
+// anomalies are left out, events describe what was observed.
+func ClusterAnomalies(anomalies []models.Anomaly, window time.Duration) []models.AnomalyEvent {
+	// Sort a copy by series then time so each series' anomalies are contiguous
+	sorted := make([]models.Anomaly, 0, len(anomalies))
+	for _, a := range anomalies {
+		if a.Method != "forecast" {
+			sorted = append(sorted, a)
+		}
+	}
+	if len(sorted) == 0 {
+		return nil
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Location != sorted[j].Location {
+			return sorted[i].Location < sorted[j].Location
+		}
+		if sorted[i].MetricType != sorted[j].MetricType {
+			return sorted[i].MetricType < sorted[j].MetricType
+		}
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	var events []models.AnomalyEvent
+	var current *models.AnomalyEvent
+
+	for _, a := range sorted {
+		sameSeries := current != nil && current.Location == a.Location && current.MetricType == a.MetricType
+		if sameSeries && a.Timestamp.Sub(current.EndTime) <= window {
+			current.EndTime = a.Timestamp
+			current.AnomalyCount++
+			current.MinValue = math.Min(current.MinValue, a.Value)
+			current.MaxValue = math.Max(current.MaxValue, a.Value)
+			if math.Abs(a.ZScore) > math.Abs(current.PeakZScore) {
+				current.PeakValue = a.Value
+				current.PeakZScore = a.ZScore
+			}
+			if severityRank(a.Severity) > severityRank(current.Severity) {
+				current.Severity = a.Severity
+			}
+			continue
+		}
+
+		if current != nil {
+			events = append(events, *current)
+		}
+		current = &models.AnomalyEvent{
+			Location:     a.Location,
+			MetricType:   a.MetricType,
+			StartTime:    a.Timestamp,
+			EndTime:      a.Timestamp,
+			PeakValue:    a.Value,
+			PeakZScore:   a.ZScore,
+			MinValue:     a.Value,
+			MaxValue:     a.Value,
+			Severity:     a.Severity,
+			AnomalyCount: 1,
+		}
+	}
+	events = append(events, *current)
+
+	return events
+}
+
+// FilterBySeverity returns the anomalies at or above minSeverity, keeping their order
+func FilterBySeverity(anomalies []models.Anomaly, minSeverity string) []models.Anomaly {
+	minRank := severityRank(minSeverity)
+	var kept []models.Anomaly
+	for _, a := range anomalies {
+		if severityRank(a.Severity) >= minRank {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// severityRank orders severities so they can be compared, unknown severities rank lowest
+func severityRank(severity string) int {
+	switch severity {
+	case "high":
+		return 3
+	case "medium":
+		return 2
+	case "low":
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package detector
+
+import (
+	"preempt/internal/models"
+	"testing"
+	"time"
+)
+
+func TestClusterAnomaliesCollapsesBurstToOneEvent(t *testing.T) {
+	var burst []models.Anomaly
+	for i := 0; i < 12; i++ {
+		burst = append(burst, models.Anomaly{
+			Location:   "Tokyo",
+			MetricType: "temperature_2m",
+			Timestamp:  testNow.Add(time.Duration(i) * 5 * time.Minute),
+			Value:      100 + float64(i),
+			ZScore:     3 + float64(i%4),
+			Severity:   "medium",
+			Method:     "stats",
+		})
+	}
+	burst[7].Severity = "high"
+
+	// The same burst a run later, plus a predicted anomaly right after it
+	predicted := burst[11]
+	predicted.Timestamp = predicted.Timestamp.Add(5 * time.Minute)
+	predicted.Method = "forecast"
+	predicted.ZScore = 9
+
+	for run := 0; run < 2; run++ {
+		events := ClusterAnomalies(append(burst, predicted), 30*time.Minute)
+		if len(events) != 1 {
+			t.Fatalf("run %d: %d events, want the burst as one", run, len(events))
+		}
+		e := events[0]
+		if !e.StartTime.Equal(testNow) || !e.EndTime.Equal(burst[11].Timestamp) {
+			t.Errorf("run %d: event spans %s-%s, want the observed burst", run, e.StartTime, e.EndTime)
+		}
+		if e.AnomalyCount != 12 || e.Severity != "high" || e.PeakZScore != 6 {
+			t.Errorf("run %d: count %d, severity %s, peak z %.0f, want 12, high, 6", run, e.AnomalyCount, e.Severity, e.PeakZScore)
+		}
+		if e.MinValue != 100 || e.MaxValue != 111 {
+			t.Errorf("run %d: value range %.0f-%.0f, want 100-111", run, e.MinValue, e.MaxValue)
+		}
+	}
+}
+
+func TestClusterAnomaliesSkipsPredictedOnly(t *testing.T) {
+	predicted := []models.Anomaly{{Location: "Tokyo", MetricType: "temperature_2m", Timestamp: testNow, Method: "forecast", Severity: "high"}}
+	if events := ClusterAnomalies(predicted, 30*time.Minute); events != nil {
+		t.Errorf("got %d events from predicted anomalies, want none", len(events))
+	}
+}
@@ -6,19 +6,27 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"preempt/internal/clock"
 	"preempt/internal/config"
 	"preempt/internal/database"
 	"preempt/internal/models"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
-// AnomalyDetector detects anomalies in metrics data
+// maxStatsWorkers bounds how many metric types are scored concurrently per location
+const maxStatsWorkers = 4
+
+// AnomalyDetector detects anomalies in metrics data. It is safe for concurrent use once
+// configured: detection only reads its fields and keeps per-call state local, so SetClock
+// must be called before the detector is shared.
 type AnomalyDetector struct {
-	zScoreThreshold float64 // Standard deviations from mean to flag as anomaly
-	cfg             *config.Config
-	redisClient     *redis.Client
+	cfg         *config.Config
+	redisClient *redis.Client
+	clock       clock.Clock
 }
 
 // MLAnomalyResult represents the JSON output from the Python ML script
@@ -37,130 +45,351 @@ type MLAnomalyData struct {
 	Severity     string  `json:"severity"`
 }
 
-// NewAnomalyDetector creates a new anomaly detector
+// NewAnomalyDetector creates a new anomaly detector. With a nil redisClient only the stats
+// method runs, as when the ML service is unreachable.
 func NewAnomalyDetector(redisClient *redis.Client) *AnomalyDetector {
+	cfg := config.Get()
+	if warning := cfg.DetectionWindowWarning(); warning != "" {
+		log.Printf("Warning: %s", warning)
+	}
+
 	return &AnomalyDetector{
-		zScoreThreshold: 2.0, // Flag values more than 2 std devs from mean
-		cfg:             config.Get(),
-		redisClient:     redisClient,
+		cfg:         cfg,
+		redisClient: redisClient,
+		clock:       clock.Real{},
 	}
 }
 
+// SetClock replaces the clock used for detection windows, call it before any detection runs
+func (ad *AnomalyDetector) SetClock(c clock.Clock) {
+	ad.clock = c
+}
+
 // DetectAnomalies detects anomalies by querying historical metrics from the database and using z score and ML model
-func (ad *AnomalyDetector) DetectAnomalies(db *database.DB, location string) ([]models.Anomaly, error) {
+func (ad *AnomalyDetector) DetectAnomalies(ctx context.Context, db database.MetricsStore, location string) ([]models.Anomaly, error) {
 
 	stats_anomalies, err := ad.getStatsAnomalies(db, location)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get anomalies via stats method %s", err)
+		return nil, fmt.Errorf("failed to get anomalies via stats method: %w", err)
 	}
 
 	// Try ML detection, but use circuit breaker pattern - fall back to stats-only if ML fails
-	ml_anomalies, err := ad.getMLAnomalies(db, location)
+	ml_anomalies, err := ad.getMLAnomalies(ctx, db, location)
 	if err != nil {
+		if ctx.Err() != nil {
+			// Shutting down - keep what stats already found rather than discarding it
+			return stats_anomalies, nil
+		}
 		// ML service timeout or failure - continue with stats-based detection only
 		log.Printf("ML detection skipped for %s (using stats-only): %v", location, err)
 		return stats_anomalies, nil
 	}
 
-	//combine with stats z-score anomalies and return total list
-	anomalies := append(stats_anomalies, ml_anomalies...)
+	//combine with stats z-score anomalies and return total list, merging points both methods flagged
+	anomalies := dedupeAnomalies(append(stats_anomalies, ml_anomalies...))
 
 	return anomalies, nil
 }
 
-func (ad *AnomalyDetector) getStatsAnomalies(db *database.DB, location string) ([]models.Anomaly, error) {
+// dedupeAnomalies keeps one anomaly per (location, metric_type, timestamp), preferring the higher
+// severity and then the larger absolute score. Timestamps are compared at second precision since
+// the ML round trip serializes them as RFC3339. Order of first appearance is preserved.
+func dedupeAnomalies(anomalies []models.Anomaly) []models.Anomaly {
+	type key struct {
+		location   string
+		metricType string
+		timestamp  int64
+	}
+
+	index := make(map[key]int)
+	var result []models.Anomaly
+	for _, a := range anomalies {
+		k := key{a.Location, a.MetricType, a.Timestamp.Unix()}
+		i, seen := index[k]
+		if !seen {
+			index[k] = len(result)
+			result = append(result, a)
+			continue
+		}
+
+		existing := result[i]
+		if severityRank(a.Severity) > severityRank(existing.Severity) ||
+			(a.Severity == existing.Severity && math.Abs(a.ZScore) > math.Abs(existing.ZScore)) {
+			result[i] = a
+		}
+	}
+
+	return result
+}
+
+// DetectUpcomingAnomalies compares stored forecast values against the stats baseline window
+// and flags predictions that would be outliers if they came true
+func (ad *AnomalyDetector) DetectUpcomingAnomalies(db database.MetricsStore, location string) ([]models.Anomaly, error) {
+	var anomalies []models.Anomaly
+	now := ad.clock.Now()
+	metricTypes := ad.cfg.DetectedFields(location)
+	if len(metricTypes) == 0 {
+		return nil, nil // Every metric is disabled at this location
+	}
+
+	baselineWindow, _ := ad.cfg.Detection.Windows.Stats.Durations()
+	baseline, err := db.GetMetrics(location, metricTypes, now.Add(-baselineWindow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get baseline metrics: %w", err)
+	}
+
+	predicted, err := db.GetForecastMetrics(location, metricTypes, now, now.AddDate(0, 0, ad.cfg.Forecast.Days))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get forecast metrics: %w", err)
+	}
+
+	valuesByType := make(map[string][]float64)
+	for _, m := range baseline {
+		valuesByType[m.MetricType] = append(valuesByType[m.MetricType], m.Value)
+	}
+
+	for _, m := range predicted {
+		values := valuesByType[m.MetricType]
+		if len(values) < 3 {
+			continue // Not enough history to judge the prediction
+		}
+
+		mean := calculateMean(values)
+		stdDev, ok := ad.applyStdDevFloor(ad.baselineStdDev(values, mean))
+		if !ok {
+			continue
+		}
+
+		zScore := CalculateZScore(m.Value, mean, stdDev)
+		if ad.isRecordable(zScore) {
+			threshold := ad.cfg.MinZScore()
+			anomalies = append(anomalies, models.Anomaly{
+				Location:       location,
+				Timestamp:      m.Timestamp,
+				MetricType:     m.MetricType,
+				Value:          m.Value,
+				ZScore:         zScore,
+				Severity:       ad.calculateSeverityFromZScore(zScore),
+				Method:         "forecast",
+				BaselineMean:   &mean,
+				BaselineStdDev: &stdDev,
+				Threshold:      &threshold,
+			})
+		}
+	}
+
+	log.Printf("  forecast: found %d upcoming anomalies for %s", len(anomalies), location)
+	return anomalies, nil
+}
+
+func (ad *AnomalyDetector) getStatsAnomalies(db database.MetricsStore, location string) ([]models.Anomaly, error) {
+	return ad.statsAnomaliesAt(db, location, ad.clock.Now())
+}
+
+// ReplayStatsAnomalies runs the stats detector as it would have run at the end of every evaluation
+// window in (from, to], without storing anything. Overlapping findings are merged.
+func (ad *AnomalyDetector) ReplayStatsAnomalies(db database.MetricsStore, location string, from, to time.Time) ([]models.Anomaly, error) {
+	var anomalies []models.Anomaly
+	_, step := ad.cfg.Detection.Windows.Stats.Durations()
+	for at := from.Add(step); ; at = at.Add(step) {
+		if at.After(to) {
+			at = to
+		}
+
+		found, err := ad.statsAnomaliesAt(db, location, at)
+		if err != nil {
+			return nil, fmt.Errorf("replay at %s: %w", at.Format(time.RFC3339), err)
+		}
+		anomalies = append(anomalies, found...)
+
+		if !at.Before(to) {
+			break
+		}
+	}
+
+	return dedupeAnomalies(anomalies), nil
+}
+
+// statsAnomaliesAt scores the stats evaluation window before now against the baseline window before now.
+// Metrics newer than now are ignored so past points in time can be replayed.
+func (ad *AnomalyDetector) statsAnomaliesAt(db database.MetricsStore, location string, now time.Time) ([]models.Anomaly, error) {
 	var anomalies []models.Anomaly
-	now := time.Now()
 
 	// Define metric types list
-	metricTypes := ad.cfg.Weather.MonitoredFields
+	metricTypes := ad.cfg.DetectedFields(location)
+
+	metricsByType, recentByType, err := ad.loadStatsWindow(db, location, metricTypes, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Process each metric type independently. Results are kept per type and concatenated in
+	// config order so the output matches a sequential run exactly.
+	perType := make([][]models.Anomaly, len(metricTypes))
+	semaphore := make(chan struct{}, maxStatsWorkers)
+	var wg sync.WaitGroup
+	for i, metricType := range metricTypes {
+		wg.Add(1)
+		go func(i int, metricType string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			perType[i] = ad.statsAnomaliesForType(location, metricType, metricsByType[metricType], recentByType[metricType], now, nil)
+		}(i, metricType)
+	}
+	wg.Wait()
 
-	// Get historical data for the last 7 days
-	since := now.AddDate(0, 0, -7)
+	for _, found := range perType {
+		anomalies = append(anomalies, found...)
+	}
+
+	return anomalies, nil
+}
+
+// loadStatsWindow returns the baseline and evaluation windows before now, grouped by metric type
+func (ad *AnomalyDetector) loadStatsWindow(db database.MetricsStore, location string, metricTypes []string, now time.Time) (baseline, recent map[string][]models.Metric, err error) {
+	if len(metricTypes) == 0 {
+		return map[string][]models.Metric{}, map[string][]models.Metric{}, nil // Every metric is disabled at this location
+	}
+
+	baselineWindow, evaluationWindow := ad.cfg.Detection.Windows.Stats.Durations()
+
+	// Get historical data for the baseline window
+	since := now.Add(-baselineWindow)
 	metrics, err := db.GetMetrics(location, metricTypes, since)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get metrics %w", err)
+		return nil, nil, fmt.Errorf("failed to get metrics %w", err)
 	}
 
 	// Group metrics by type
-	metricsByType := make(map[string][]models.Metric)
+	baseline = make(map[string][]models.Metric)
 	for _, m := range metrics {
-		metricsByType[m.MetricType] = append(metricsByType[m.MetricType], m)
+		if m.Timestamp.After(now) {
+			continue
+		}
+		baseline[m.MetricType] = append(baseline[m.MetricType], m)
 	}
 
-	// Get recent metrics (last 24 hours) - single query
-	recentSince := now.Add(-24 * time.Hour)
+	// Get recent metrics (evaluation window) - single query
+	recentSince := now.Add(-evaluationWindow)
 	recentMetrics, err := db.GetMetrics(location, metricTypes, recentSince)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get recent metrics: %w", err)
+		return nil, nil, fmt.Errorf("failed to get recent metrics: %w", err)
 	}
 
 	// Group recent metrics by type
-	recentByType := make(map[string][]models.Metric)
+	recent = make(map[string][]models.Metric)
 	for _, m := range recentMetrics {
-		recentByType[m.MetricType] = append(recentByType[m.MetricType], m)
+		if m.Timestamp.After(now) {
+			continue
+		}
+		recent[m.MetricType] = append(recent[m.MetricType], m)
 	}
 
-	// Process each metric type independently
-	for _, metricType := range metricTypes {
-		metrics := metricsByType[metricType]
+	return baseline, recent, nil
+}
 
-		if len(metrics) < 3 {
-			log.Printf("Warning: not enough data for %s (%d samples)", metricType, len(metrics))
-			continue // Not enough data for statistical analysis
-		}
+// statsAnomaliesForType scores one metric type's recent readings against its baseline.
+// When diag is non-nil it is filled with the baseline and every scored point.
+func (ad *AnomalyDetector) statsAnomaliesForType(location, metricType string, metrics, recentForType []models.Metric, now time.Time, diag *MetricDiagnostic) []models.Anomaly {
+	var anomalies []models.Anomaly
 
-		// Extract values for THIS metric type
-		var values []float64
-		for _, m := range metrics {
-			values = append(values, m.Value)
-		}
+	// Metrics are ordered newest first, so the first entry tells us when data last arrived
+	if stale := ad.detectStaleness(location, metricType, metrics, now); stale != nil {
+		anomalies = append(anomalies, *stale)
+	}
 
-		// Calculate mean and std dev for THIS metric type
-		mean := calculateMean(values)
-		stdDev := calculateStdDev(values, mean)
+	if diag != nil {
+		diag.Samples = len(metrics)
+	}
 
-		log.Printf("  %s: mean=%.2f, stdDev=%.2f, samples=%d", metricType, mean, stdDev, len(values))
+	if len(metrics) < 3 {
+		log.Printf("Warning: not enough data for %s (%d samples)", metricType, len(metrics))
+		diag.skip(fmt.Sprintf("only %d samples in the baseline, need 3", len(metrics)), anomalies)
+		return anomalies // Not enough data for statistical analysis
+	}
+
+	// Extract values for THIS metric type
+	var values []float64
+	for _, m := range metrics {
+		values = append(values, m.Value)
+	}
+
+	// Calculate mean and std dev for THIS metric type
+	mean := calculateMean(values)
+	stdDev, ok := ad.applyStdDevFloor(ad.baselineStdDev(values, mean))
 
+	log.Printf("  %s: mean=%.2f, stdDev=%.2f, samples=%d", metricType, mean, stdDev, len(values))
+	if diag != nil {
+		diag.Mean = mean
+		diag.StdDev = stdDev
+	}
+
+	if !ok {
+		log.Printf("  %s: too little variation in data, skipping", metricType)
 		if stdDev == 0 {
-			log.Printf("  %s: no variation in data, skipping", metricType)
-			continue // No variation, no anomalies
+			diag.skip("no variation in the baseline", anomalies)
+		} else {
+			diag.skip(fmt.Sprintf("std dev %.4g in the baseline is below detection.min_stddev", stdDev), anomalies)
 		}
+		return anomalies // Near-constant data would turn tiny deviations into huge z-scores
+	}
 
-		// Get recent metrics for THIS metric type
-		recentForType := recentByType[metricType]
-
-		// Check each recent metric against THIS metric type's statistics from past 7 days
-		anomalyCount := 0
-		for _, m := range recentForType {
-			zScore := CalculateZScore(m.Value, mean, stdDev)
-			if IsOutlier(zScore) {
-				severity := calculateSeverityFromZScore(zScore)
-				anomalies = append(anomalies, models.Anomaly{
-					Location:   location,
-					Timestamp:  m.Timestamp,
-					MetricType: metricType,
-					Value:      m.Value,
-					ZScore:     zScore,
-					Severity:   severity,
-				})
-				anomalyCount++
-			}
-		}
+	if flat := ad.detectFlatline(location, metricType, metrics, recentForType); flat != nil {
+		anomalies = append(anomalies, *flat)
+	}
 
-		log.Printf("  %s: found %d anomalies", metricType, anomalyCount)
+	// Check each recent metric against THIS metric type's statistics from the baseline window.
+	// The baseline is kept on each anomaly so it can be explained later.
+	threshold := ad.cfg.MinZScore()
+	anomalyCount := 0
+	for _, m := range recentForType {
+		zScore := CalculateZScore(m.Value, mean, stdDev)
+		diag.addPoint(m, zScore, ad.isRecordable(zScore), ad.cfg.MinZScore())
+		if ad.isRecordable(zScore) {
+			severity := ad.calculateSeverityFromZScore(zScore)
+			anomalies = append(anomalies, models.Anomaly{
+				Location:       location,
+				Timestamp:      m.Timestamp,
+				MetricType:     metricType,
+				Value:          m.Value,
+				ZScore:         zScore,
+				Severity:       severity,
+				Method:         "stats",
+				BaselineMean:   &mean,
+				BaselineStdDev: &stdDev,
+				Threshold:      &threshold,
+			})
+			anomalyCount++
+		}
 	}
 
-	return anomalies, nil
+	log.Printf("  %s: found %d anomalies", metricType, anomalyCount)
+	if diag != nil {
+		diag.Anomalies = anomalies
+	}
+	return anomalies
 }
 
-func (ad *AnomalyDetector) getMLAnomalies(db *database.DB, location string) ([]models.Anomaly, error) {
+func (ad *AnomalyDetector) getMLAnomalies(ctx context.Context, db database.MetricsStore, location string) ([]models.Anomaly, error) {
 	var anomalies []models.Anomaly
-	ctx := context.Background()
 
-	// Get all metrics from the last 30 days
-	metricTypes := ad.cfg.Weather.MonitoredFields
-	since := time.Now().AddDate(0, 0, -30)
+	// Skip the baseline export entirely when shutdown has already started
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("ML detection cancelled before export: %w", err)
+	}
+	if ad.redisClient == nil {
+		return nil, fmt.Errorf("ML detection unavailable: no Redis client")
+	}
+
+	// Get all metrics in the ML baseline window, the model is trained on all of them
+	metricTypes := ad.cfg.DetectedFields(location)
+	if len(metricTypes) == 0 {
+		return anomalies, nil // Every metric is disabled at this location
+	}
+	now := ad.clock.Now()
+	baselineWindow, evaluationWindow := ad.cfg.Detection.Windows.ML.Durations()
+	since := now.Add(-baselineWindow)
 	metrics, err := db.GetMetrics(location, metricTypes, since)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get metrics: %w", err)
@@ -178,6 +407,15 @@ func (ad *AnomalyDetector) getMLAnomalies(db *database.DB, location string) ([]m
 		Value      float64 `json:"value"`
 	}
 
+	// GetMetrics returns newest first. The ML job gets each metric type's series in chronological
+	// order, as time-series models expect; Isolation Forest doesn't care but a replacement might.
+	sort.SliceStable(metrics, func(i, j int) bool {
+		if metrics[i].MetricType != metrics[j].MetricType {
+			return metrics[i].MetricType < metrics[j].MetricType
+		}
+		return metrics[i].Timestamp.Before(metrics[j].Timestamp)
+	})
+
 	var metricsData []MetricData
 	for _, m := range metrics {
 		metricsData = append(metricsData, MetricData{
@@ -188,7 +426,7 @@ func (ad *AnomalyDetector) getMLAnomalies(db *database.DB, location string) ([]m
 	}
 
 	// Create unique job ID
-	jobID := fmt.Sprintf("%s_%d", location, time.Now().Unix())
+	jobID := fmt.Sprintf("%s_%d", location, now.Unix())
 
 	// Get current position in ml_output stream before publishing job
 	lastID := "0-0"
@@ -209,6 +447,11 @@ func (ad *AnomalyDetector) getMLAnomalies(db *database.DB, location string) ([]m
 		return nil, fmt.Errorf("failed to marshal metrics: %w", err)
 	}
 
+	// Don't hand the ML service a job nobody will wait for
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("ML detection cancelled before publishing job %s: %w", jobID, err)
+	}
+
 	// Send to ML input stream
 	err = ad.redisClient.XAdd(ctx, &redis.XAddArgs{
 		Stream: "ml_input",
@@ -227,6 +470,8 @@ func (ad *AnomalyDetector) getMLAnomalies(db *database.DB, location string) ([]m
 
 	for {
 		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("ML detection cancelled for job %s: %w", jobID, ctx.Err())
 		case <-timeout:
 			return nil, fmt.Errorf("timeout waiting for ML results for job %s", jobID)
 		case <-ticker.C:
@@ -286,6 +531,10 @@ func (ad *AnomalyDetector) getMLAnomalies(db *database.DB, location string) ([]m
 								log.Printf("Failed to parse timestamp %s: %v", mlAnomaly.Timestamp, err)
 								continue
 							}
+							// Only report what falls in the evaluation window, like stats does
+							if timestamp.Before(now.Add(-evaluationWindow)) {
+								continue
+							}
 
 							anomaly := models.Anomaly{
 								Location:   location,
@@ -294,6 +543,7 @@ func (ad *AnomalyDetector) getMLAnomalies(db *database.DB, location string) ([]m
 								Value:      mlAnomaly.Value,
 								ZScore:     mlAnomaly.AnomalyScore,
 								Severity:   mlAnomaly.Severity,
+								Method:     "ml",
 							}
 							anomalies = append(anomalies, anomaly)
 						}
@@ -317,17 +567,153 @@ func (ad *AnomalyDetector) getMLAnomalies(db *database.DB, location string) ([]m
 	}
 }
 
-// calculateSeverityFromZScore determines severity based on Z-score
-func calculateSeverityFromZScore(zScore float64) string {
+// detectStaleness flags a metric whose newest reading is older than detection.staleness_after
+func (ad *AnomalyDetector) detectStaleness(location, metricType string, metrics []models.Metric, now time.Time) *models.Anomaly {
+	if len(metrics) == 0 {
+		return nil // Never collected, nothing to go stale
+	}
+
+	newest := metrics[0]
+	if now.Sub(newest.Timestamp) <= ad.cfg.StalenessAfter() {
+		return nil
+	}
+
+	log.Printf("  %s: stale, last reading at %s", metricType, newest.Timestamp.Format(time.RFC3339))
+	return &models.Anomaly{
+		Location:   location,
+		Timestamp:  newest.Timestamp,
+		MetricType: metricType,
+		Value:      newest.Value,
+		Severity:   ad.cfg.Detection.StalenessSeverity,
+		Method:     "staleness",
+	}
+}
+
+// detectFlatline flags a metric whose recent readings are all identical even though the
+// baseline readings just before them varied, which usually means a stuck sensor or upstream
+// feed. Both slices are newest first.
+func (ad *AnomalyDetector) detectFlatline(location, metricType string, baseline, recent []models.Metric) *models.Anomaly {
+	if len(recent) < 3 || ad.cfg.FlatlineExempt(metricType) || !allEqual(recent) {
+		return nil
+	}
+
+	// A value that was already constant before the recent window, e.g. cloud_cover at 100
+	// through overcast days, is the weather rather than a stuck feed
+	oldest := recent[len(recent)-1].Timestamp
+	var before []models.Metric
+	for _, m := range baseline {
+		if m.Timestamp.Before(oldest) {
+			before = append(before, m)
+			if len(before) == len(recent) {
+				break
+			}
+		}
+	}
+	if len(before) < 2 || allEqual(before) {
+		return nil
+	}
+
+	log.Printf("  %s: flatlined at %.2f over %d recent readings", metricType, recent[0].Value, len(recent))
+	return &models.Anomaly{
+		Location:   location,
+		Timestamp:  recent[0].Timestamp,
+		MetricType: metricType,
+		Value:      recent[0].Value,
+		Severity:   ad.cfg.Detection.FlatlineSeverity,
+		Method:     "flatline",
+	}
+}
+
+// allEqual reports whether every metric has the same value
+func allEqual(metrics []models.Metric) bool {
+	for _, m := range metrics[1:] {
+		if m.Value != metrics[0].Value {
+			return false
+		}
+	}
+	return true
+}
+
+// calculateSeverityFromZScore determines severity based on Z-score and the configured severity bands
+func (ad *AnomalyDetector) calculateSeverityFromZScore(zScore float64) string {
 	absZScore := math.Abs(zScore)
-	if absZScore > 2.0 {
+	if absZScore > ad.cfg.Detection.HighZScore {
 		return "high"
-	} else if absZScore > 1.5 {
+	} else if absZScore > ad.cfg.Detection.MediumZScore {
 		return "medium"
 	}
 	return "low"
 }
 
+// RecomputeSeverities re-derives the severity of stored stats anomalies in [from, until) from their
+// z-score using the current severity bands, so tightening the bands also relabels history.
+// Only anomalies from the stats method are touched since other methods don't store a z-score.
+// Returns the number of anomalies whose severity changed.
+func (ad *AnomalyDetector) RecomputeSeverities(ctx context.Context, db database.MetricsStore, from, until time.Time) (int, error) {
+	const batchSize = 500
+
+	updated := 0
+	var afterID int64
+	for {
+		batch, err := db.GetAnomaliesByMethod(ctx, "stats", from, until, afterID, batchSize)
+		if err != nil {
+			return updated, fmt.Errorf("failed to load anomalies: %w", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		changed := make(map[int64]string)
+		for _, a := range batch {
+			if severity := ad.calculateSeverityFromZScore(a.ZScore); severity != a.Severity {
+				changed[a.ID] = severity
+			}
+		}
+
+		if err := db.UpdateAnomalySeverities(ctx, changed); err != nil {
+			return updated, err
+		}
+		updated += len(changed)
+
+		afterID = batch[len(batch)-1].ID
+		if len(batch) < batchSize {
+			break
+		}
+	}
+
+	log.Printf("Recomputed anomaly severities between %s and %s: %d updated",
+		from.Format(time.RFC3339), until.Format(time.RFC3339), updated)
+	return updated, nil
+}
+
+// baselineStdDev is the standard deviation of a baseline as detection.stddev_type defines it
+func (ad *AnomalyDetector) baselineStdDev(values []float64, mean float64) float64 {
+	if ad.cfg.Detection.StdDevType == "population" {
+		return calculatePopulationStdDev(values, mean)
+	}
+	return calculateStdDev(values, mean)
+}
+
+// applyStdDevFloor enforces detection.min_stddev on a baseline's std dev. It returns false when the
+// metric should be skipped, either because there is no variation at all or because the std dev is
+// under the floor in "skip" mode. In "clamp" mode a std dev under the floor is raised to it.
+func (ad *AnomalyDetector) applyStdDevFloor(stdDev float64) (float64, bool) {
+	floor := ad.cfg.Detection.MinStdDev
+	if stdDev >= floor && stdDev > 0 {
+		return stdDev, true
+	}
+	if ad.cfg.Detection.MinStdDevMode == "clamp" && floor > 0 {
+		return floor, true
+	}
+	return stdDev, false
+}
+
+// isRecordable checks the z-score against detection.min_zscore, the floor for recording an anomaly,
+// which is independent of the bands used to grade its severity
+func (ad *AnomalyDetector) isRecordable(zScore float64) bool {
+	return math.Abs(zScore) > ad.cfg.MinZScore()
+}
+
 // CalculateZScore calculates the Z-score for a value given mean and standard deviation
 func CalculateZScore(value, mean, stdDev float64) float64 {
 	if stdDev == 0 {
@@ -335,8 +721,3 @@ func CalculateZScore(value, mean, stdDev float64) float64 {
 	}
 	return (value - mean) / stdDev
 }
-
-// IsOutlier checks if a Z-score indicates an outlier (> 2 std devs from mean)
-func IsOutlier(zScore float64) bool {
-	return math.Abs(zScore) > 1.0
-}
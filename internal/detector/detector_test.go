@@ -0,0 +1,255 @@
+package detector
+
+import (
+	"context"
+	"preempt/internal/clock"
+	"preempt/internal/config/configtest"
+	"preempt/internal/database/databasetest"
+	"preempt/internal/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestDetector loads yaml as the config and returns a detector on a clock frozen at testNow
+func newTestDetector(t *testing.T, yaml string) *AnomalyDetector {
+	t.Helper()
+	configtest.Use(t, yaml)
+	ad := NewAnomalyDetector(nil) // no Redis, so ML is skipped and detection is stats-only
+	ad.SetClock(clock.NewFake(testNow))
+	return ad
+}
+
+// hourlySeries returns one reading per hour over the week before testNow, alternating between low
+// and high so the baseline has a mean halfway between them and a std dev of about half their gap
+func hourlySeries(location, metricType string, low, high float64) []models.Metric {
+	var metrics []models.Metric
+	for h := 1; h <= 7*24; h++ {
+		value := low
+		if h%2 == 0 {
+			value = high
+		}
+		metrics = append(metrics, models.Metric{
+			Location:   location,
+			Timestamp:  testNow.Add(-time.Duration(h) * time.Hour),
+			MetricType: metricType,
+			Value:      value,
+		})
+	}
+	return metrics
+}
+
+func TestDetectAnomaliesFlagsSpikeFromMemoryStore(t *testing.T) {
+	ad := newTestDetector(t, `
+weather:
+  monitored_fields: [temperature_2m]
+`)
+	store := databasetest.NewMemoryStore()
+	store.AddMetrics(hourlySeries("Tokyo", "temperature_2m", 20, 22)...)
+	spikeAt := testNow.Add(-10 * time.Minute)
+	store.AddMetrics(models.Metric{Location: "Tokyo", Timestamp: spikeAt, MetricType: "temperature_2m", Value: 35})
+
+	anomalies, err := ad.DetectAnomalies(context.Background(), store, "Tokyo")
+	if err != nil {
+		t.Fatalf("DetectAnomalies: %v", err)
+	}
+
+	var spike *models.Anomaly
+	for i, a := range anomalies {
+		if a.Timestamp.Equal(spikeAt) {
+			spike = &anomalies[i]
+		}
+	}
+	if spike == nil {
+		t.Fatalf("spike at %s not flagged, got %+v", spikeAt, anomalies)
+	}
+	if spike.Method != "stats" || spike.Severity != "high" || spike.Value != 35 {
+		t.Errorf("spike = %+v, want a high stats anomaly with value 35", *spike)
+	}
+	if spike.BaselineMean == nil || *spike.BaselineMean < 20 || *spike.BaselineMean > 22.5 {
+		t.Errorf("baseline mean = %v, want about 21", spike.BaselineMean)
+	}
+
+	// Readings inside the normal range stay quiet
+	for _, a := range anomalies {
+		if a.Method == "stats" && !a.Timestamp.Equal(spikeAt) && a.Severity == "high" {
+			t.Errorf("normal reading flagged high: %+v", a)
+		}
+	}
+}
+
+func TestDetectAnomaliesSkipsDisabledMetric(t *testing.T) {
+	ad := newTestDetector(t, `
+weather:
+  monitored_fields: [temperature_2m]
+detection:
+  disabled_metrics:
+    Tokyo: [temperature_2m]
+`)
+	store := databasetest.NewMemoryStore()
+	store.AddMetrics(hourlySeries("Tokyo", "temperature_2m", 20, 22)...)
+	store.AddMetrics(models.Metric{Location: "Tokyo", Timestamp: testNow.Add(-time.Minute), MetricType: "temperature_2m", Value: 60})
+
+	anomalies, err := ad.DetectAnomalies(context.Background(), store, "Tokyo")
+	if err != nil {
+		t.Fatalf("DetectAnomalies: %v", err)
+	}
+	if len(anomalies) != 0 {
+		t.Errorf("disabled metric produced anomalies: %+v", anomalies)
+	}
+}
+
+func TestDetectUpcomingAnomaliesStoredOncePerPrediction(t *testing.T) {
+	ad := newTestDetector(t, `
+weather:
+  monitored_fields: [temperature_2m]
+forecast:
+  enabled: true
+  days: 2
+`)
+	store := databasetest.NewMemoryStore()
+	store.AddMetrics(hourlySeries("Tokyo", "temperature_2m", 20, 22)...)
+	predictedAt := testNow.Add(6 * time.Hour)
+	store.AddForecastMetrics(
+		models.Metric{Location: "Tokyo", Timestamp: predictedAt, MetricType: "temperature_2m", Value: 35},
+		models.Metric{Location: "Tokyo", Timestamp: predictedAt.Add(time.Hour), MetricType: "temperature_2m", Value: 21},
+	)
+
+	// Each detect run predicts the same outlier again
+	for run := 0; run < 3; run++ {
+		upcoming, err := ad.DetectUpcomingAnomalies(store, "Tokyo")
+		if err != nil {
+			t.Fatalf("run %d: DetectUpcomingAnomalies: %v", run, err)
+		}
+		if len(upcoming) != 1 || upcoming[0].Method != "forecast" || !upcoming[0].Timestamp.Equal(predictedAt) {
+			t.Fatalf("run %d: upcoming = %+v, want the outlier at %s", run, upcoming, predictedAt)
+		}
+		if err := store.StoreAnomalies(upcoming); err != nil {
+			t.Fatalf("run %d: StoreAnomalies: %v", run, err)
+		}
+	}
+
+	stored, err := store.GetAnomalies("Tokyo", 100)
+	if err != nil {
+		t.Fatalf("GetAnomalies: %v", err)
+	}
+	if len(stored) != 1 {
+		t.Errorf("stored %d anomalies after three runs, want 1", len(stored))
+	}
+}
+
+func TestMinZScoreFloorDecidesWhatIsRecorded(t *testing.T) {
+	// 21.5 sits half a std dev above the 20/22 baseline's mean
+	tests := []struct {
+		name     string
+		yaml     string
+		recorded bool
+	}{
+		{name: "default floor", yaml: "", recorded: false},
+		{name: "explicit zero", yaml: "detection:\n  min_zscore: 0\n", recorded: true},
+		{name: "floor above the reading", yaml: "detection:\n  min_zscore: 0.6\n", recorded: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ad := newTestDetector(t, "weather:\n  monitored_fields: [temperature_2m]\n"+tt.yaml)
+			store := databasetest.NewMemoryStore()
+			store.AddMetrics(hourlySeries("Tokyo", "temperature_2m", 20, 22)...)
+			readingAt := testNow.Add(-10 * time.Minute)
+			store.AddMetrics(models.Metric{Location: "Tokyo", Timestamp: readingAt, MetricType: "temperature_2m", Value: 21.5})
+
+			recorded := false
+			for _, a := range anomaliesByMethod(t, ad, store, "stats") {
+				if a.Timestamp.Equal(readingAt) {
+					recorded = true
+				}
+			}
+			if recorded != tt.recorded {
+				t.Errorf("reading at |z| 0.5 recorded = %v, want %v", recorded, tt.recorded)
+			}
+		})
+	}
+}
+
+func TestDedupeAnomaliesMergesStatsAndMLDetections(t *testing.T) {
+	at := testNow.Add(-30*time.Minute + 250*time.Millisecond)
+	point := func(metricType, method, severity string, zScore float64, ts time.Time) models.Anomaly {
+		return models.Anomaly{Location: "Tokyo", Timestamp: ts, MetricType: metricType, Value: 35, ZScore: zScore, Severity: severity, Method: method}
+	}
+
+	stats := []models.Anomaly{
+		point("temperature_2m", "stats", "medium", 1.8, at),
+		point("surface_pressure", "stats", "high", -3.1, at),
+		point("temperature_2m", "stats", "high", 2.4, at.Add(time.Hour)),
+	}
+	// ML timestamps come back from RFC3339 without the sub-second part
+	ml := []models.Anomaly{
+		point("temperature_2m", "ml", "high", 0.9, at.Truncate(time.Second)),
+		point("surface_pressure", "ml", "high", -0.7, at.Truncate(time.Second)),
+		point("temperature_2m", "ml", "high", 3.6, at.Add(time.Hour)),
+	}
+
+	merged := dedupeAnomalies(append(stats, ml...))
+
+	want := []struct {
+		metricType string
+		at         time.Time
+		method     string
+	}{
+		{"temperature_2m", at, "ml"},                // higher severity wins
+		{"surface_pressure", at, "stats"},           // same severity, larger |z| wins
+		{"temperature_2m", at.Add(time.Hour), "ml"}, // same severity, larger |z| wins
+	}
+	if len(merged) != len(want) {
+		t.Fatalf("got %d anomalies, want one per point: %+v", len(merged), merged)
+	}
+	for i, w := range want {
+		got := merged[i]
+		if got.MetricType != w.metricType || got.Timestamp.Unix() != w.at.Unix() || got.Method != w.method {
+			t.Errorf("anomaly %d = %s at %s by %s, want %s at %s by %s",
+				i, got.MetricType, got.Timestamp, got.Method, w.metricType, w.at, w.method)
+		}
+	}
+}
+
+func TestStatsAnomaliesMatchSequentialScoring(t *testing.T) {
+	// More metric types than maxStatsWorkers, so some wait for a free worker
+	metricTypes := []string{"temperature_2m", "relative_humidity_2m", "precipitation", "wind_speed_10m",
+		"dew_point_2m", "apparent_temperature", "surface_pressure", "cloud_cover"}
+	ad := newTestDetector(t, "weather:\n  monitored_fields: ["+strings.Join(metricTypes, ", ")+"]\n")
+
+	store := databasetest.NewMemoryStore()
+	for i, metricType := range metricTypes {
+		low := float64(10 * (i + 1))
+		store.AddMetrics(hourlySeries("Tokyo", metricType, low, low+2)...)
+		for m := 1; m <= 3; m++ {
+			store.AddMetrics(models.Metric{Location: "Tokyo", Timestamp: testNow.Add(-time.Duration(m*10) * time.Minute), MetricType: metricType, Value: low + float64(m*3)})
+		}
+	}
+
+	baseline, recent, err := ad.loadStatsWindow(store, "Tokyo", metricTypes, testNow)
+	if err != nil {
+		t.Fatalf("loadStatsWindow: %v", err)
+	}
+	var sequential []models.Anomaly
+	for _, metricType := range metricTypes {
+		sequential = append(sequential, ad.statsAnomaliesForType("Tokyo", metricType, baseline[metricType], recent[metricType], testNow, nil)...)
+	}
+	if len(sequential) == 0 {
+		t.Fatal("sequential scoring found nothing, the comparison would be vacuous")
+	}
+
+	// Repeated so a scheduling-dependent order would show up
+	for run := 0; run < 20; run++ {
+		parallel, err := ad.getStatsAnomalies(store, "Tokyo")
+		if err != nil {
+			t.Fatalf("getStatsAnomalies: %v", err)
+		}
+		if !reflect.DeepEqual(parallel, sequential) {
+			t.Fatalf("run %d: parallel scoring differs from sequential\n got %+v\nwant %+v", run, parallel, sequential)
+		}
+	}
+}
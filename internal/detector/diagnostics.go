@@ -0,0 +1,90 @@
+package detector
+
+import (
+	"fmt"
+	"math"
+	"preempt/internal/database"
+	"preempt/internal/models"
+	"time"
+)
+
+// StatsDiagnostic is a detailed breakdown of a stats detection run, for tuning rather than storage
+type StatsDiagnostic struct {
+	Location  string             `json:"location"`
+	RunAt     time.Time          `json:"run_at"`
+	MinZScore float64            `json:"min_zscore"`
+	Metrics   []MetricDiagnostic `json:"metrics"`
+}
+
+// MetricDiagnostic holds the baseline statistics and scored points for one metric type
+type MetricDiagnostic struct {
+	MetricType string            `json:"metric_type"`
+	Samples    int               `json:"samples"` // readings in the baseline window
+	Mean       float64           `json:"mean"`
+	StdDev     float64           `json:"std_dev"`
+	Skipped    string            `json:"skipped,omitempty"` // why no points were scored, if none were
+	Points     []PointDiagnostic `json:"points"`
+	Anomalies  []models.Anomaly  `json:"anomalies"` // what a detection run would store, including staleness and flatline
+}
+
+// PointDiagnostic is one recent reading and how it scored against the baseline
+type PointDiagnostic struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	ZScore    float64   `json:"z_score"`
+	Flagged   bool      `json:"flagged"`
+	Reason    string    `json:"reason"`
+}
+
+// DiagnoseStats runs the stats detector for a location and reports every step without storing anything
+func (ad *AnomalyDetector) DiagnoseStats(db database.MetricsStore, location string) (*StatsDiagnostic, error) {
+	now := ad.clock.Now()
+	metricTypes := ad.cfg.DetectedFields(location)
+
+	baseline, recent, err := ad.loadStatsWindow(db, location, metricTypes, now)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &StatsDiagnostic{
+		Location:  location,
+		RunAt:     now,
+		MinZScore: ad.cfg.MinZScore(),
+	}
+	for _, metricType := range metricTypes {
+		diag := MetricDiagnostic{MetricType: metricType}
+		ad.statsAnomaliesForType(location, metricType, baseline[metricType], recent[metricType], now, &diag)
+		result.Metrics = append(result.Metrics, diag)
+	}
+
+	return result, nil
+}
+
+// skip records why a metric type was not scored, safe to call on a nil diagnostic
+func (d *MetricDiagnostic) skip(reason string, anomalies []models.Anomaly) {
+	if d == nil {
+		return
+	}
+	d.Skipped = reason
+	d.Anomalies = anomalies
+}
+
+// addPoint records a scored reading, safe to call on a nil diagnostic
+func (d *MetricDiagnostic) addPoint(m models.Metric, zScore float64, flagged bool, minZScore float64) {
+	if d == nil {
+		return
+	}
+
+	reason := fmt.Sprintf("|z| %.2f does not exceed min_zscore %.2f", math.Abs(zScore), minZScore)
+	if flagged {
+		reason = fmt.Sprintf("|z| %.2f exceeds min_zscore %.2f", math.Abs(zScore), minZScore)
+	}
+
+	d.Points = append(d.Points, PointDiagnostic{
+		Timestamp: m.Timestamp,
+		Value:     m.Value,
+		ZScore:    zScore,
+		Flagged:   flagged,
+		Reason:    reason,
+	})
+}
@@ -0,0 +1,134 @@
+package detector
+
+import (
+	"context"
+	"preempt/internal/database/databasetest"
+	"preempt/internal/models"
+	"testing"
+	"time"
+)
+
+// anomaliesByMethod runs detection for Tokyo and returns the anomalies produced by method
+func anomaliesByMethod(t *testing.T, ad *AnomalyDetector, store *databasetest.MemoryStore, method string) []models.Anomaly {
+	t.Helper()
+
+	anomalies, err := ad.DetectAnomalies(context.Background(), store, "Tokyo")
+	if err != nil {
+		t.Fatalf("DetectAnomalies: %v", err)
+	}
+	var matched []models.Anomaly
+	for _, a := range anomalies {
+		if a.Method == method {
+			matched = append(matched, a)
+		}
+	}
+	return matched
+}
+
+func TestStalenessAnomalyUsesConfiguredSeverity(t *testing.T) {
+	for _, severity := range []string{"low", "high"} {
+		ad := newTestDetector(t, `
+weather:
+  monitored_fields: [temperature_2m]
+detection:
+  staleness_after: "2h"
+  staleness_severity: "`+severity+`"
+`)
+		// Collection stopped 6 hours ago
+		store := databasetest.NewMemoryStore()
+		for _, m := range hourlySeries("Tokyo", "temperature_2m", 20, 22) {
+			if testNow.Sub(m.Timestamp) >= 6*time.Hour {
+				store.AddMetrics(m)
+			}
+		}
+
+		stale := anomaliesByMethod(t, ad, store, "staleness")
+		if len(stale) != 1 {
+			t.Fatalf("%s: got %d staleness anomalies, want 1", severity, len(stale))
+		}
+		if stale[0].Severity != severity {
+			t.Errorf("staleness severity = %q, want the configured %q", stale[0].Severity, severity)
+		}
+		if !stale[0].Timestamp.Equal(testNow.Add(-6 * time.Hour)) {
+			t.Errorf("staleness anomaly at %s, want the last reading", stale[0].Timestamp)
+		}
+	}
+}
+
+func TestFlatlineAnomalyUsesConfiguredSeverity(t *testing.T) {
+	for _, severity := range []string{"medium", "high"} {
+		ad := newTestDetector(t, `
+weather:
+  monitored_fields: [temperature_2m]
+detection:
+  flatline_severity: "`+severity+`"
+`)
+		// The baseline varies, then the sensor reports the same value for the whole evaluation window
+		store := databasetest.NewMemoryStore()
+		for _, m := range hourlySeries("Tokyo", "temperature_2m", 20, 22) {
+			if testNow.Sub(m.Timestamp) <= 24*time.Hour {
+				m.Value = 21
+			}
+			store.AddMetrics(m)
+		}
+
+		flat := anomaliesByMethod(t, ad, store, "flatline")
+		if len(flat) != 1 {
+			t.Fatalf("%s: got %d flatline anomalies, want 1", severity, len(flat))
+		}
+		if flat[0].Severity != severity || flat[0].Value != 21 {
+			t.Errorf("flatline = %+v, want the configured %q at 21", flat[0], severity)
+		}
+	}
+}
+
+func TestFlatlineIgnoresLegitimatelyConstantSeries(t *testing.T) {
+	ad := newTestDetector(t, `
+weather:
+  monitored_fields: [cloud_cover, precipitation]
+`)
+	store := databasetest.NewMemoryStore()
+	for h := 1; h <= 7*24; h++ {
+		at := testNow.Add(-time.Duration(h) * time.Hour)
+
+		// Overcast for the last three days, varying before that
+		cover := 100.0
+		if h > 72 {
+			cover = float64(40 + h%50)
+		}
+		// Rain until yesterday, then a dry spell
+		rain := 0.0
+		if h > 24 && h%3 == 0 {
+			rain = 0.2
+		}
+		store.AddMetrics(
+			models.Metric{Location: "Tokyo", Timestamp: at, MetricType: "cloud_cover", Value: cover},
+			models.Metric{Location: "Tokyo", Timestamp: at, MetricType: "precipitation", Value: rain},
+		)
+	}
+
+	if flat := anomaliesByMethod(t, ad, store, "flatline"); len(flat) != 0 {
+		t.Errorf("constant weather flagged as flatlined: %+v", flat)
+	}
+}
+
+func TestFlatlineExemptCanBeCleared(t *testing.T) {
+	ad := newTestDetector(t, `
+weather:
+  monitored_fields: [precipitation]
+detection:
+  flatline_exempt: []
+`)
+	// Rain every other hour, then nothing for the whole evaluation window
+	store := databasetest.NewMemoryStore()
+	for _, m := range hourlySeries("Tokyo", "precipitation", 0, 0.3) {
+		if testNow.Sub(m.Timestamp) <= 24*time.Hour {
+			m.Value = 0
+		}
+		store.AddMetrics(m)
+	}
+
+	if flat := anomaliesByMethod(t, ad, store, "flatline"); len(flat) != 1 {
+		t.Errorf("got %d flatline anomalies with no exemptions, want 1", len(flat))
+	}
+}
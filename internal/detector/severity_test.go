@@ -0,0 +1,52 @@
+package detector
+
+import (
+	"context"
+	"preempt/internal/database/databasetest"
+	"preempt/internal/models"
+	"testing"
+	"time"
+)
+
+func TestRecomputeSeveritiesRelabelsAfterBandChange(t *testing.T) {
+	store := databasetest.NewMemoryStore()
+	at := testNow.Add(-time.Hour)
+	err := store.StoreAnomalies([]models.Anomaly{
+		{Location: "Tokyo", Timestamp: at, MetricType: "temperature_2m", Value: 30, ZScore: 1.8, Severity: "medium", Method: "stats"},
+		{Location: "Tokyo", Timestamp: at, MetricType: "precipitation", Value: 9, ZScore: 0.9, Severity: "medium", Method: "ml"},
+	})
+	if err != nil {
+		t.Fatalf("StoreAnomalies: %v", err)
+	}
+
+	// z=1.8 is medium under the default bands (1.5, 2.0) and high once high_zscore drops to 1.7
+	ad := newTestDetector(t, `
+weather:
+  monitored_fields: [temperature_2m, precipitation]
+detection:
+  medium_zscore: 1.2
+  high_zscore: 1.7
+`)
+
+	updated, err := ad.RecomputeSeverities(context.Background(), store, time.Time{}, testNow)
+	if err != nil {
+		t.Fatalf("RecomputeSeverities: %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("updated = %d, want 1", updated)
+	}
+
+	anomalies, _ := store.GetAnomaliesSince("Tokyo", time.Time{})
+	for _, a := range anomalies {
+		switch a.Method {
+		case "stats":
+			if a.Severity != "high" {
+				t.Errorf("stats anomaly severity = %q, want high", a.Severity)
+			}
+		case "ml":
+			if a.Severity != "medium" {
+				t.Errorf("ml anomaly was relabelled to %q, its score isn't a z-score", a.Severity)
+			}
+		}
+	}
+}
@@ -1,32 +1,68 @@
 package detector
 
 import (
+	"fmt"
 	"math"
+	"preempt/internal/clock"
+	"preempt/internal/config"
+	"preempt/internal/database"
 	"preempt/internal/models"
 	"time"
 )
 
-// AlarmSuggester suggests alarms based on detected anomalies
+const (
+	// confidenceHalfLife is how long until an anomaly counts half as much toward confidence
+	confidenceHalfLife = 24 * time.Hour
+	// confidencePseudoCount damps confidence for small samples: with this many fresh anomalies
+	// the sample factor is 0.5, approaching 1 as more corroborating anomalies arrive
+	confidencePseudoCount = 3.0
+)
+
+// AlarmSuggester suggests alarms based on detected anomalies. Like AnomalyDetector it is safe
+// for concurrent use once configured, SetClock must be called before it is shared.
 type AlarmSuggester struct {
 	minAnomaliesForSuggestion int
+	minSeverity               string                           // anomalies below this severity are ignored
+	historyWindow             time.Duration                    // how far back stored anomalies count toward a suggestion
+	confidenceWindow          time.Duration                    // only anomalies this recent feed confidence, 0 uses all
+	rules                     map[string]config.SuggestionRule // per-metric overrides from config
+	metricDisabled            func(location, metricType string) bool
+	weighted                  bool // weight values by |z|, suggestion.weighting
+	clock                     clock.Clock
 }
 
 // NewAlarmSuggester creates a new alarm suggester
 func NewAlarmSuggester() *AlarmSuggester {
 	return &AlarmSuggester{
 		minAnomaliesForSuggestion: 3, // Suggest after 3 similar anomalies
+		minSeverity:               config.Get().Suggestion.MinSeverity,
+		historyWindow:             config.Get().SuggestionHistoryWindow(),
+		confidenceWindow:          config.Get().SuggestionConfidenceWindow(),
+		rules:                     config.Get().Suggestion.Rules,
+		metricDisabled:            config.Get().MetricDisabled,
+		weighted:                  config.Get().Suggestion.Weighting != "none",
+		clock:                     clock.Real{},
 	}
 }
 
+// SetClock replaces the clock used to timestamp suggestions, call it before any suggestions are made
+func (as *AlarmSuggester) SetClock(c clock.Clock) {
+	as.clock = c
+}
+
 // SuggestAlarms analyzes anomalies and suggests alarms to prevent future issues
 func (as *AlarmSuggester) SuggestAlarms(anomalies []models.Anomaly, location string) []models.AlarmSuggestion {
 	if len(anomalies) == 0 {
 		return nil
 	}
 
-	// Group anomalies by metric type
+	// Group anomalies by metric type, skipping those that say nothing about a threshold, below the
+	// severity floor or disabled at the location
 	anomaliesByType := make(map[string][]models.Anomaly)
 	for _, a := range anomalies {
+		if !suggestsThreshold(a) || severityRank(a.Severity) < severityRank(as.minSeverity) || as.metricDisabled(location, a.MetricType) {
+			continue
+		}
 		anomaliesByType[a.MetricType] = append(anomaliesByType[a.MetricType], a)
 	}
 
@@ -44,19 +80,72 @@ func (as *AlarmSuggester) SuggestAlarms(anomalies []models.Anomaly, location str
 	return suggestions
 }
 
+// SuggestAlarmsWithHistory is SuggestAlarms over the current run's anomalies plus those stored for the
+// location within the history window, so a pattern recurring across runs (e.g. weekly) still
+// accumulates toward a suggestion. Stored anomalies are filtered like the current run's.
+func (as *AlarmSuggester) SuggestAlarmsWithHistory(db database.MetricsStore, anomalies []models.Anomaly, location string) ([]models.AlarmSuggestion, error) {
+	stored, err := db.GetAnomaliesSince(location, as.clock.Now().Add(-as.historyWindow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load anomaly history: %w", err)
+	}
+
+	combined := append([]models.Anomaly{}, anomalies...)
+	for _, a := range stored {
+		if suggestsThreshold(a) {
+			combined = append(combined, a)
+		}
+	}
+
+	// Overlapping detection windows store the same point on consecutive runs
+	return as.SuggestAlarms(dedupeAnomalies(combined), location), nil
+}
+
+// suggestsThreshold reports whether an anomaly's value says anything about where an alarm should
+// sit. Predictions haven't happened, a cap's "excessive" marker repeats a reading that is kept as
+// well, and staleness and flatline anomalies (z = 0) describe a broken feed, not the weather.
+func suggestsThreshold(a models.Anomaly) bool {
+	switch a.Method {
+	case "forecast", "excessive", "staleness", "flatline":
+		return false
+	}
+	return true
+}
+
+// PreviewSuggestion returns the suggestion SuggestAlarmsWithHistory would produce for one metric from
+// the location's stored anomalies, or nil if it wouldn't produce one. Nothing is stored.
+func (as *AlarmSuggester) PreviewSuggestion(db database.MetricsStore, location, metricType string) (*models.AlarmSuggestion, error) {
+	suggestions, err := as.SuggestAlarmsWithHistory(db, nil, location)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range suggestions {
+		if suggestions[i].MetricType == metricType {
+			return &suggestions[i], nil
+		}
+	}
+	return nil, nil
+}
+
 // generateSuggestion creates an alarm suggestion for a metric with repeated anomalies
 func (as *AlarmSuggester) generateSuggestion(metricType string, anomalies []models.Anomaly, location string) *models.AlarmSuggestion {
 	if len(anomalies) == 0 {
 		return nil
 	}
 
-	// Calculate statistics
+	// Calculate statistics, weighting each anomaly by |z| so extreme ones pull the threshold more.
+	// With weighting off every anomaly counts once, giving the plain mean and sample standard deviation.
 	values := make([]float64, len(anomalies))
+	weights := make([]float64, len(anomalies))
 	maxValue := math.Inf(-1)
 	minValue := math.Inf(1)
 
 	for i, a := range anomalies {
 		values[i] = a.Value
+		weights[i] = 1
+		if as.weighted {
+			weights[i] = math.Abs(a.ZScore)
+		}
 		if a.Value > maxValue {
 			maxValue = a.Value
 		}
@@ -65,16 +154,31 @@ func (as *AlarmSuggester) generateSuggestion(metricType string, anomalies []mode
 		}
 	}
 
-	mean := calculateMean(values)
-	stdDev := calculateStdDev(values, mean)
+	mean := calculateWeightedMean(values, weights)
+	stdDev := calculateWeightedStdDev(values, weights, mean)
 
 	// Suggest threshold based on anomaly pattern
 	var threshold float64
 	var operator string
 	var description string
 
-	switch metricType {
-	case "temperature_2m":
+	rule, hasRule := as.rules[metricType]
+
+	switch {
+	case hasRule:
+		// Operator-declared rule wins over the built-in heuristics
+		operator = rule.Operator
+		if operator == ">" {
+			threshold = mean + (rule.SigmaMultiplier * stdDev)
+		} else {
+			threshold = mean - (rule.SigmaMultiplier * stdDev)
+		}
+		description = rule.Description
+		if description == "" {
+			description = fmt.Sprintf("%s %s %.1fσ from its anomaly mean", metricType, operator, rule.SigmaMultiplier)
+		}
+
+	case metricType == "temperature_2m":
 		if mean > 30 {
 			// High temperatures - suggest upper threshold
 			threshold = mean + (2 * stdDev)
@@ -85,9 +189,36 @@ func (as *AlarmSuggester) generateSuggestion(metricType string, anomalies []mode
 			threshold = mean - (2 * stdDev)
 			operator = "<"
 			description = "Temperature dropping below safe operational limits"
+		} else {
+			return nil // Anomalies around a mild mean point to no side worth alarming on
+		}
+
+	case metricType == "apparent_temperature":
+		if mean > 30 {
+			threshold = mean + (2 * stdDev)
+			operator = ">"
+			description = "Feels-like temperature reaching heat stress levels"
+		} else if mean < 0 {
+			threshold = mean - (2 * stdDev)
+			operator = "<"
+			description = "Feels-like temperature reaching cold stress levels"
+		} else {
+			return nil
 		}
 
-	case "relative_humidity_2m":
+	case metricType == "surface_pressure":
+		// Falling pressure precedes storms, so only drops are worth alarming on
+		threshold = mean - (2 * stdDev)
+		operator = "<"
+		description = "Surface pressure dropping, storm conditions likely"
+
+	case metricType == "cloud_cover":
+		// Heavy cover cuts solar output, clear skies are never a problem
+		threshold = mean + stdDev
+		operator = ">"
+		description = "Cloud cover heavy enough to reduce solar generation"
+
+	case metricType == "relative_humidity_2m":
 		if mean > 80 {
 			threshold = mean + stdDev
 			operator = ">"
@@ -96,14 +227,16 @@ func (as *AlarmSuggester) generateSuggestion(metricType string, anomalies []mode
 			threshold = mean - stdDev
 			operator = "<"
 			description = "Humidity levels dropping dangerously low"
+		} else {
+			return nil
 		}
 
-	case "precipitation":
+	case metricType == "precipitation":
 		threshold = mean + (2 * stdDev)
 		operator = ">"
 		description = "Precipitation exceeding normal levels"
 
-	case "wind_speed_10m":
+	case metricType == "wind_speed_10m":
 		threshold = mean + (2 * stdDev)
 		operator = ">"
 		description = "Wind speed reaching dangerous levels"
@@ -112,39 +245,65 @@ func (as *AlarmSuggester) generateSuggestion(metricType string, anomalies []mode
 		return nil
 	}
 
-	// Calculate confidence based on consistency of anomalies
-	confidence := as.calculateConfidence(values, threshold, operator)
+	// Calculate confidence based on consistency, number and age of anomalies
+	confidence := as.calculateConfidence(anomalies, threshold, operator)
 
 	return &models.AlarmSuggestion{
 		Location:     location,
 		MetricType:   metricType,
 		Threshold:    threshold,
 		Operator:     operator,
-		SuggestedAt:  time.Now(),
+		SuggestedAt:  as.clock.Now(),
 		Confidence:   confidence,
 		Description:  description,
 		AnomalyCount: len(anomalies),
 	}
 }
 
-// calculateConfidence calculates how confident we are in the alarm threshold
-func (as *AlarmSuggester) calculateConfidence(values []float64, threshold float64, operator string) float64 {
-	if len(values) == 0 {
+// calculateConfidence calculates how confident we are in the alarm threshold.
+// The base is the fraction of anomalies that would trip the alarm, scaled down when
+// the evidence is thin: each anomaly is weighted by exponential decay on its age, and
+// the summed weight w gives a sample factor of w / (w + confidencePseudoCount).
+// With a confidence window only anomalies inside it are considered.
+func (as *AlarmSuggester) calculateConfidence(anomalies []models.Anomaly, threshold float64, operator string) float64 {
+	now := as.clock.Now()
+
+	if as.confidenceWindow > 0 {
+		var recent []models.Anomaly
+		for _, a := range anomalies {
+			if now.Sub(a.Timestamp) <= as.confidenceWindow {
+				recent = append(recent, a)
+			}
+		}
+		anomalies = recent
+	}
+
+	if len(anomalies) == 0 {
 		return 0
 	}
 
-	// Count how many values would trigger the alarm
+	// Count how many values would trigger the alarm and how much recent evidence there is
 	triggeredCount := 0
-	for _, v := range values {
-		if operator == ">" && v > threshold {
+	evidence := 0.0
+	for _, a := range anomalies {
+		if operator == ">" && a.Value > threshold {
 			triggeredCount++
-		} else if operator == "<" && v < threshold {
+		} else if operator == "<" && a.Value < threshold {
 			triggeredCount++
 		}
+
+		age := now.Sub(a.Timestamp)
+		if age < 0 {
+			age = 0 // Predicted anomalies count as fresh
+		}
+		evidence += math.Exp2(-age.Hours() / confidenceHalfLife.Hours())
 	}
 
-	// Confidence is the ratio of triggered values (0 to 1)
-	return float64(triggeredCount) / float64(len(values))
+	tripFraction := float64(triggeredCount) / float64(len(anomalies))
+	sampleFactor := evidence / (evidence + confidencePseudoCount)
+
+	// Both factors are within 0 to 1, so the product is too
+	return tripFraction * sampleFactor
 }
 
 // calculateMean calculates the mean of values
@@ -159,7 +318,60 @@ func calculateMean(values []float64) float64 {
 	return sum / float64(len(values))
 }
 
-// calculateStdDev calculates the standard deviation of values
+// calculateWeightedMean calculates the mean of values weighted by weights.
+// Falls back to the plain mean when no weight is positive (e.g. only staleness anomalies, which have z = 0).
+func calculateWeightedMean(values, weights []float64) float64 {
+	total := 0.0
+	sum := 0.0
+	for i, v := range values {
+		total += weights[i]
+		sum += weights[i] * v
+	}
+	if total == 0 {
+		return calculateMean(values)
+	}
+	return sum / total
+}
+
+// calculateWeightedStdDev calculates the sample standard deviation of values around mean weighted by
+// weights, falling back to the plain sample standard deviation when no weight is positive.
+// Dividing by V1 - V2/V1 (V1 the sum of weights, V2 the sum of their squares) corrects the bias
+// like n-1 does, and equals it when all weights are equal.
+func calculateWeightedStdDev(values, weights []float64, mean float64) float64 {
+	if len(values) <= 1 {
+		return 0
+	}
+	total := 0.0
+	totalSquares := 0.0
+	variance := 0.0
+	for i, v := range values {
+		total += weights[i]
+		totalSquares += weights[i] * weights[i]
+		variance += weights[i] * (v - mean) * (v - mean)
+	}
+	if total == 0 {
+		return calculateStdDev(values, mean)
+	}
+	divisor := total - totalSquares/total
+	if divisor <= 0 {
+		return 0 // all weight on a single value
+	}
+	return math.Sqrt(variance / divisor)
+}
+
+// calculatePopulationStdDev calculates the population standard deviation of values (divisor n)
+func calculatePopulationStdDev(values []float64, mean float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(variance / float64(len(values)))
+}
+
+// calculateStdDev calculates the sample standard deviation of values (divisor n-1)
 func calculateStdDev(values []float64, mean float64) float64 {
 	if len(values) <= 1 {
 		return 0
@@ -0,0 +1,192 @@
+package detector
+
+import (
+	"math"
+	"preempt/internal/clock"
+	"preempt/internal/config/configtest"
+	"preempt/internal/database/databasetest"
+	"preempt/internal/models"
+	"testing"
+	"time"
+)
+
+// newTestSuggester loads yaml as the config and returns a suggester on a clock frozen at testNow
+func newTestSuggester(t *testing.T, yaml string) *AlarmSuggester {
+	t.Helper()
+	configtest.Use(t, yaml)
+	as := NewAlarmSuggester()
+	as.SetClock(clock.NewFake(testNow))
+	return as
+}
+
+// anomalySeries returns one high stats anomaly per value, an hour apart before testNow
+func anomalySeries(location, metricType string, values ...float64) []models.Anomaly {
+	anomalies := make([]models.Anomaly, len(values))
+	for i, v := range values {
+		anomalies[i] = models.Anomaly{
+			Location:   location,
+			Timestamp:  testNow.Add(-time.Duration(i+1) * time.Hour),
+			MetricType: metricType,
+			Value:      v,
+			ZScore:     -3,
+			Severity:   "high",
+			Method:     "stats",
+		}
+	}
+	return anomalies
+}
+
+func TestSuggestAlarmsPressureDrop(t *testing.T) {
+	as := newTestSuggester(t, configtest.Minimal)
+
+	suggestions := as.SuggestAlarms(anomalySeries("Tokyo", "surface_pressure", 985, 982, 979), "Tokyo")
+	if len(suggestions) != 1 {
+		t.Fatalf("got %d suggestions, want 1", len(suggestions))
+	}
+	s := suggestions[0]
+	if s.MetricType != "surface_pressure" || s.Operator != "<" {
+		t.Errorf("suggestion = %s %s, want surface_pressure <", s.MetricType, s.Operator)
+	}
+	if s.Threshold >= 979 || s.Threshold < 970 {
+		t.Errorf("threshold = %.1f, want a little below the drops", s.Threshold)
+	}
+	if s.AnomalyCount != 3 {
+		t.Errorf("anomaly count = %d, want 3", s.AnomalyCount)
+	}
+}
+
+func TestSuggestAlarmsSkipsMildTemperatures(t *testing.T) {
+	as := newTestSuggester(t, `
+weather:
+  monitored_fields: [temperature_2m, apparent_temperature, relative_humidity_2m]
+`)
+
+	// Means between the cold and heat limits have no side worth alarming on
+	var anomalies []models.Anomaly
+	anomalies = append(anomalies, anomalySeries("Tokyo", "temperature_2m", 14, 16, 18)...)
+	anomalies = append(anomalies, anomalySeries("Tokyo", "apparent_temperature", 12, 15, 20)...)
+	anomalies = append(anomalies, anomalySeries("Tokyo", "relative_humidity_2m", 45, 50, 55)...)
+
+	if suggestions := as.SuggestAlarms(anomalies, "Tokyo"); len(suggestions) != 0 {
+		t.Errorf("got suggestions %+v, want none", suggestions)
+	}
+}
+
+func TestWeightedStdDevMatchesSampleStdDevForEqualWeights(t *testing.T) {
+	values := []float64{12, 15, 11, 19, 14}
+	mean := calculateMean(values)
+	want := calculateStdDev(values, mean)
+
+	for _, w := range []float64{1, 2.5, 7} {
+		weights := []float64{w, w, w, w, w}
+		if got := calculateWeightedStdDev(values, weights, mean); math.Abs(got-want) > 1e-9 {
+			t.Errorf("weight %g: std dev %v, want the n-1 sample std dev %v", w, got, want)
+		}
+	}
+}
+
+func TestSuggestAlarmsWeightingFollowsExtremeAnomaly(t *testing.T) {
+	// Three mild heat anomalies and one extreme one
+	anomalies := anomalySeries("Tokyo", "temperature_2m", 32, 33, 34, 48)
+	for i := range anomalies {
+		anomalies[i].ZScore = 3
+	}
+	anomalies[3].ZScore = 12
+
+	threshold := func(weighting string) float64 {
+		as := newTestSuggester(t, configtest.Minimal+`
+suggestion:
+  weighting: "`+weighting+`"
+`)
+		suggestions := as.SuggestAlarms(anomalies, "Tokyo")
+		if len(suggestions) != 1 || suggestions[0].Operator != ">" {
+			t.Fatalf("%s: got %+v, want one upper threshold", weighting, suggestions)
+		}
+		return suggestions[0].Threshold
+	}
+
+	unweighted := threshold("none")
+	values := []float64{32, 33, 34, 48}
+	mean := calculateMean(values)
+	if want := mean + 2*calculateStdDev(values, mean); math.Abs(unweighted-want) > 1e-9 {
+		t.Errorf("unweighted threshold %.2f, want mean + 2 sample std devs %.2f", unweighted, want)
+	}
+
+	// The extreme anomaly's |z| pulls the mean toward it and widens the spread around it
+	weighted := threshold("zscore")
+	if weighted < unweighted+5 {
+		t.Errorf("weighted threshold %.2f barely moved from unweighted %.2f", weighted, unweighted)
+	}
+}
+
+func TestSuggestAlarmsIgnoresFeedHealthAnomalies(t *testing.T) {
+	as := newTestSuggester(t, configtest.Minimal)
+
+	// A stuck feed repeats staleness and flatline anomalies at z = 0, run after run
+	var broken []models.Anomaly
+	for i, method := range []string{"staleness", "flatline", "staleness", "flatline"} {
+		broken = append(broken, models.Anomaly{
+			Location:   "Tokyo",
+			Timestamp:  testNow.Add(-time.Duration(i+1)*time.Hour - 30*time.Minute),
+			MetricType: "surface_pressure",
+			Value:      1013,
+			Severity:   "high",
+			Method:     method,
+		})
+	}
+	if suggestions := as.SuggestAlarms(broken, "Tokyo"); len(suggestions) != 0 {
+		t.Errorf("current run: got suggestions %+v from feed health anomalies", suggestions)
+	}
+
+	// Stored ones don't top up two real anomalies to the three needed either
+	store := databasetest.NewMemoryStore()
+	if err := store.StoreAnomalies(broken); err != nil {
+		t.Fatal(err)
+	}
+	suggestions, err := as.SuggestAlarmsWithHistory(store, anomalySeries("Tokyo", "surface_pressure", 985, 982), "Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 0 {
+		t.Errorf("with history: got suggestions %+v, want none from two real anomalies", suggestions)
+	}
+}
+
+func TestStoredSuggestionsAreScopedToTheirLocation(t *testing.T) {
+	as := newTestSuggester(t, configtest.Minimal)
+	store := databasetest.NewMemoryStore()
+	store.StoreAnomalies(anomalySeries("Tokyo", "surface_pressure", 985, 982, 979))
+	store.StoreAnomalies(anomalySeries("Lima", "surface_pressure", 1030, 1027, 1024))
+
+	// Two detection runs, as cmd/detect stores them: the second must update each location's
+	// suggestion rather than add another or overwrite the other location's
+	for run := 0; run < 2; run++ {
+		for _, location := range []string{"Tokyo", "Lima"} {
+			suggestions, err := as.SuggestAlarmsWithHistory(store, nil, location)
+			if err != nil {
+				t.Fatalf("SuggestAlarmsWithHistory(%s): %v", location, err)
+			}
+			for i := range suggestions {
+				if err := store.StoreAlarmSuggestion(&suggestions[i]); err != nil {
+					t.Fatalf("StoreAlarmSuggestion: %v", err)
+				}
+			}
+		}
+	}
+
+	// Each threshold sits a little below its own location's pressure drops
+	lowest := map[string]float64{"Tokyo": 979, "Lima": 1024}
+	for location, low := range lowest {
+		stored, err := store.GetAlarmSuggestions(location, 10)
+		if err != nil {
+			t.Fatalf("GetAlarmSuggestions(%s): %v", location, err)
+		}
+		if len(stored) != 1 {
+			t.Fatalf("%s has %d suggestions, want 1: %+v", location, len(stored), stored)
+		}
+		if stored[0].Location != location || stored[0].Threshold >= low || stored[0].Threshold < low-15 {
+			t.Errorf("%s suggestion = %s %s %.1f, want a threshold just below %.0f",
+				location, stored[0].Location, stored[0].Operator, stored[0].Threshold, low)
+		}
+	}
+}
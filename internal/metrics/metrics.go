@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"preempt/internal/version"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -52,12 +53,48 @@ var (
 		},
 	)
 
+	// StoreConsumerBacklog tracks messages waiting for the store consumer (pending + unread)
+	StoreConsumerBacklog = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "store_consumer_backlog",
+			Help: "Number of stream messages pending or not yet read by the store consumer group",
+		},
+	)
+
+	// StoreMessagesProcessed counts messages the store consumer stored successfully
+	StoreMessagesProcessed = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "store_messages_processed_total",
+			Help: "Total number of stream messages stored by the store consumer",
+		},
+	)
+
+	// ProviderRequestsTotal counts weather provider requests by outcome, including fallbacks
+	ProviderRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "weather_provider_requests_total",
+			Help: "Total number of weather provider requests",
+		},
+		[]string{"provider", "status"},
+	)
+
+	// MetricFieldsSkippedTotal counts monitored fields dropped from a forecast before storing,
+	// so a field that is never stored shows up without reading logs
+	MetricFieldsSkippedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "metric_fields_skipped_total",
+			Help: "Total number of monitored fields skipped when storing a forecast",
+		},
+		[]string{"field", "reason"},
+	)
+
 	// AppInfo provides static information about the application
-	AppInfo = promauto.NewGauge(
+	AppInfo = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "preempt_app_info",
 			Help: "Application information (always 1)",
 		},
+		[]string{"version", "commit", "build_date"},
 	)
 
 	// AppStartTime records when the application started
@@ -70,8 +107,8 @@ var (
 )
 
 func init() {
-	// Set app info to 1 (always visible)
-	AppInfo.Set(1)
+	// Set app info to 1 (always visible), labelled with the build information
+	AppInfo.WithLabelValues(version.Version, version.Commit, version.BuildDate).Set(1)
 	// Record app start time
 	AppStartTime.SetToCurrentTime()
 }
@@ -86,6 +123,22 @@ func RecordDBQuery(queryType, table string, duration time.Duration, err error) {
 	DBQueryDuration.WithLabelValues(queryType, table).Observe(duration.Seconds())
 }
 
+// RecordProviderRequest records the outcome of a request to a weather provider
+func RecordProviderRequest(provider string, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	ProviderRequestsTotal.WithLabelValues(provider, status).Inc()
+}
+
+// RecordFieldSkipped records a monitored field that wasn't stored.
+// reason is "not_found" (unknown to the model), "nil" (absent from the response), "length_mismatch"
+// or "unit_mismatch" (unit differs from the stored series).
+func RecordFieldSkipped(field, reason string) {
+	MetricFieldsSkippedTotal.WithLabelValues(field, reason).Inc()
+}
+
 // UpdateDBConnectionStats updates database connection pool statistics
 func UpdateDBConnectionStats(open, inUse, idle int) {
 	DBConnectionsOpen.Set(float64(open))
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Forecast represents weather forecast data from Open-Meteo API
 type Forecast struct {
@@ -17,42 +20,59 @@ type Forecast struct {
 }
 
 type CurrentUnits struct {
-	Time               string `json:"time"`
-	Interval           string `json:"interval"`
-	Temperature2m      string `json:"temperature_2m"`
-	RelativeHumidity2m string `json:"relative_humidity_2m"`
-	Precipitation      string `json:"precipitation"`
-	WeatherCode        string `json:"weather_code"`
-	WindSpeed10m       string `json:"wind_speed_10m"`
-	DewPoint2m         string `json:"dew_point_2m"`
+	Time                string `json:"time"`
+	Interval            string `json:"interval"`
+	Temperature2m       string `json:"temperature_2m"`
+	RelativeHumidity2m  string `json:"relative_humidity_2m"`
+	Precipitation       string `json:"precipitation"`
+	WeatherCode         string `json:"weather_code"`
+	WindSpeed10m        string `json:"wind_speed_10m"`
+	DewPoint2m          string `json:"dew_point_2m"`
+	ApparentTemperature string `json:"apparent_temperature"`
+	SurfacePressure     string `json:"surface_pressure"`
+	CloudCover          string `json:"cloud_cover"`
 }
 
+// Current holds the latest readings. Every reading is a pointer so a field missing from the
+// response decodes as nil rather than a real-looking zero
 type Current struct {
-	Time               string   `json:"time"`
-	Interval           int      `json:"interval"`
-	Temperature2m      *float64 `json:"temperature_2m"`
-	RelativeHumidity2m *float64 `json:"relative_humidity_2m"`
-	Precipitation      *float64 `json:"precipitation"`
-	WeatherCode        int      `json:"weather_code"`
-	WindSpeed10m       *float64 `json:"wind_speed_10m"`
-	DewPoint2m         *float64 `json:"dew_point_2m"`
+	Time                string   `json:"time"`
+	Interval            int      `json:"interval"`
+	Temperature2m       *float64 `json:"temperature_2m"`
+	RelativeHumidity2m  *float64 `json:"relative_humidity_2m"`
+	Precipitation       *float64 `json:"precipitation"`
+	WeatherCode         *int     `json:"weather_code"`
+	WindSpeed10m        *float64 `json:"wind_speed_10m"`
+	DewPoint2m          *float64 `json:"dew_point_2m"`
+	ApparentTemperature *float64 `json:"apparent_temperature"`
+	SurfacePressure     *float64 `json:"surface_pressure"`
+	CloudCover          *float64 `json:"cloud_cover"`
 }
 
 type HourlyUnits struct {
-	Time               string `json:"time"`
-	Temperature2m      string `json:"temperature_2m"`
-	RelativeHumidity2m string `json:"relative_humidity_2m"`
-	Precipitation      string `json:"precipitation"`
-	DewPoint2m         string `json:"dew_point_2m"`
+	Time                string `json:"time"`
+	Temperature2m       string `json:"temperature_2m"`
+	RelativeHumidity2m  string `json:"relative_humidity_2m"`
+	Precipitation       string `json:"precipitation"`
+	DewPoint2m          string `json:"dew_point_2m"`
+	WindSpeed10m        string `json:"wind_speed_10m"`
+	ApparentTemperature string `json:"apparent_temperature"`
+	SurfacePressure     string `json:"surface_pressure"`
+	CloudCover          string `json:"cloud_cover"`
+	WeatherCode         string `json:"weather_code"`
 }
 
 type Hourly struct {
-	Time               []string  `json:"time"`
-	Temperature2m      []float64 `json:"temperature_2m"`
-	RelativeHumidity2m []float64 `json:"relative_humidity_2m"`
-	Precipitation      []float64 `json:"precipitation"`
-	DewPoint2m         []float64 `json:"dew_point_2m"`
-	WindSpeed10m       []float64 `json:"wind_speed_10m"`
+	Time                []string  `json:"time"`
+	Temperature2m       []float64 `json:"temperature_2m"`
+	RelativeHumidity2m  []float64 `json:"relative_humidity_2m"`
+	Precipitation       []float64 `json:"precipitation"`
+	DewPoint2m          []float64 `json:"dew_point_2m"`
+	WindSpeed10m        []float64 `json:"wind_speed_10m"`
+	ApparentTemperature []float64 `json:"apparent_temperature"`
+	SurfacePressure     []float64 `json:"surface_pressure"`
+	CloudCover          []float64 `json:"cloud_cover"`
+	WeatherCode         []int     `json:"weather_code"` // WMO code, categorical so it isn't stored as a metric
 }
 
 type DailyUnits struct {
@@ -80,6 +100,14 @@ type Metric struct {
 	Timestamp  time.Time `json:"timestamp"`
 	MetricType string    `json:"metric_type"`
 	Value      float64   `json:"value"`
+	Unit       string    `json:"unit,omitempty"` // as reported by the provider, e.g. "°C"; empty for rollups and older rows
+}
+
+// LocatedMetric is a metric with the coordinates of its location, for map views
+type LocatedMetric struct {
+	Metric
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
 }
 
 // Anomaly represents a detected anomaly
@@ -91,6 +119,36 @@ type Anomaly struct {
 	Value      float64   `json:"value"`
 	ZScore     float64   `json:"z_score"`
 	Severity   string    `json:"severity"` // "low", "medium", "high"
+	Method     string    `json:"method"`   // "stats", "ml", "staleness", "flatline", "excessive"
+	// Baseline the anomaly was scored against, for explaining it later. Only set by z-score
+	// methods (stats, forecast), nil otherwise and for anomalies stored before they were recorded.
+	BaselineMean   *float64 `json:"baseline_mean,omitempty"`
+	BaselineStdDev *float64 `json:"baseline_stddev,omitempty"`
+	Threshold      *float64 `json:"threshold,omitempty"` // |z| that had to be exceeded
+}
+
+// AnomalyEvent groups consecutive anomalies for the same location and metric into a single event
+type AnomalyEvent struct {
+	ID           int64     `json:"id"`
+	Location     string    `json:"location"`
+	MetricType   string    `json:"metric_type"`
+	StartTime    time.Time `json:"start_time"`
+	EndTime      time.Time `json:"end_time"`
+	PeakValue    float64   `json:"peak_value"`
+	PeakZScore   float64   `json:"peak_z_score"`
+	MinValue     float64   `json:"min_value"`
+	MaxValue     float64   `json:"max_value"`
+	Severity     string    `json:"severity"` // highest severity among the grouped anomalies
+	AnomalyCount int       `json:"anomaly_count"`
+}
+
+// RawForecast is an API payload kept verbatim for auditing
+type RawForecast struct {
+	ID        int64           `json:"id"`
+	Location  string          `json:"location"`
+	DataType  string          `json:"data_type"` // "current", "historical", "forecast"
+	FetchedAt time.Time       `json:"fetched_at"`
+	Payload   json.RawMessage `json:"payload"`
 }
 
 // AlarmSuggestion represents a suggested alarm rule
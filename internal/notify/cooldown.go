@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"context"
+	"preempt/internal/clock"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// CooldownStore remembers which alert keys fired recently
+type CooldownStore interface {
+	// Acquire starts a cooldown of ttl for key and returns true, or returns false when one is already running
+	Acquire(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// RedisCooldownStore keeps cooldowns in Redis so they survive between detect runs and are shared
+// by every instance
+type RedisCooldownStore struct {
+	client *redis.Client
+}
+
+// NewRedisCooldownStore creates a cooldown store backed by client
+func NewRedisCooldownStore(client *redis.Client) *RedisCooldownStore {
+	return &RedisCooldownStore{client: client}
+}
+
+// Acquire sets the key only if it is absent, expiring it after ttl
+func (s *RedisCooldownStore) Acquire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, "notify:cooldown:"+key, 1, ttl).Result()
+}
+
+// MemoryCooldownStore keeps cooldowns in process, for a single long running instance or tests
+type MemoryCooldownStore struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	clock   clock.Clock
+}
+
+// NewMemoryCooldownStore creates an empty in-process cooldown store
+func NewMemoryCooldownStore(c clock.Clock) *MemoryCooldownStore {
+	return &MemoryCooldownStore{expires: make(map[string]time.Time), clock: c}
+}
+
+// Acquire starts a cooldown unless the previous one for key hasn't expired yet
+func (s *MemoryCooldownStore) Acquire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	if now.Before(s.expires[key]) {
+		return false, nil
+	}
+	s.expires[key] = now.Add(ttl)
+	return true, nil
+}
+
+var _ CooldownStore = (*RedisCooldownStore)(nil)
+var _ CooldownStore = (*MemoryCooldownStore)(nil)
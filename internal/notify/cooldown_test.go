@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"preempt/internal/clock"
+	"preempt/internal/models"
+)
+
+func TestCooldownSendsRepeatedAnomalyOnce(t *testing.T) {
+	fake := clock.NewFake(testReading)
+	r, slack, _ := newTestRouter()
+	r.SetCooldown(30*time.Minute, NewMemoryCooldownStore(fake))
+	ctx := context.Background()
+
+	// Without a sent store only the cooldown stops a reading detected again every run
+	a := anomalyAt("medium", testReading)
+	for i := 0; i < 5; i++ {
+		r.Notify(ctx, []models.Anomaly{a})
+		fake.Advance(5 * time.Minute)
+	}
+	if slack.count() != 1 {
+		t.Errorf("slack got %d notifications within the cooldown, want 1", slack.count())
+	}
+}
+
+func TestCooldownCoversSeverityChanges(t *testing.T) {
+	fake := clock.NewFake(testReading)
+	r, slack, pager := newTestRouter()
+	r.SetCooldown(30*time.Minute, NewMemoryCooldownStore(fake))
+	r.SetSentStore(NewMemorySentStore())
+	ctx := context.Background()
+
+	r.Notify(ctx, []models.Anomaly{anomalyAt("medium", testReading)})
+
+	// A newer reading escalating to high is still within the series' cooldown
+	fake.Advance(10 * time.Minute)
+	if sent := r.Notify(ctx, []models.Anomaly{anomalyAt("high", testReading.Add(10*time.Minute))}); sent != 0 {
+		t.Errorf("escalation within the cooldown sent %d notifications, want 0", sent)
+	}
+
+	fake.Advance(30 * time.Minute)
+	if sent := r.Notify(ctx, []models.Anomaly{anomalyAt("high", testReading.Add(40*time.Minute))}); sent != 2 {
+		t.Errorf("anomaly after the cooldown sent %d notifications, want 2", sent)
+	}
+	if slack.count() != 2 || pager.count() != 1 {
+		t.Errorf("slack %d, pager %d, want 2 and 1", slack.count(), pager.count())
+	}
+}
+
+func TestMemoryCooldownStoreExpires(t *testing.T) {
+	fake := clock.NewFake(testReading)
+	store := NewMemoryCooldownStore(fake)
+	ctx := context.Background()
+
+	if ok, _ := store.Acquire(ctx, "k", time.Minute); !ok {
+		t.Fatal("first Acquire = false, want true")
+	}
+	if ok, _ := store.Acquire(ctx, "k", time.Minute); ok {
+		t.Error("Acquire within the ttl = true, want false")
+	}
+	if ok, _ := store.Acquire(ctx, "other", time.Minute); !ok {
+		t.Error("Acquire for another key = false, want true")
+	}
+	fake.Advance(time.Minute)
+	if ok, _ := store.Acquire(ctx, "k", time.Minute); !ok {
+		t.Error("Acquire after the ttl = false, want true")
+	}
+}
@@ -0,0 +1,244 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"preempt/internal/config"
+	"preempt/internal/models"
+	"time"
+)
+
+// Notifier delivers an anomaly to one channel, e.g. a Slack webhook
+type Notifier interface {
+	Notify(ctx context.Context, anomaly models.Anomaly) error
+}
+
+// WebhookNotifier POSTs the anomaly as JSON to a URL
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier posting to url
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Notify posts the anomaly
+func (n *WebhookNotifier) Notify(ctx context.Context, anomaly models.Anomaly) error {
+	return postJSON(ctx, n.client, n.url, anomaly)
+}
+
+// SlackNotifier posts a one-line summary of the anomaly to a Slack incoming webhook
+type SlackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlackNotifier creates a notifier posting to a Slack incoming webhook URL
+func NewSlackNotifier(url string) *SlackNotifier {
+	return &SlackNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Notify posts the anomaly summary
+func (n *SlackNotifier) Notify(ctx context.Context, anomaly models.Anomaly) error {
+	return postJSON(ctx, n.client, n.url, map[string]string{"text": Summary(anomaly)})
+}
+
+// LogNotifier writes the anomaly summary to the process log
+type LogNotifier struct{}
+
+// Notify logs the anomaly summary
+func (LogNotifier) Notify(ctx context.Context, anomaly models.Anomaly) error {
+	log.Printf("Notification: %s", Summary(anomaly))
+	return nil
+}
+
+// Summary renders an anomaly as a single human readable line
+func Summary(a models.Anomaly) string {
+	return fmt.Sprintf("[%s] %s %s = %.2f (z=%.2f, %s) at %s",
+		a.Severity, a.Location, a.MetricType, a.Value, a.ZScore, a.Method, a.Timestamp.UTC().Format(time.RFC3339))
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to serialize notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// namedNotifier keeps a channel's config name for logging
+type namedNotifier struct {
+	name     string
+	notifier Notifier
+}
+
+// Router sends each anomaly to the channels configured for its severity
+type Router struct {
+	routes    map[string][]namedNotifier // severity -> channels
+	cooldowns CooldownStore              // nil sends every anomaly
+	cooldown  time.Duration
+	sent      SentStore // nil only dedupes within a single Notify call
+}
+
+// NewRouter builds the channels in cfg.Notifications and routes severities to them.
+// Severities without a route are not sent anywhere.
+func NewRouter(cfg *config.Config) *Router {
+	channels := make(map[string]Notifier)
+	for _, ch := range cfg.Notifications.Channels {
+		switch ch.Type {
+		case "slack":
+			channels[ch.Name] = NewSlackNotifier(ch.URL)
+		case "webhook":
+			channels[ch.Name] = NewWebhookNotifier(ch.URL)
+		case "log":
+			channels[ch.Name] = LogNotifier{}
+		}
+	}
+
+	routes := make(map[string][]namedNotifier)
+	for severity, names := range cfg.Notifications.Routes {
+		for _, name := range names {
+			routes[severity] = append(routes[severity], namedNotifier{name: name, notifier: channels[name]})
+		}
+	}
+	return &Router{routes: routes}
+}
+
+// SetCooldown suppresses further notifications for the same location and metric type within
+// cooldown of the last one sent, whatever their severity. A zero cooldown or nil store sends
+// every anomaly.
+func (r *Router) SetCooldown(cooldown time.Duration, store CooldownStore) {
+	r.cooldown = cooldown
+	r.cooldowns = store
+}
+
+// SetSentStore remembers the newest anomaly notified per location and metric type in store, so
+// anomalies a later run detects again over the same window aren't sent twice
+func (r *Router) SetSentStore(store SentStore) {
+	r.sent = store
+}
+
+// Notify sends every anomaly to the channels routed for its severity and returns how many
+// notifications were delivered. A failing channel is logged and doesn't stop the others.
+// Anomalies no newer than the last one sent for their series are skipped, as is a reading
+// flagged by more than one method.
+func (r *Router) Notify(ctx context.Context, anomalies []models.Anomaly) int {
+	sent := 0
+	suppressed := 0
+	repeated := 0
+	lastSent := make(map[string]time.Time) // series -> newest timestamp sent by earlier calls
+	newest := make(map[string]time.Time)   // series -> newest timestamp handled by this call
+	seen := make(map[string]bool)          // series and timestamp already handled by this call
+	for _, a := range anomalies {
+		channels := r.routes[a.Severity]
+		if len(channels) == 0 {
+			continue
+		}
+
+		series := seriesKey(a)
+		reading := series + "|" + a.Timestamp.UTC().Format(time.RFC3339Nano)
+		if seen[reading] || !a.Timestamp.After(r.lastSent(ctx, series, lastSent)) {
+			repeated++
+			continue
+		}
+		seen[reading] = true
+		if a.Timestamp.After(newest[series]) {
+			newest[series] = a.Timestamp
+		}
+
+		if !r.acquire(ctx, a) {
+			suppressed++
+			continue
+		}
+
+		for _, ch := range channels {
+			if err := ch.notifier.Notify(ctx, a); err != nil {
+				log.Printf("Failed to notify %s about %s %s: %v", ch.name, a.Location, a.MetricType, err)
+				continue
+			}
+			sent++
+		}
+	}
+
+	if r.sent != nil {
+		for series, t := range newest {
+			if err := r.sent.MarkSent(ctx, series, t); err != nil {
+				log.Printf("Failed to record last notification for %s: %v", series, err)
+			}
+		}
+	}
+
+	if repeated > 0 {
+		log.Printf("Skipped %d anomalies already notified", repeated)
+	}
+	if suppressed > 0 {
+		log.Printf("Suppressed %d notifications still within the %s cooldown", suppressed, r.cooldown)
+	}
+	return sent
+}
+
+// seriesKey identifies the series an anomaly belongs to. Predicted anomalies lie in the future,
+// so they are tracked apart from observed ones to not hold those back.
+func seriesKey(a models.Anomaly) string {
+	kind := "observed"
+	if a.Method == "forecast" {
+		kind = "forecast"
+	}
+	return fmt.Sprintf("%s|%s|%s", a.Location, a.MetricType, kind)
+}
+
+// lastSent returns the newest timestamp already sent for series, looked up once per Notify call.
+// Anomalies are sent when the store is unavailable rather than lost.
+func (r *Router) lastSent(ctx context.Context, series string, cache map[string]time.Time) time.Time {
+	if r.sent == nil {
+		return time.Time{}
+	}
+	if t, ok := cache[series]; ok {
+		return t
+	}
+
+	t, err := r.sent.LastSent(ctx, series)
+	if err != nil {
+		log.Printf("Last notification lookup failed for %s, sending anyway: %v", series, err)
+	}
+	cache[series] = t
+	return t
+}
+
+// acquire reports whether the anomaly's series is outside its cooldown, starting a new one if so.
+// Notifications are sent when the cooldown store is unavailable rather than lost.
+func (r *Router) acquire(ctx context.Context, a models.Anomaly) bool {
+	if r.cooldowns == nil || r.cooldown <= 0 {
+		return true
+	}
+
+	key := seriesKey(a)
+	ok, err := r.cooldowns.Acquire(ctx, key, r.cooldown)
+	if err != nil {
+		log.Printf("Notification cooldown check failed for %s, sending anyway: %v", key, err)
+		return true
+	}
+	return ok
+}
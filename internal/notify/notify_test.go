@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"preempt/internal/models"
+)
+
+// recordingNotifier remembers every anomaly it was asked to send
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []models.Anomaly
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, anomaly models.Anomaly) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, anomaly)
+	return nil
+}
+
+func (n *recordingNotifier) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.sent)
+}
+
+// newTestRouter routes high to both channels and medium to slack only, leaving low unrouted
+func newTestRouter() (*Router, *recordingNotifier, *recordingNotifier) {
+	slack, pager := &recordingNotifier{}, &recordingNotifier{}
+	r := &Router{routes: map[string][]namedNotifier{
+		"high":   {{name: "slack", notifier: slack}, {name: "pager", notifier: pager}},
+		"medium": {{name: "slack", notifier: slack}},
+	}}
+	return r, slack, pager
+}
+
+var testReading = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func anomalyAt(severity string, ts time.Time) models.Anomaly {
+	return models.Anomaly{Location: "Tokyo", MetricType: "temperature_2m", Timestamp: ts, Severity: severity, Method: "stats", Value: 41}
+}
+
+func TestNotifyRoutesBySeverity(t *testing.T) {
+	r, slack, pager := newTestRouter()
+
+	if sent := r.Notify(context.Background(), []models.Anomaly{anomalyAt("low", testReading)}); sent != 0 {
+		t.Errorf("low anomaly sent %d notifications, want 0", sent)
+	}
+	if slack.count() != 0 || pager.count() != 0 {
+		t.Fatalf("low anomaly reached a channel: slack %d, pager %d", slack.count(), pager.count())
+	}
+
+	if sent := r.Notify(context.Background(), []models.Anomaly{anomalyAt("high", testReading)}); sent != 2 {
+		t.Errorf("high anomaly sent %d notifications, want 2", sent)
+	}
+	if slack.count() != 1 || pager.count() != 1 {
+		t.Errorf("high anomaly: slack %d, pager %d, want 1 each", slack.count(), pager.count())
+	}
+}
+
+func TestNotifySkipsAnomaliesAlreadySent(t *testing.T) {
+	r, slack, _ := newTestRouter()
+	r.SetSentStore(NewMemorySentStore())
+	ctx := context.Background()
+
+	first := []models.Anomaly{
+		anomalyAt("medium", testReading),
+		anomalyAt("medium", testReading.Add(time.Hour)),
+	}
+	if sent := r.Notify(ctx, first); sent != 2 {
+		t.Fatalf("first run sent %d notifications, want 2", sent)
+	}
+
+	// The next run detects the same window again plus one new reading
+	second := append(first, anomalyAt("medium", testReading.Add(2*time.Hour)))
+	if sent := r.Notify(ctx, second); sent != 1 {
+		t.Errorf("second run sent %d notifications, want only the new reading", sent)
+	}
+	if got := slack.sent[len(slack.sent)-1].Timestamp; !got.Equal(testReading.Add(2 * time.Hour)) {
+		t.Errorf("last notification was for %s, want the new reading", got)
+	}
+
+	// Predicted anomalies lie ahead of the observed ones and are tracked on their own
+	predicted := anomalyAt("medium", testReading.Add(time.Hour))
+	predicted.Method = "forecast"
+	if sent := r.Notify(ctx, []models.Anomaly{predicted}); sent != 1 {
+		t.Errorf("predicted anomaly sent %d notifications, want 1", sent)
+	}
+}
+
+func TestNotifyDedupesReadingFlaggedByTwoMethods(t *testing.T) {
+	r, slack, _ := newTestRouter()
+
+	stats := anomalyAt("medium", testReading)
+	ml := stats
+	ml.Method = "ml"
+	if sent := r.Notify(context.Background(), []models.Anomaly{stats, ml}); sent != 1 {
+		t.Errorf("sent %d notifications for one reading, want 1", sent)
+	}
+	if slack.count() != 1 {
+		t.Errorf("slack got %d notifications, want 1", slack.count())
+	}
+}
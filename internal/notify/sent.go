@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// sentRetention bounds how long a series' last sent timestamp is kept. Detection windows are
+// far shorter, so an anomaly old enough to be forgotten is never detected again.
+const sentRetention = 30 * 24 * time.Hour
+
+// SentStore remembers the newest anomaly timestamp notified per series. Detection re-reads its
+// whole window every run, so without it the same anomalies would be announced run after run.
+type SentStore interface {
+	// LastSent returns the newest timestamp marked for series, zero if none
+	LastSent(ctx context.Context, series string) (time.Time, error)
+	// MarkSent records t as the newest timestamp notified for series
+	MarkSent(ctx context.Context, series string, t time.Time) error
+}
+
+// RedisSentStore keeps last sent timestamps in Redis so they survive between detect runs
+type RedisSentStore struct {
+	client *redis.Client
+}
+
+// NewRedisSentStore creates a sent store backed by client
+func NewRedisSentStore(client *redis.Client) *RedisSentStore {
+	return &RedisSentStore{client: client}
+}
+
+// LastSent reads the series' timestamp, stored as Unix nanoseconds
+func (s *RedisSentStore) LastSent(ctx context.Context, series string) (time.Time, error) {
+	nanos, err := s.client.Get(ctx, "notify:sent:"+series).Int64()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
+
+// MarkSent overwrites the series' timestamp, refreshing its retention
+func (s *RedisSentStore) MarkSent(ctx context.Context, series string, t time.Time) error {
+	return s.client.Set(ctx, "notify:sent:"+series, strconv.FormatInt(t.UnixNano(), 10), sentRetention).Err()
+}
+
+// MemorySentStore keeps last sent timestamps in process, for a single long running instance or tests
+type MemorySentStore struct {
+	mu   sync.Mutex
+	sent map[string]time.Time
+}
+
+// NewMemorySentStore creates an empty in-process sent store
+func NewMemorySentStore() *MemorySentStore {
+	return &MemorySentStore{sent: make(map[string]time.Time)}
+}
+
+// LastSent returns the series' timestamp
+func (s *MemorySentStore) LastSent(ctx context.Context, series string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sent[series], nil
+}
+
+// MarkSent records the series' timestamp
+func (s *MemorySentStore) MarkSent(ctx context.Context, series string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent[series] = t
+	return nil
+}
+
+var _ SentStore = (*RedisSentStore)(nil)
+var _ SentStore = (*MemorySentStore)(nil)
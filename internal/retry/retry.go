@@ -0,0 +1,95 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Policy describes how many times and how quickly an operation is retried
+type Policy struct {
+	MaxAttempts int           // total attempts including the first one
+	BaseDelay   time.Duration // delay before the first retry
+	MaxDelay    time.Duration // upper bound for any single delay
+	Multiplier  float64       // growth factor applied per attempt (2 = doubling)
+	Jitter      float64       // fraction of the delay randomized, 0-1
+	Retryable   func(error) bool
+}
+
+// DefaultPolicy returns a policy of 3 attempts with 1s, 2s backoff and 20% jitter
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+		Multiplier:  2,
+		Jitter:      0.2,
+	}
+}
+
+// Do calls fn until it succeeds, the policy's attempts are exhausted, the error is not
+// retryable, or ctx is cancelled. The last error from fn is returned on failure.
+func Do(ctx context.Context, policy Policy, fn func() error) error {
+	attempts := policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			if err != nil {
+				return fmt.Errorf("%w (retry aborted: %v)", err, ctxErr)
+			}
+			return ctxErr
+		}
+
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		if policy.Retryable != nil && !policy.Retryable(err) {
+			return err
+		}
+
+		if attempt == attempts-1 {
+			break
+		}
+
+		timer := time.NewTimer(policy.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (retry aborted: %v)", err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+
+	return err
+}
+
+// delay computes the backoff before retry number attempt+1
+func (p Policy) delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	d := float64(p.BaseDelay) * math.Pow(multiplier, float64(attempt))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+
+	if p.Jitter > 0 {
+		// Spread the delay within +/- Jitter of its nominal value
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+
+	if d < 0 {
+		return 0
+	}
+	return time.Duration(d)
+}
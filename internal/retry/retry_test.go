@@ -0,0 +1,122 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTransient = errors.New("transient")
+
+// fastPolicy retries without waiting noticeably
+func fastPolicy(attempts int) Policy {
+	return Policy{MaxAttempts: attempts, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Multiplier: 2}
+}
+
+func TestDoSucceedsAfterRetries(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), fastPolicy(3), func() error {
+		calls++
+		if calls < 3 {
+			return errTransient
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("fn called %d times, want 3", calls)
+	}
+}
+
+func TestDoReturnsLastErrorWhenExhausted(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), fastPolicy(4), func() error {
+		calls++
+		return errTransient
+	})
+	if !errors.Is(err, errTransient) {
+		t.Errorf("err = %v, want the last error from fn", err)
+	}
+	if calls != 4 {
+		t.Errorf("fn called %d times, want MaxAttempts = 4", calls)
+	}
+}
+
+func TestDoStopsWhenContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := fastPolicy(5)
+	policy.BaseDelay, policy.MaxDelay = time.Hour, time.Hour // cancellation, not the delay, has to end the wait
+
+	calls := 0
+	called := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- Do(ctx, policy, func() error {
+			calls++
+			if calls == 1 {
+				close(called)
+			}
+			return errTransient
+		})
+	}()
+	<-called
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errTransient) {
+			t.Errorf("err = %v, want fn's error wrapped with the cancellation", err)
+		}
+		if calls != 1 {
+			t.Errorf("fn called %d times after cancel, want 1", calls)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Do kept waiting after the context was cancelled")
+	}
+
+	// An already cancelled context doesn't call fn at all
+	calls = 0
+	if err := Do(ctx, policy, func() error { calls++; return nil }); !errors.Is(err, context.Canceled) || calls != 0 {
+		t.Errorf("cancelled before start: err %v, %d calls, want context.Canceled and none", err, calls)
+	}
+}
+
+func TestDoStopsWhenNotRetryable(t *testing.T) {
+	errPermanent := errors.New("permanent")
+	policy := fastPolicy(5)
+	policy.Retryable = func(err error) bool { return !errors.Is(err, errPermanent) }
+
+	calls := 0
+	err := Do(context.Background(), policy, func() error {
+		calls++
+		if calls == 2 {
+			return errPermanent
+		}
+		return errTransient
+	})
+	if !errors.Is(err, errPermanent) {
+		t.Errorf("err = %v, want the non-retryable error", err)
+	}
+	if calls != 2 {
+		t.Errorf("fn called %d times, want 2 (one retry, then the declined error)", calls)
+	}
+}
+
+func TestDelayBacksOffWithinBounds(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2}
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		if got := p.delay(attempt); got != want {
+			t.Errorf("attempt %d: delay %s, want %s", attempt, got, want)
+		}
+	}
+
+	p.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if d := p.delay(1); d < 1600*time.Millisecond || d > 2400*time.Millisecond {
+			t.Fatalf("jittered delay %s outside 2s +/- 20%%", d)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"preempt/internal/config/configtest"
+	"testing"
+)
+
+func TestAdminEndpointsRequireDebugToken(t *testing.T) {
+	configtest.Use(t, configtest.Minimal)
+
+	for _, path := range []string{"/recompute-severities", "/suggestions/regenerate?location=Tokyo"} {
+		t.Run(path, func(t *testing.T) {
+			t.Setenv("DEBUG_TOKEN", "")
+			s := NewServer(nil, nil, nil)
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("without DEBUG_TOKEN: status %d, want 404", rec.Code)
+			}
+
+			t.Setenv("DEBUG_TOKEN", "secret")
+			s = NewServer(nil, nil, nil)
+
+			rec = httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("without a bearer token: status %d, want 401", rec.Code)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			rec = httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("GET with the token: status %d, want 405", rec.Code)
+			}
+		})
+	}
+}
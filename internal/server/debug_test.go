@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"preempt/internal/config/configtest"
+	"preempt/internal/database"
+	"preempt/internal/detector"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDebugDetectReturnsDiagnosticWithoutStoring(t *testing.T) {
+	configtest.Use(t, configtest.Minimal)
+	t.Setenv("DEBUG_TOKEN", "secret")
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	// A week of temperatures alternating 20/22 and one spike, no surface_pressure at all
+	now := time.Now()
+	spikeAt := now.Add(-10 * time.Minute)
+	columns := []string{"id", "location", "timestamp", "metric_type", "value", "unit"}
+	baseline := sqlmock.NewRows(columns).AddRow(1, "Tokyo", spikeAt, "temperature_2m", 35.0, "°C")
+	recent := sqlmock.NewRows(columns).AddRow(1, "Tokyo", spikeAt, "temperature_2m", 35.0, "°C")
+	for h := 1; h <= 7*24; h++ {
+		value := 20.0 + float64(2*(h%2))
+		baseline.AddRow(h+1, "Tokyo", now.Add(-time.Duration(h)*time.Hour), "temperature_2m", value, "°C")
+		if h < 24 {
+			recent.AddRow(h+1, "Tokyo", now.Add(-time.Duration(h)*time.Hour), "temperature_2m", value, "°C")
+		}
+	}
+	mock.ExpectQuery("FROM metrics WHERE location = \\?").
+		WithArgs("Tokyo", "temperature_2m", "surface_pressure", sqlmock.AnyArg()).
+		WillReturnRows(baseline)
+	mock.ExpectQuery("FROM metrics WHERE location = \\?").
+		WithArgs("Tokyo", "temperature_2m", "surface_pressure", sqlmock.AnyArg()).
+		WillReturnRows(recent)
+
+	s := NewServer(database.NewFromConn(conn), nil, detector.NewAnomalyDetector(nil))
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/detect?location=Tokyo", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without a bearer token: status %d, want 401", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/detect?location=Tokyo", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var body detector.StatsDiagnostic
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Location != "Tokyo" || body.MinZScore != 1.0 || len(body.Metrics) != 2 {
+		t.Fatalf("diagnostic = %+v, want Tokyo with min_zscore 1 and both metric types", body)
+	}
+
+	temperature := body.Metrics[0]
+	if temperature.MetricType != "temperature_2m" || temperature.Samples != 7*24+1 {
+		t.Errorf("temperature_2m = %s with %d samples, want %d", temperature.MetricType, temperature.Samples, 7*24+1)
+	}
+	if temperature.Mean < 20 || temperature.Mean > 22.5 || temperature.StdDev <= 0 {
+		t.Errorf("baseline mean %v, std dev %v", temperature.Mean, temperature.StdDev)
+	}
+	if len(temperature.Points) != 24 {
+		t.Errorf("scored %d points, want every reading in the evaluation window", len(temperature.Points))
+	}
+	var spike *detector.PointDiagnostic
+	for i, p := range temperature.Points {
+		if p.Timestamp.Equal(spikeAt) {
+			spike = &temperature.Points[i]
+		} else if p.Flagged {
+			t.Errorf("normal reading flagged: %+v", p)
+		}
+	}
+	if spike == nil || !spike.Flagged || spike.ZScore < 3 || !strings.Contains(spike.Reason, "exceeds min_zscore") {
+		t.Errorf("spike = %+v, want it flagged with its z-score and reason", spike)
+	}
+
+	pressure := body.Metrics[1]
+	if pressure.MetricType != "surface_pressure" || pressure.Samples != 0 || pressure.Skipped == "" {
+		t.Errorf("surface_pressure = %+v, want it skipped for lack of samples", pressure)
+	}
+
+	// Only the two reads ran, nothing was stored
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"preempt/internal/config/configtest"
+	"preempt/internal/database"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAnomaliesExportFiltersByLocationAndSeverity(t *testing.T) {
+	configtest.Use(t, configtest.Minimal)
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT .* FROM anomalies WHERE location = \\? AND timestamp >= \\? AND timestamp < \\? AND severity = \\? ORDER BY timestamp").
+		WithArgs("Tokyo", from, until, "high").
+		WillReturnRows(sqlmock.NewRows(anomalyColumns).
+			AddRow(1, "Tokyo", from.Add(3*time.Hour), "temperature_2m", 104.5, 3.5, "high", "stats", 80.0, 7.0, 1.0).
+			AddRow(2, "Tokyo", from.Add(5*time.Hour), "surface_pressure", 981.0, -4.1, "high", "ml", nil, nil, nil))
+
+	s := NewServer(database.NewFromConn(conn), nil, nil)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+		"/anomalies/export?location=Tokyo&severity=high&from=2024-06-01T00:00:00Z&until=2024-06-02T00:00:00Z", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("response isn't CSV: %v", err)
+	}
+	want := [][]string{
+		{"timestamp", "metric_type", "value", "z_score", "severity", "method"},
+		{"2024-06-01T03:00:00Z", "temperature_2m", "104.5", "3.5", "high", "stats"},
+		{"2024-06-01T05:00:00Z", "surface_pressure", "981", "-4.1", "high", "ml"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("CSV = %v, want %v", records, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAnomaliesExportRejectsUnknownSeverity(t *testing.T) {
+	configtest.Use(t, configtest.Minimal)
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	s := NewServer(database.NewFromConn(conn), nil, nil)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/anomalies/export?location=Tokyo&severity=critical", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
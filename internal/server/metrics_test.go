@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"preempt/internal/config/configtest"
+	"preempt/internal/database"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMetricsPagesInSQL(t *testing.T) {
+	configtest.Use(t, configtest.Minimal)
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	// 5 readings, second page of 2: LIMIT and OFFSET reach MySQL and one more page remains
+	now := time.Now().UTC()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM \\(SELECT 0 AS tier, .* FROM metrics WHERE location = \\? AND metric_type = \\? AND timestamp >= \\?\\) m").
+		WithArgs("Tokyo", "temperature_2m", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	rows := sqlmock.NewRows([]string{"id", "location", "timestamp", "metric_type", "value", "unit"}).
+		AddRow(3, "Tokyo", now.Add(-2*time.Hour), "temperature_2m", 71.5, "°F").
+		AddRow(4, "Tokyo", now.Add(-3*time.Hour), "temperature_2m", 70.2, "°F")
+	mock.ExpectQuery("ORDER BY tier, timestamp DESC LIMIT \\? OFFSET \\?").
+		WithArgs("Tokyo", "temperature_2m", sqlmock.AnyArg(), 2, 2).
+		WillReturnRows(rows)
+
+	s := NewServer(database.NewFromConn(conn), nil, nil)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?location=Tokyo&type=temperature_2m&limit=2&offset=2", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Count   int  `json:"count"`
+		Total   int  `json:"total"`
+		Limit   int  `json:"limit"`
+		HasMore bool `json:"has_more"`
+		Data    []struct {
+			ID int64 `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Count != 2 || len(body.Data) != 2 || body.Data[0].ID != 3 {
+		t.Errorf("page = %+v, want readings 3 and 4", body)
+	}
+	if body.Total != 5 || body.Limit != 2 || !body.HasMore {
+		t.Errorf("total %d, limit %d, has_more %v, want 5, 2, true", body.Total, body.Limit, body.HasMore)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMetricsLastPageHasNoMore(t *testing.T) {
+	configtest.Use(t, configtest.Minimal)
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("LIMIT \\? OFFSET \\?").
+		WithArgs("Tokyo", "temperature_2m", sqlmock.AnyArg(), 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "location", "timestamp", "metric_type", "value", "unit"}).
+			AddRow(1, "Tokyo", time.Now().Add(-3*time.Hour), "temperature_2m", 70.2, "°F"))
+
+	s := NewServer(database.NewFromConn(conn), nil, nil)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?location=Tokyo&type=temperature_2m&limit=2&offset=2", nil))
+
+	var body struct {
+		Count   int  `json:"count"`
+		HasMore bool `json:"has_more"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Count != 1 || body.HasMore {
+		t.Errorf("count %d, has_more %v, want 1, false", body.Count, body.HasMore)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMetricsRejectsBadPaging(t *testing.T) {
+	configtest.Use(t, configtest.Minimal)
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	s := NewServer(database.NewFromConn(conn), nil, nil)
+	for _, query := range []string{"limit=0", "limit=-5", "limit=ten", "offset=-1", "offset=x"} {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?location=Tokyo&type=temperature_2m&"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, rec.Code)
+		}
+	}
+	// Rejected before touching the database
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,18 +1,31 @@
 package server
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"log"
+	"mime"
 	"net/http"
 	"preempt/internal/api"
 	"preempt/internal/config"
 	"preempt/internal/database"
 	"preempt/internal/detector"
+	"preempt/internal/models"
+	"preempt/internal/version"
 	"strconv"
 	"time"
 	
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+const (
+	defaultMetricsPageSize = 1000 // points per page for /metrics with a type
+	maxMetricsPageSize     = 5000 // larger limits are capped to this
+	maxFleetLocations      = 500  // locations per /fleet/latest response
+)
+
 type FetchRequest struct {
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
@@ -39,10 +52,20 @@ func NewServer(db *database.DB, client *api.OpenMeteoClient, ad *detector.Anomal
 
 	// Register routes
 	s.mux.HandleFunc("/health", s.handleHealth)
+	s.mux.HandleFunc("/version", s.handleVersion)
 	s.mux.HandleFunc("/locations", s.handleLocations)
 	s.mux.HandleFunc("/metrics", s.handleMetrics)
 	s.mux.HandleFunc("/anomalies", s.handleAnomalies)
+	s.mux.HandleFunc("/anomalies/export", s.handleAnomaliesExport)
 	s.mux.HandleFunc("/alarm-suggestions", s.handleAlarmSuggestions)
+	s.mux.HandleFunc("/suggestions/regenerate", requireDebugToken(config.GetDebugToken(), s.handleRegenerateSuggestions))
+	s.mux.HandleFunc("/suggestions/preview", s.handlePreviewSuggestion)
+	s.mux.HandleFunc("/recompute-severities", requireDebugToken(config.GetDebugToken(), s.handleRecomputeSeverities))
+	s.mux.HandleFunc("/raw-forecast", s.handleRawForecast)
+	s.mux.HandleFunc("/stale-locations", s.handleStaleLocations)
+	s.mux.HandleFunc("/fleet/latest", s.handleFleetLatest)
+	s.mux.HandleFunc("/debug/detect", requireDebugToken(config.GetDebugToken(), s.handleDebugDetect))
+	s.mux.HandleFunc("/db-status", requireDebugToken(config.GetDebugToken(), s.handleDBStatus))
 	s.mux.Handle("/prometheus", promhttp.Handler())
 
 	return s
@@ -50,7 +73,20 @@ func NewServer(db *database.DB, client *api.OpenMeteoClient, ad *detector.Anomal
 
 // Start starts the HTTP server
 func (s *Server) Start(addr string) error {
-	return http.ListenAndServe(addr, s.mux)
+	return s.httpServer(addr).ListenAndServe()
+}
+
+// httpServer wraps the routes with the configured timeouts, so slow or stalled clients can't hold
+// connections open indefinitely
+func (s *Server) httpServer(addr string) *http.Server {
+	read, write, idle := config.Get().ServerTimeouts()
+	return &http.Server{
+		Addr:         addr,
+		Handler:      s.mux,
+		ReadTimeout:  read,
+		WriteTimeout: write,
+		IdleTimeout:  idle,
+	}
 }
 
 // handleHealth returns the server health status
@@ -62,6 +98,41 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleDBStatus reports database reachability and connection pool usage, for diagnosing pool exhaustion
+func (s *Server) handleDBStatus(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	status := "ok"
+	pingErr := ""
+	if err := s.db.Ping(ctx); err != nil {
+		status = "unreachable"
+		pingErr = err.Error()
+	}
+
+	stats := s.db.Stats()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":               status,
+		"error":                pingErr,
+		"max_open_connections": stats.MaxOpenConnections,
+		"open_connections":     stats.OpenConnections,
+		"in_use":               stats.InUse,
+		"idle":                 stats.Idle,
+		"wait_count":           stats.WaitCount,
+		"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+		"max_idle_closed":      stats.MaxIdleClosed,
+		"max_idle_time_closed": stats.MaxIdleTimeClosed,
+		"max_lifetime_closed":  stats.MaxLifetimeClosed,
+	})
+}
+
+// handleVersion returns the build information of the running server
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version.Info())
+}
+
 // handleLocations returns available locations from database
 func (s *Server) handleLocations(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -86,6 +157,12 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tz, err := requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	metricType := r.URL.Query().Get("type")
 	hoursStr := r.URL.Query().Get("hours")
 	hours := 24
@@ -97,19 +174,34 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 
 	since := time.Now().Add(-time.Duration(hours) * time.Hour)
 
+	// Map views need coordinates on every point, everyone else gets them from /locations
+	includeLocation := r.URL.Query().Get("include_location") == "true"
+
 	// If no type specified, return all metrics
 	if metricType == "" {
 		cfg := config.Get()
 		allMetrics := make(map[string]interface{})
 
 		for _, field := range cfg.Weather.MonitoredFields {
+			if includeLocation {
+				located, err := s.db.GetMetricsWithLocation(location, []string{field}, since)
+				if err != nil {
+					continue
+				}
+				allMetrics[field] = map[string]interface{}{
+					"count": len(located),
+					"data":  locatedMetricsIn(located, tz),
+				}
+				continue
+			}
+
 			metrics, err := s.db.GetMetrics(location, []string{field}, since)
 			if err != nil {
 				continue
 			}
 			allMetrics[field] = map[string]interface{}{
 				"count": len(metrics),
-				"data":  metrics,
+				"data":  metricsIn(metrics, tz),
 			}
 		}
 
@@ -122,11 +214,47 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Single types are paged, a long window on a frequent metric is otherwise one huge response
+	limit := defaultMetricsPageSize
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+	if limit > maxMetricsPageSize {
+		limit = maxMetricsPageSize
+	}
+
+	offset := 0
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		o, err := strconv.Atoi(offsetStr)
+		if err != nil || o < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		offset = o
+	}
+
 	// Get specific metric type
-	metrics, err := s.db.GetMetrics(location, []string{metricType}, since)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	var data interface{}
+	var total, count int
+	if includeLocation {
+		located, n, err := s.db.GetMetricsPageWithLocation(location, metricType, since, offset, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		total, count, data = n, len(located), locatedMetricsIn(located, tz)
+	} else {
+		metrics, n, err := s.db.GetMetricsPage(location, metricType, since, offset, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		total, count, data = n, len(metrics), metricsIn(metrics, tz)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -134,8 +262,12 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		"location":    location,
 		"metric_type": metricType,
 		"hours":       hours,
-		"count":       len(metrics),
-		"data":        metrics,
+		"count":       count,
+		"total":       total,
+		"offset":      offset,
+		"limit":       limit,
+		"has_more":    offset+limit < total,
+		"data":        data,
 	})
 }
 
@@ -147,6 +279,12 @@ func (s *Server) handleAnomalies(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tz, err := requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	limitStr := r.URL.Query().Get("limit")
 	limit := 100
 	if limitStr != "" {
@@ -155,6 +293,22 @@ func (s *Server) handleAnomalies(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if r.URL.Query().Get("clustered") == "true" {
+		events, err := s.db.GetAnomalyEvents(location, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"location": location,
+			"count":    len(events),
+			"events":   anomalyEventsIn(events, tz),
+		})
+		return
+	}
+
 	anomalies, err := s.db.GetAnomalies(location, limit)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -165,8 +319,81 @@ func (s *Server) handleAnomalies(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"location":  location,
 		"count":     len(anomalies),
-		"anomalies": anomalies,
+		"anomalies": anomaliesIn(anomalies, tz),
+	})
+}
+
+// handleAnomaliesExport streams a location's anomalies as CSV, one row per anomaly as it is read
+func (s *Server) handleAnomaliesExport(w http.ResponseWriter, r *http.Request) {
+	location := r.URL.Query().Get("location")
+	if location == "" {
+		http.Error(w, "location parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	tz, err := requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Default to every anomaly up to now
+	from := time.Time{}
+	until := time.Now()
+
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		parsed, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			http.Error(w, "from must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	if untilStr := r.URL.Query().Get("until"); untilStr != "" {
+		parsed, err := time.Parse(time.RFC3339, untilStr)
+		if err != nil {
+			http.Error(w, "until must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		until = parsed
+	}
+
+	severity := r.URL.Query().Get("severity")
+	switch severity {
+	case "", "low", "medium", "high":
+	default:
+		http.Error(w, "severity must be low, medium or high", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": "anomalies-" + location + ".csv",
+	}))
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"timestamp", "metric_type", "value", "z_score", "severity", "method"})
+
+	err = s.db.EachAnomaly(r.Context(), location, from, until, severity, func(a models.Anomaly) error {
+		return writer.Write([]string{
+			a.Timestamp.In(tz).Format(time.RFC3339),
+			a.MetricType,
+			strconv.FormatFloat(a.Value, 'f', -1, 64),
+			strconv.FormatFloat(a.ZScore, 'f', -1, 64),
+			a.Severity,
+			a.Method,
+		})
 	})
+	writer.Flush()
+
+	// Headers are already sent, so a failure can only cut the file short
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		log.Printf("Anomaly export for %s stopped early: %v", location, err)
+	}
 }
 
 // handleAlarmSuggestions returns alarm suggestions
@@ -177,6 +404,12 @@ func (s *Server) handleAlarmSuggestions(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	tz, err := requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	limitStr := r.URL.Query().Get("limit")
 	limit := 50
 	if limitStr != "" {
@@ -195,6 +428,238 @@ func (s *Server) handleAlarmSuggestions(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"location":    location,
 		"count":       len(suggestions),
-		"suggestions": suggestions,
+		"suggestions": suggestionsIn(suggestions, tz),
 	})
 }
+
+// handleRegenerateSuggestions reruns the suggester over a location's stored anomalies, so config
+// changes take effect without waiting for the next detection run
+func (s *Server) handleRegenerateSuggestions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	location := r.URL.Query().Get("location")
+	if location == "" {
+		http.Error(w, "location parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	suggestions, err := s.alarmSuggester.SuggestAlarmsWithHistory(s.db, nil, location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range suggestions {
+		if err := s.db.StoreAlarmSuggestion(&suggestions[i]); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"location":    location,
+		"regenerated": len(suggestions),
+	})
+}
+
+// handlePreviewSuggestion shows the suggestion a metric's stored anomalies would produce without storing it
+func (s *Server) handlePreviewSuggestion(w http.ResponseWriter, r *http.Request) {
+	location := r.URL.Query().Get("location")
+	metricType := r.URL.Query().Get("metric")
+	if location == "" || metricType == "" {
+		http.Error(w, "location and metric parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	tz, err := requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	suggestion, err := s.alarmSuggester.PreviewSuggestion(s.db, location, metricType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if suggestion != nil {
+		suggestion.SuggestedAt = suggestion.SuggestedAt.In(tz)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"location":   location,
+		"metric":     metricType,
+		"suggestion": suggestion, // null when the anomalies don't warrant a suggestion
+	})
+}
+
+// handleRecomputeSeverities relabels stored anomalies using the current severity bands
+func (s *Server) handleRecomputeSeverities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Default to every anomaly up to now
+	from := time.Time{}
+	until := time.Now()
+
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		parsed, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			http.Error(w, "from must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	if untilStr := r.URL.Query().Get("until"); untilStr != "" {
+		parsed, err := time.Parse(time.RFC3339, untilStr)
+		if err != nil {
+			http.Error(w, "until must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		until = parsed
+	}
+
+	updated, err := s.anomalyDetector.RecomputeSeverities(r.Context(), s.db, from, until)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":    from,
+		"until":   until,
+		"updated": updated,
+	})
+}
+
+// handleRawForecast returns the stored API payload fetched closest to the requested time
+func (s *Server) handleRawForecast(w http.ResponseWriter, r *http.Request) {
+	location := r.URL.Query().Get("location")
+	if location == "" {
+		http.Error(w, "location parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	tz, err := requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	at := time.Now()
+	if atStr := r.URL.Query().Get("at"); atStr != "" {
+		parsed, err := time.Parse(time.RFC3339, atStr)
+		if err != nil {
+			http.Error(w, "at must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		at = parsed
+	}
+
+	rawForecast, err := s.db.GetNearestRawForecast(location, at)
+	if errors.Is(err, database.ErrRawForecastNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rawForecast.FetchedAt = rawForecast.FetchedAt.In(tz)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rawForecast)
+}
+
+// handleStaleLocations returns locations that have stopped receiving data
+func (s *Server) handleStaleLocations(w http.ResponseWriter, r *http.Request) {
+	tz, err := requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	threshold := 30 * time.Minute
+	if thresholdStr := r.URL.Query().Get("threshold"); thresholdStr != "" {
+		parsed, err := time.ParseDuration(thresholdStr)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "threshold must be a positive duration such as 30m or 2h", http.StatusBadRequest)
+			return
+		}
+		threshold = parsed
+	}
+
+	stale, err := s.db.GetStaleLocations(time.Now().Add(-threshold))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range stale {
+		stale[i].LastMetric = stale[i].LastMetric.In(tz)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"threshold": threshold.String(),
+		"count":     len(stale),
+		"locations": stale,
+	})
+}
+
+// handleFleetLatest returns the newest reading of every metric for every location
+func (s *Server) handleFleetLatest(w http.ResponseWriter, r *http.Request) {
+	tz, err := requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fleet, truncated, err := s.db.GetLatestMetricsAllLocations(maxFleetLocations)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, byType := range fleet {
+		for metricType, latest := range byType {
+			latest.Timestamp = latest.Timestamp.In(tz)
+			byType[metricType] = latest
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":     len(fleet),
+		"truncated": truncated,
+		"locations": fleet,
+	})
+}
+
+// handleDebugDetect runs stats detection for one location and returns the full breakdown without storing it
+func (s *Server) handleDebugDetect(w http.ResponseWriter, r *http.Request) {
+	location := r.URL.Query().Get("location")
+	if location == "" {
+		http.Error(w, "location parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	diagnostic, err := s.anomalyDetector.DiagnoseStats(s.db, location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diagnostic)
+}
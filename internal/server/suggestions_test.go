@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"preempt/internal/config/configtest"
+	"preempt/internal/database"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var anomalyColumns = []string{"id", "location", "timestamp", "metric_type", "value", "z_score", "severity", "method", "baseline_mean", "baseline_stddev", "threshold"}
+
+func TestRegenerateSuggestionsFromStoredAnomalies(t *testing.T) {
+	configtest.Use(t, configtest.Minimal)
+	t.Setenv("DEBUG_TOKEN", "secret")
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	now := time.Now()
+	rows := sqlmock.NewRows(anomalyColumns)
+	for i, value := range []float64{101, 103, 105} {
+		rows.AddRow(i+1, "Tokyo", now.Add(-time.Duration(i+1)*time.Hour), "temperature_2m", value, 2.5, "high", "stats", 80.0, 8.0, 1.0)
+	}
+	mock.ExpectQuery("SELECT .* FROM anomalies WHERE location = \\? AND timestamp >= \\?").
+		WithArgs("Tokyo", sqlmock.AnyArg()).
+		WillReturnRows(rows)
+	mock.ExpectExec("INSERT INTO alarm_suggestions").
+		WithArgs("Tokyo", "temperature_2m", sqlmock.AnyArg(), ">", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	s := NewServer(database.NewFromConn(conn), nil, nil)
+	req := httptest.NewRequest(http.MethodPost, "/suggestions/regenerate?location=Tokyo", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Location    string `json:"location"`
+		Regenerated int    `json:"regenerated"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Location != "Tokyo" || body.Regenerated != 1 {
+		t.Errorf("response = %+v, want 1 suggestion regenerated for Tokyo", body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
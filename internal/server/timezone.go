@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"preempt/internal/models"
+	"time"
+)
+
+// requestTimezone returns the IANA timezone from the tz query param, or UTC when it is absent.
+// Timestamps are stored in UTC and only converted for the response.
+func requestTimezone(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	tz, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("tz must be an IANA timezone name such as America/New_York, got %q", name)
+	}
+	return tz, nil
+}
+
+func metricsIn(metrics []models.Metric, tz *time.Location) []models.Metric {
+	for i := range metrics {
+		metrics[i].Timestamp = metrics[i].Timestamp.In(tz)
+	}
+	return metrics
+}
+
+func locatedMetricsIn(metrics []models.LocatedMetric, tz *time.Location) []models.LocatedMetric {
+	for i := range metrics {
+		metrics[i].Timestamp = metrics[i].Timestamp.In(tz)
+	}
+	return metrics
+}
+
+func anomaliesIn(anomalies []models.Anomaly, tz *time.Location) []models.Anomaly {
+	for i := range anomalies {
+		anomalies[i].Timestamp = anomalies[i].Timestamp.In(tz)
+	}
+	return anomalies
+}
+
+func anomalyEventsIn(events []models.AnomalyEvent, tz *time.Location) []models.AnomalyEvent {
+	for i := range events {
+		events[i].StartTime = events[i].StartTime.In(tz)
+		events[i].EndTime = events[i].EndTime.In(tz)
+	}
+	return events
+}
+
+func suggestionsIn(suggestions []models.AlarmSuggestion, tz *time.Location) []models.AlarmSuggestion {
+	for i := range suggestions {
+		suggestions[i].SuggestedAt = suggestions[i].SuggestedAt.In(tz)
+	}
+	return suggestions
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"preempt/internal/config/configtest"
+	"preempt/internal/database"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMetricsTimezoneParam(t *testing.T) {
+	configtest.Use(t, configtest.Minimal)
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	// One reading in daylight saving time, one outside it
+	summer := time.Date(2024, 6, 1, 16, 0, 0, 0, time.UTC)
+	winter := time.Date(2024, 1, 15, 16, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("LIMIT \\? OFFSET \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "location", "timestamp", "metric_type", "value", "unit"}).
+			AddRow(1, "Tokyo", summer, "temperature_2m", 71.5, "°F").
+			AddRow(2, "Tokyo", winter, "temperature_2m", 38.2, "°F"))
+
+	s := NewServer(database.NewFromConn(conn), nil, nil)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?location=Tokyo&type=temperature_2m&limit=2&tz=America/New_York", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Data []struct {
+			Timestamp string `json:"timestamp"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := []string{"2024-06-01T12:00:00-04:00", "2024-01-15T11:00:00-05:00"}
+	if len(body.Data) != len(want) {
+		t.Fatalf("got %d readings, want %d", len(body.Data), len(want))
+	}
+	for i, w := range want {
+		if body.Data[i].Timestamp != w {
+			t.Errorf("timestamp %d = %s, want %s", i, body.Data[i].Timestamp, w)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMetricsRejectsUnknownTimezone(t *testing.T) {
+	configtest.Use(t, configtest.Minimal)
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+
+	s := NewServer(database.NewFromConn(conn), nil, nil)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?location=Tokyo&tz=Mars/Olympus_Mons", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400 for an unknown timezone", rec.Code)
+	}
+	// Rejected before any query runs
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
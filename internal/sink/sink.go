@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"preempt/internal/config"
+	"preempt/internal/models"
+	"sync"
+)
+
+// AnomalySink is where detected anomalies are written, e.g. the database or a file for offline analysis
+type AnomalySink interface {
+	WriteAnomalies(anomalies []models.Anomaly) error
+	Close() error
+}
+
+// AnomalyStore is the part of the database the DB sink writes through
+type AnomalyStore interface {
+	StoreAnomalies(anomalies []models.Anomaly) error
+}
+
+// DBSink stores anomalies in the anomalies table
+type DBSink struct {
+	store AnomalyStore
+}
+
+// NewDBSink creates a sink storing through store
+func NewDBSink(store AnomalyStore) *DBSink {
+	return &DBSink{store: store}
+}
+
+// WriteAnomalies stores the anomalies in a single transaction
+func (s *DBSink) WriteAnomalies(anomalies []models.Anomaly) error {
+	return s.store.StoreAnomalies(anomalies)
+}
+
+// Close does nothing, the database connection belongs to the caller
+func (s *DBSink) Close() error {
+	return nil
+}
+
+// JSONLinesSink writes each anomaly as one JSON object per line
+type JSONLinesSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer // nil when the writer isn't the sink's to close
+}
+
+// NewJSONLinesSink creates a sink writing to w, which the caller keeps ownership of
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+// NewFileSink creates a sink appending to the file at path, creating it if needed
+func NewFileSink(path string) (*JSONLinesSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open anomaly output file: %w", err)
+	}
+	return &JSONLinesSink{w: f, closer: f}, nil
+}
+
+// WriteAnomalies appends the anomalies. Concurrent calls don't interleave lines.
+func (s *JSONLinesSink) WriteAnomalies(anomalies []models.Anomaly) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enc := json.NewEncoder(s.w) // Encode terminates each value with a newline
+	for _, a := range anomalies {
+		if err := enc.Encode(a); err != nil {
+			return fmt.Errorf("failed to write anomaly for %s: %w", a.Location, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying file, if the sink opened it
+func (s *JSONLinesSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// New creates the sink selected by output.anomalies in the config, warning when it bypasses MySQL
+func New(cfg *config.Config, store AnomalyStore) (AnomalySink, error) {
+	if warning := cfg.AnomalyOutputWarning(); warning != "" {
+		log.Printf("Warning: %s", warning)
+	}
+
+	switch cfg.Output.Anomalies {
+	case "file":
+		return NewFileSink(cfg.Output.Path)
+	case "stdout":
+		return NewJSONLinesSink(os.Stdout), nil
+	default:
+		return NewDBSink(store), nil
+	}
+}
+
+var (
+	_ AnomalySink = (*DBSink)(nil)
+	_ AnomalySink = (*JSONLinesSink)(nil)
+)
@@ -0,0 +1,141 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"preempt/internal/config/configtest"
+	"preempt/internal/models"
+	"testing"
+	"time"
+)
+
+func testAnomaly(location string, at time.Time) models.Anomaly {
+	return models.Anomaly{
+		Location:   location,
+		MetricType: "temperature_2m",
+		Timestamp:  at,
+		Value:      41.5,
+		ZScore:     4.2,
+		Severity:   "high",
+		Method:     "stats",
+	}
+}
+
+func readLines(t *testing.T, path string) []models.Anomaly {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open output: %v", err)
+	}
+	defer f.Close()
+
+	var anomalies []models.Anomaly
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var a models.Anomaly
+		if err := json.Unmarshal(scanner.Bytes(), &a); err != nil {
+			t.Fatalf("line %q is not a JSON anomaly: %v", scanner.Text(), err)
+		}
+		anomalies = append(anomalies, a)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	return anomalies
+}
+
+func TestFileSinkAppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anomalies.jsonl")
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	s, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("NewFileSink: %v", err)
+	}
+	if err := s.WriteAnomalies([]models.Anomaly{testAnomaly("Berlin", at), testAnomaly("Paris", at)}); err != nil {
+		t.Fatalf("first write: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// A second run appends rather than truncating
+	s, err = NewFileSink(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	if err := s.WriteAnomalies([]models.Anomaly{testAnomaly("Rome", at.Add(time.Hour))}); err != nil {
+		t.Fatalf("second write: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got := readLines(t, path)
+	if len(got) != 3 {
+		t.Fatalf("got %d lines, want 3", len(got))
+	}
+	for i, location := range []string{"Berlin", "Paris", "Rome"} {
+		if got[i].Location != location {
+			t.Errorf("line %d location = %q, want %q", i, got[i].Location, location)
+		}
+	}
+	if got[2].Severity != "high" || got[2].ZScore != 4.2 || !got[2].Timestamp.Equal(at.Add(time.Hour)) {
+		t.Errorf("fields not preserved: %+v", got[2])
+	}
+}
+
+type recordingStore struct {
+	stored []models.Anomaly
+}
+
+func (s *recordingStore) StoreAnomalies(anomalies []models.Anomaly) error {
+	s.stored = append(s.stored, anomalies...)
+	return nil
+}
+
+func TestNewSelectsSinkFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anomalies.jsonl")
+	cfg := configtest.Use(t, configtest.Minimal+`
+output:
+  anomalies: "file"
+  path: "`+path+`"
+`)
+	if cfg.AnomalyOutputWarning() == "" {
+		t.Error("file output should warn that anomalies bypass MySQL")
+	}
+
+	store := &recordingStore{}
+	s, err := New(cfg, store)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, ok := s.(*JSONLinesSink); !ok {
+		t.Fatalf("got %T, want *JSONLinesSink", s)
+	}
+	if err := s.WriteAnomalies([]models.Anomaly{testAnomaly("Berlin", time.Now())}); err != nil {
+		t.Fatalf("WriteAnomalies: %v", err)
+	}
+	s.Close()
+	if len(store.stored) != 0 {
+		t.Errorf("file sink stored %d anomalies in the database", len(store.stored))
+	}
+
+	cfg = configtest.Use(t, configtest.Minimal)
+	if warning := cfg.AnomalyOutputWarning(); warning != "" {
+		t.Errorf("db output warned: %s", warning)
+	}
+	s, err = New(cfg, store)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := s.WriteAnomalies([]models.Anomaly{testAnomaly("Berlin", time.Now())}); err != nil {
+		t.Fatalf("WriteAnomalies: %v", err)
+	}
+	if len(store.stored) != 1 {
+		t.Errorf("db sink stored %d anomalies, want 1", len(store.stored))
+	}
+}
@@ -0,0 +1,18 @@
+package version
+
+// Build information, set at build time with
+// -ldflags "-X preempt/internal/version.Version=... -X preempt/internal/version.Commit=... -X preempt/internal/version.BuildDate=..."
+var (
+	Version   = "dev"
+	Commit    = "dev"
+	BuildDate = "dev"
+)
+
+// Info returns the build information as a map suitable for JSON responses
+func Info() map[string]string {
+	return map[string]string{
+		"version":    Version,
+		"commit":     Commit,
+		"build_date": BuildDate,
+	}
+}
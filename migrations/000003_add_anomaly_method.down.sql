@@ -0,0 +1,2 @@
+-- Drop anomaly detection method column
+ALTER TABLE anomalies DROP COLUMN method;
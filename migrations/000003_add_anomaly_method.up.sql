@@ -0,0 +1,3 @@
+-- Record which detection method produced each anomaly
+-- Rows that existed before this migration keep an empty method and are left untouched by severity recomputation
+ALTER TABLE anomalies ADD COLUMN method VARCHAR(20) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Drop forecast metrics table
+DROP TABLE IF EXISTS forecast_metrics;
@@ -0,0 +1,11 @@
+-- Forecast metrics table
+-- Holds predicted (future) hourly values per location, replaced on every forecast refresh
+CREATE TABLE IF NOT EXISTS forecast_metrics (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    location VARCHAR(255) NOT NULL DEFAULT '',
+    timestamp DATETIME(6) NOT NULL,
+    metric_type VARCHAR(100) NOT NULL,
+    value DOUBLE NOT NULL,
+    fetched_at DATETIME(6) NOT NULL,
+    INDEX idx_forecast_metrics_location_timestamp (location, timestamp)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,2 @@
+-- Drop anomaly events table
+DROP TABLE IF EXISTS anomaly_events;
@@ -0,0 +1,14 @@
+-- Anomaly events table
+-- Groups bursts of anomalies on the same location and metric into a single event
+CREATE TABLE IF NOT EXISTS anomaly_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    location VARCHAR(255) NOT NULL DEFAULT '',
+    metric_type VARCHAR(100) NOT NULL,
+    start_time DATETIME(6) NOT NULL,
+    end_time DATETIME(6) NOT NULL,
+    peak_value DOUBLE NOT NULL,
+    peak_z_score DOUBLE NOT NULL,
+    severity VARCHAR(50) NOT NULL,
+    anomaly_count INT NOT NULL,
+    INDEX idx_anomaly_events_location_start (location, start_time)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,3 @@
+-- Drop metric rollup tables
+DROP TABLE IF EXISTS metrics_daily;
+DROP TABLE IF EXISTS metrics_hourly;
@@ -0,0 +1,24 @@
+-- Metric rollup tables
+-- Raw metrics past rollup.hourly_after are aggregated into metrics_hourly, which is in turn
+-- aggregated into metrics_daily past rollup.daily_after
+CREATE TABLE IF NOT EXISTS metrics_hourly (
+    location VARCHAR(255) NOT NULL DEFAULT '',
+    metric_type VARCHAR(100) NOT NULL,
+    bucket_start DATETIME(6) NOT NULL,
+    sample_count INT NOT NULL,
+    mean DOUBLE NOT NULL,
+    min_value DOUBLE NOT NULL,
+    max_value DOUBLE NOT NULL,
+    PRIMARY KEY (location, metric_type, bucket_start)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS metrics_daily (
+    location VARCHAR(255) NOT NULL DEFAULT '',
+    metric_type VARCHAR(100) NOT NULL,
+    bucket_start DATETIME(6) NOT NULL,
+    sample_count INT NOT NULL,
+    mean DOUBLE NOT NULL,
+    min_value DOUBLE NOT NULL,
+    max_value DOUBLE NOT NULL,
+    PRIMARY KEY (location, metric_type, bucket_start)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
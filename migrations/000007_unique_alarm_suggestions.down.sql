@@ -0,0 +1,2 @@
+-- Allow multiple alarm suggestions per location and metric type again
+ALTER TABLE alarm_suggestions DROP INDEX unique_alarm_suggestion_location_metric;
@@ -0,0 +1,9 @@
+-- Keep one alarm suggestion per location and metric type
+-- Older duplicates are removed first so the unique key can be created
+DELETE older FROM alarm_suggestions older
+JOIN alarm_suggestions newer
+    ON older.location = newer.location
+    AND older.metric_type = newer.metric_type
+    AND older.id < newer.id;
+
+ALTER TABLE alarm_suggestions ADD UNIQUE KEY unique_alarm_suggestion_location_metric (location, metric_type);
@@ -0,0 +1,2 @@
+-- Drop raw forecasts table
+DROP TABLE IF EXISTS raw_forecasts;
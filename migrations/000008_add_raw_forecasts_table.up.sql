@@ -0,0 +1,10 @@
+-- Raw forecasts table
+-- Optional audit trail of the exact API payloads stored, pruned by audit.raw_forecast_retention
+CREATE TABLE IF NOT EXISTS raw_forecasts (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    location VARCHAR(255) NOT NULL,
+    data_type VARCHAR(20) NOT NULL,
+    fetched_at DATETIME(6) NOT NULL,
+    payload JSON NOT NULL,
+    INDEX idx_raw_forecasts_location_fetched (location, fetched_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
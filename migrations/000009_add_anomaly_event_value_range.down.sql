@@ -0,0 +1,2 @@
+-- Drop anomaly event value range columns
+ALTER TABLE anomaly_events DROP COLUMN min_value, DROP COLUMN max_value;
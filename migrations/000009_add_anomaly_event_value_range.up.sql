@@ -0,0 +1,5 @@
+-- Record the lowest and highest anomalous value in each event
+-- Events stored before this migration keep 0 for both
+ALTER TABLE anomaly_events
+    ADD COLUMN min_value DOUBLE NOT NULL DEFAULT 0,
+    ADD COLUMN max_value DOUBLE NOT NULL DEFAULT 0;
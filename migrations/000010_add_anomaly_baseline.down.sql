@@ -0,0 +1,2 @@
+-- Drop anomaly baseline columns
+ALTER TABLE anomalies DROP COLUMN baseline_mean, DROP COLUMN baseline_stddev, DROP COLUMN threshold;
@@ -0,0 +1,6 @@
+-- Record the baseline each z-score anomaly was scored against so it can be explained later
+-- NULL for methods without a baseline (ml, staleness, flatline) and for rows stored before this migration
+ALTER TABLE anomalies
+    ADD COLUMN baseline_mean DOUBLE NULL,
+    ADD COLUMN baseline_stddev DOUBLE NULL,
+    ADD COLUMN threshold DOUBLE NULL;
@@ -0,0 +1,5 @@
+-- Return backfilled rows to an empty location
+-- Rows genuinely stored under a location named 'unknown' can't be told apart and are cleared too
+UPDATE metrics SET location = '' WHERE location = 'unknown';
+UPDATE anomalies SET location = '' WHERE location = 'unknown';
+UPDATE alarm_suggestions SET location = '' WHERE location = 'unknown';
@@ -0,0 +1,7 @@
+-- Rows stored before locations existed have an empty location and no location-scoped query returns them
+-- Give them the sentinel location 'unknown' so they stay visible, e.g. /anomalies?location=unknown
+-- To attribute them to a real location instead, rename after migrating:
+--   UPDATE metrics SET location = 'Tokyo' WHERE location = 'unknown';  -- and likewise for the other tables
+UPDATE metrics SET location = 'unknown' WHERE location = '';
+UPDATE anomalies SET location = 'unknown' WHERE location = '';
+UPDATE alarm_suggestions SET location = 'unknown' WHERE location = '';
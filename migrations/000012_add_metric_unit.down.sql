@@ -0,0 +1,2 @@
+-- Drop metric unit column
+ALTER TABLE metrics DROP COLUMN unit;
@@ -0,0 +1,3 @@
+-- Record the unit each metric was reported in so series mixing units (e.g. °C and °F) can be detected
+-- Rows stored before this migration keep an empty unit, the next stored unit becomes the series unit
+ALTER TABLE metrics ADD COLUMN unit VARCHAR(20) NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- Restore the location-only indexes and drop the composite ones
+ALTER TABLE metrics
+    ADD INDEX idx_metrics_location (location),
+    DROP INDEX idx_metrics_location_type_time;
+
+ALTER TABLE anomalies
+    ADD INDEX idx_anomalies_location (location),
+    DROP INDEX idx_anomalies_location_type_time;
@@ -0,0 +1,10 @@
+-- Composite indexes matching the detector's "location = ? AND metric_type = ? AND timestamp >= ?
+-- ORDER BY timestamp" reads, so MySQL range-scans one series in order instead of filtering a
+-- location's rows and sorting them. The location-only indexes are a prefix of these and are dropped.
+ALTER TABLE metrics
+    ADD INDEX idx_metrics_location_type_time (location, metric_type, timestamp),
+    DROP INDEX idx_metrics_location;
+
+ALTER TABLE anomalies
+    ADD INDEX idx_anomalies_location_type_time (location, metric_type, timestamp),
+    DROP INDEX idx_anomalies_location;
@@ -0,0 +1,2 @@
+-- Drop detection watermarks table
+DROP TABLE IF EXISTS detection_watermarks;
@@ -0,0 +1,7 @@
+-- Newest metric timestamp each location's last detection run covered, used by detection.only_new_data
+-- to skip locations that received no new metrics since
+CREATE TABLE IF NOT EXISTS detection_watermarks (
+    location VARCHAR(255) NOT NULL PRIMARY KEY,
+    last_metric_at DATETIME(6) NOT NULL,
+    detected_at DATETIME(6) NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,29 @@
+-- Convert wind speed back to km/h and precipitation back to mm
+UPDATE metrics SET value = value / 0.621371192, unit = 'km/h'
+    WHERE metric_type = 'wind_speed_10m' AND unit = 'mp/h';
+UPDATE metrics SET value = value * 25.4, unit = 'mm'
+    WHERE metric_type = 'precipitation' AND unit = 'inch';
+
+UPDATE forecast_metrics SET value = value / 0.621371192 WHERE metric_type = 'wind_speed_10m';
+UPDATE forecast_metrics SET value = value * 25.4 WHERE metric_type = 'precipitation';
+
+UPDATE metrics_hourly SET mean = mean / 0.621371192, min_value = min_value / 0.621371192, max_value = max_value / 0.621371192
+    WHERE metric_type = 'wind_speed_10m';
+UPDATE metrics_hourly SET mean = mean * 25.4, min_value = min_value * 25.4, max_value = max_value * 25.4
+    WHERE metric_type = 'precipitation';
+UPDATE metrics_daily SET mean = mean / 0.621371192, min_value = min_value / 0.621371192, max_value = max_value / 0.621371192
+    WHERE metric_type = 'wind_speed_10m';
+UPDATE metrics_daily SET mean = mean * 25.4, min_value = min_value * 25.4, max_value = max_value * 25.4
+    WHERE metric_type = 'precipitation';
+
+UPDATE anomalies SET value = value / 0.621371192, baseline_mean = baseline_mean / 0.621371192, baseline_stddev = baseline_stddev / 0.621371192
+    WHERE metric_type = 'wind_speed_10m';
+UPDATE anomalies SET value = value * 25.4, baseline_mean = baseline_mean * 25.4, baseline_stddev = baseline_stddev * 25.4
+    WHERE metric_type = 'precipitation';
+UPDATE anomaly_events SET peak_value = peak_value / 0.621371192, min_value = min_value / 0.621371192, max_value = max_value / 0.621371192
+    WHERE metric_type = 'wind_speed_10m';
+UPDATE anomaly_events SET peak_value = peak_value * 25.4, min_value = min_value * 25.4, max_value = max_value * 25.4
+    WHERE metric_type = 'precipitation';
+
+UPDATE alarm_suggestions SET threshold = threshold / 0.621371192 WHERE metric_type = 'wind_speed_10m';
+UPDATE alarm_suggestions SET threshold = threshold * 25.4 WHERE metric_type = 'precipitation';
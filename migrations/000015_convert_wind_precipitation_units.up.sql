@@ -0,0 +1,58 @@
+-- Requests now ask for wind speed in mph and precipitation in inches instead of the API defaults (km/h, mm)
+-- Convert stored series so new readings match their baselines and aren't rejected as a unit mismatch
+
+-- Only metrics record their unit. A series that already stored readings in the new unit (possible
+-- when the new code ran before this migration) switched at its first such reading, and rows derived
+-- from readings after that are already in the new unit. Series without one are converted entirely.
+CREATE TEMPORARY TABLE unit_switches AS
+    SELECT location, metric_type, MIN(timestamp) AS switched_at FROM metrics
+    WHERE (metric_type = 'wind_speed_10m' AND unit = 'mp/h') OR (metric_type = 'precipitation' AND unit = 'inch')
+    GROUP BY location, metric_type;
+
+-- Predictions are replaced on every refresh and don't record when their unit changed, so they are
+-- dropped rather than converted; the next forecast refresh fetches them again in the new units
+DELETE FROM forecast_metrics WHERE metric_type IN ('wind_speed_10m', 'precipitation');
+
+UPDATE metrics_hourly r LEFT JOIN unit_switches s ON s.location = r.location AND s.metric_type = r.metric_type
+    SET r.mean = r.mean * 0.621371192, r.min_value = r.min_value * 0.621371192, r.max_value = r.max_value * 0.621371192
+    WHERE r.metric_type = 'wind_speed_10m' AND (s.switched_at IS NULL OR r.bucket_start < s.switched_at);
+UPDATE metrics_hourly r LEFT JOIN unit_switches s ON s.location = r.location AND s.metric_type = r.metric_type
+    SET r.mean = r.mean / 25.4, r.min_value = r.min_value / 25.4, r.max_value = r.max_value / 25.4
+    WHERE r.metric_type = 'precipitation' AND (s.switched_at IS NULL OR r.bucket_start < s.switched_at);
+UPDATE metrics_daily r LEFT JOIN unit_switches s ON s.location = r.location AND s.metric_type = r.metric_type
+    SET r.mean = r.mean * 0.621371192, r.min_value = r.min_value * 0.621371192, r.max_value = r.max_value * 0.621371192
+    WHERE r.metric_type = 'wind_speed_10m' AND (s.switched_at IS NULL OR r.bucket_start < s.switched_at);
+UPDATE metrics_daily r LEFT JOIN unit_switches s ON s.location = r.location AND s.metric_type = r.metric_type
+    SET r.mean = r.mean / 25.4, r.min_value = r.min_value / 25.4, r.max_value = r.max_value / 25.4
+    WHERE r.metric_type = 'precipitation' AND (s.switched_at IS NULL OR r.bucket_start < s.switched_at);
+
+-- z-scores and thresholds are unitless and stay as they are
+UPDATE anomalies a LEFT JOIN unit_switches s ON s.location = a.location AND s.metric_type = a.metric_type
+    SET a.value = a.value * 0.621371192, a.baseline_mean = a.baseline_mean * 0.621371192, a.baseline_stddev = a.baseline_stddev * 0.621371192
+    WHERE a.metric_type = 'wind_speed_10m' AND (s.switched_at IS NULL OR a.timestamp < s.switched_at);
+UPDATE anomalies a LEFT JOIN unit_switches s ON s.location = a.location AND s.metric_type = a.metric_type
+    SET a.value = a.value / 25.4, a.baseline_mean = a.baseline_mean / 25.4, a.baseline_stddev = a.baseline_stddev / 25.4
+    WHERE a.metric_type = 'precipitation' AND (s.switched_at IS NULL OR a.timestamp < s.switched_at);
+UPDATE anomaly_events e LEFT JOIN unit_switches s ON s.location = e.location AND s.metric_type = e.metric_type
+    SET e.peak_value = e.peak_value * 0.621371192, e.min_value = e.min_value * 0.621371192, e.max_value = e.max_value * 0.621371192
+    WHERE e.metric_type = 'wind_speed_10m' AND (s.switched_at IS NULL OR e.start_time < s.switched_at);
+UPDATE anomaly_events e LEFT JOIN unit_switches s ON s.location = e.location AND s.metric_type = e.metric_type
+    SET e.peak_value = e.peak_value / 25.4, e.min_value = e.min_value / 25.4, e.max_value = e.max_value / 25.4
+    WHERE e.metric_type = 'precipitation' AND (s.switched_at IS NULL OR e.start_time < s.switched_at);
+
+-- Descriptions keep the old numbers until the next detection run regenerates the suggestion
+UPDATE alarm_suggestions g LEFT JOIN unit_switches s ON s.location = g.location AND s.metric_type = g.metric_type
+    SET g.threshold = g.threshold * 0.621371192
+    WHERE g.metric_type = 'wind_speed_10m' AND (s.switched_at IS NULL OR g.suggested_at < s.switched_at);
+UPDATE alarm_suggestions g LEFT JOIN unit_switches s ON s.location = g.location AND s.metric_type = g.metric_type
+    SET g.threshold = g.threshold / 25.4
+    WHERE g.metric_type = 'precipitation' AND (s.switched_at IS NULL OR g.suggested_at < s.switched_at);
+
+-- Metrics go last, converting them records the new unit the switch times above are read from
+-- Rows without a unit predate unit tracking and were always in the API defaults
+UPDATE metrics SET value = value * 0.621371192, unit = 'mp/h'
+    WHERE metric_type = 'wind_speed_10m' AND unit IN ('km/h', '');
+UPDATE metrics SET value = value / 25.4, unit = 'inch'
+    WHERE metric_type = 'precipitation' AND unit IN ('mm', '');
+
+DROP TEMPORARY TABLE unit_switches;
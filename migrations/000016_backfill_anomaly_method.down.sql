@@ -0,0 +1,2 @@
+-- Not reversible: the backfilled rows can't be told apart from rows stored with a method
+SELECT 1;
@@ -0,0 +1,5 @@
+-- Anomalies stored before 000003 have an empty method, so severity recomputation (which only
+-- relabels stats anomalies) never reached them. Before then stats flagged |z| > 1, while ML stored
+-- its isolation forest score, the absolute value of a score_samples result in (0, 1], as z_score.
+UPDATE anomalies SET method = 'stats' WHERE method = '' AND ABS(z_score) > 1;
+UPDATE anomalies SET method = 'ml' WHERE method = '';
@@ -0,0 +1,2 @@
+-- Allow multiple anomaly events per location, metric type and start time again
+ALTER TABLE anomaly_events DROP INDEX unique_anomaly_event_series_start;
@@ -0,0 +1,11 @@
+-- Keep one anomaly event per location, metric type and start time, so a burst detected again
+-- by the next run updates its event instead of adding another
+-- Older duplicates are removed first so the unique key can be created, the newest run saw the most of the burst
+DELETE older FROM anomaly_events older
+JOIN anomaly_events newer
+    ON older.location = newer.location
+    AND older.metric_type = newer.metric_type
+    AND older.start_time = newer.start_time
+    AND older.id < newer.id;
+
+ALTER TABLE anomaly_events ADD UNIQUE KEY unique_anomaly_event_series_start (location, metric_type, start_time);
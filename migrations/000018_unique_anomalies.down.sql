@@ -0,0 +1,2 @@
+-- Allow repeated anomalies for the same reading again
+ALTER TABLE anomalies DROP INDEX unique_anomaly_series_time_method;
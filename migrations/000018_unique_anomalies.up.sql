@@ -0,0 +1,12 @@
+-- Keep one anomaly per location, metric type, timestamp and method, so a reading or prediction
+-- detected again by the next run updates its row instead of adding another
+-- Older duplicates are removed first so the unique key can be created
+DELETE older FROM anomalies older
+JOIN anomalies newer
+    ON older.location = newer.location
+    AND older.metric_type = newer.metric_type
+    AND older.timestamp = newer.timestamp
+    AND older.method = newer.method
+    AND older.id < newer.id;
+
+ALTER TABLE anomalies ADD UNIQUE KEY unique_anomaly_series_time_method (location, metric_type, timestamp, method);